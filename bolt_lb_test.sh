@@ -10,6 +10,7 @@ NC='\033[0m'
 
 # Configuration
 LOAD_BALANCER_PORT=8100
+ADMIN_PORT=8190
 BACKEND1_PORT=8081
 BACKEND2_PORT=8082
 BACKEND3_PORT=8083
@@ -158,7 +159,7 @@ start_load_balancer(){
     PIDS+=($!)
 
     sleep 3
-    wait_for_service "http://localhost:$LOAD_BALANCER_PORT/health" "Load Balancer"
+    wait_for_service "http://localhost:$ADMIN_PORT/health" "Load Balancer"
 
     echo -e "${GREEN} Load balancer is running!${NC}"
 }
@@ -167,10 +168,10 @@ test_server_status() {
     echo -e "\n${PURPLE} Step 4: Testing server status...${NC}"
     
     echo -e "\n${CYAN} Load Balancer Health:${NC}"
-    curl -s "http://localhost:$LOAD_BALANCER_PORT/health" || echo -e "${RED}❌ Health check failed${NC}"
+    curl -s "http://localhost:$ADMIN_PORT/health" || echo -e "${RED}❌ Health check failed${NC}"
     
     echo -e "\n\n${CYAN} Load Balancer Status:${NC}"
-    curl -s "http://localhost:$LOAD_BALANCER_PORT/status" || echo -e "${RED}❌ Status check failed${NC}"
+    curl -s "http://localhost:$ADMIN_PORT/status" || echo -e "${RED}❌ Status check failed${NC}"
     
     echo -e "\n\n${CYAN} Backend Health Checks:${NC}"
     echo -e "${BLUE}Backend 1:${NC}"
@@ -317,8 +318,8 @@ show_summary() {
     echo -e "${BLUE}   Backend 3:     http://localhost:$BACKEND3_PORT${NC}"
     
     echo -e "\n${CYAN} Health Endpoints:${NC}"
-    echo -e "${BLUE}   Health: http://localhost:$LOAD_BALANCER_PORT/health${NC}"
-    echo -e "${BLUE}   Status: http://localhost:$LOAD_BALANCER_PORT/status${NC}"
+    echo -e "${BLUE}   Health: http://localhost:$ADMIN_PORT/health${NC}"
+    echo -e "${BLUE}   Status: http://localhost:$ADMIN_PORT/status${NC}"
     
     echo -e "\n${YELLOW}Press Ctrl+C to stop all services${NC}"
 }
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/adminclient"
+	"github.com/farhapartex/bolt-load-balancer/internal/core"
+)
+
+const (
+	DefaultAddress  = "http://127.0.0.1:8190"
+	DefaultInterval = 2 * time.Second
+
+	OutputTable = "table"
+	OutputJSON  = "json"
+)
+
+type Application struct {
+	options adminclient.Options
+	output  string
+	pool    string
+	stdout  io.Writer
+}
+
+func (app *Application) commonFlags(fs *flag.FlagSet) {
+	address := os.Getenv("BOLT_ADMIN_ADDR")
+	if address == "" {
+		address = DefaultAddress
+	}
+	fs.StringVar(&app.options.Address, "addr", address, "Admin listener URL or unix socket path")
+	fs.StringVar(&app.options.Token, "token", os.Getenv("BOLT_ADMIN_TOKEN"), "Admin API bearer token")
+	fs.StringVar(&app.options.CAFile, "ca-file", "", "CA certificate used to verify the admin listener")
+	fs.StringVar(&app.options.CertFile, "cert", "", "Client certificate for the admin listener")
+	fs.StringVar(&app.options.KeyFile, "key", "", "Client certificate key")
+	fs.StringVar(&app.output, "output", OutputTable, "Output format: table or json")
+	fs.StringVar(&app.output, "o", OutputTable, "Output format: table or json (short)")
+}
+
+// parseArgs parses flags for a command and returns its positional arguments.
+// Flags may appear before or after the positional arguments.
+func (app *Application) parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if app.output != OutputTable && app.output != OutputJSON {
+		return nil, fmt.Errorf("unknown output format %q, expected table or json", app.output)
+	}
+	return positional, nil
+}
+
+func (app *Application) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	app.commonFlags(fs)
+	return fs
+}
+
+func (app *Application) client() (*adminclient.Client, error) {
+	return adminclient.NewClient(app.options)
+}
+
+func (app *Application) printJSON(v interface{}) error {
+	encoder := json.NewEncoder(app.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func (app *Application) printStatus(report core.StatusReport) {
+	fmt.Fprintf(app.stdout, "Status: %s  Version: %s  Uptime: %s  Healthy: %d/%d  In flight: %d\n\n",
+		report.Status, report.Version,
+		(time.Duration(report.UptimeSeconds) * time.Second).String(),
+		report.HealthyBackends, report.TotalBackends, report.InFlightRequests)
+
+	tw := tabwriter.NewWriter(app.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "POOL\tID\tURL\tHEALTH\tSTATE\tWEIGHT\tCONNS\tLATENCY\tFAILS")
+	for _, pool := range report.Pools {
+		for _, backend := range pool.Backends {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\t%d/%d\n",
+				pool.Name, backend.ID, backend.URL, backend.Status, backend.State,
+				backend.Weight, backend.InFlightRequests, formatLatency(backend.LatencyMs),
+				backend.FailCount, backend.MaxFails)
+		}
+	}
+	tw.Flush()
+}
+
+func formatLatency(ms float64) string {
+	if ms == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(ms, 'f', 1, 64) + "ms"
+}
+
+func (app *Application) printBackend(backend core.BackendStatus, action string) error {
+	if app.output == OutputJSON {
+		return app.printJSON(backend)
+	}
+	fmt.Fprintf(app.stdout, "Backend %s in pool %s %s (state %s, weight %d)\n",
+		backend.URL, backend.Pool, action, backend.State, backend.Weight)
+	return nil
+}
+
+func (app *Application) runStatus(args []string) error {
+	positional, err := app.parseArgs(app.newFlagSet("status"), args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return errors.New("usage: boltctl status")
+	}
+
+	client, err := app.client()
+	if err != nil {
+		return err
+	}
+	report, err := client.Status(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if app.output == OutputJSON {
+		return app.printJSON(report)
+	}
+	app.printStatus(report)
+	return nil
+}
+
+// runBackendAction handles commands that take a backend and change its admin
+// state.
+func (app *Application) runBackendAction(name string, args []string) error {
+	fs := app.newFlagSet(name)
+	fs.StringVar(&app.pool, "pool", "", "Pool of the backend, when its URL is used in several pools")
+	positional, err := app.parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: boltctl %s <backend>", name)
+	}
+
+	client, err := app.client()
+	if err != nil {
+		return err
+	}
+
+	var backend core.BackendStatus
+	switch name {
+	case "drain":
+		backend, err = client.Drain(context.Background(), positional[0], app.pool)
+	case "enable":
+		backend, err = client.Enable(context.Background(), positional[0], app.pool)
+	}
+	if err != nil {
+		return err
+	}
+	return app.printBackend(backend, "is now "+backend.State)
+}
+
+func (app *Application) runWeight(args []string) error {
+	fs := app.newFlagSet("weight")
+	fs.StringVar(&app.pool, "pool", "", "Pool of the backend, when its URL is used in several pools")
+	positional, err := app.parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return errors.New("usage: boltctl weight <backend> <weight>")
+	}
+	weight, err := strconv.Atoi(positional[1])
+	if err != nil {
+		return fmt.Errorf("invalid weight %q", positional[1])
+	}
+
+	client, err := app.client()
+	if err != nil {
+		return err
+	}
+	backend, err := client.SetWeight(context.Background(), positional[0], app.pool, weight)
+	if err != nil {
+		return err
+	}
+	return app.printBackend(backend, "updated")
+}
+
+func (app *Application) runReload(args []string) error {
+	positional, err := app.parseArgs(app.newFlagSet("reload"), args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return errors.New("usage: boltctl reload")
+	}
+
+	client, err := app.client()
+	if err != nil {
+		return err
+	}
+	result, err := client.Reload(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if app.output == OutputJSON {
+		return app.printJSON(result)
+	}
+	fmt.Fprintf(app.stdout, "Configuration reloaded (%s), pools: %s\n",
+		result.ConfigHash, strings.Join(result.Pools, ", "))
+	return nil
+}
+
+// runWatch redraws the status table every interval until interrupted. With
+// JSON output it prints one status report per line instead.
+func (app *Application) runWatch(args []string) error {
+	fs := app.newFlagSet("watch")
+	var interval time.Duration
+	fs.DurationVar(&interval, "interval", DefaultInterval, "Time between updates")
+	fs.DurationVar(&interval, "n", DefaultInterval, "Time between updates (short)")
+	positional, err := app.parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return errors.New("usage: boltctl watch")
+	}
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive, got %s", interval)
+	}
+
+	client, err := app.client()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := client.Status(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if app.output == OutputJSON {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			} else {
+				json.NewEncoder(app.stdout).Encode(report)
+			}
+		} else {
+			// Clear the screen and move the cursor home before redrawing.
+			fmt.Fprint(app.stdout, "\033[H\033[2J")
+			fmt.Fprintf(app.stdout, "Every %s: %s  %s\n\n", interval, app.options.Address, time.Now().Format(time.TimeOnly))
+			if err != nil {
+				fmt.Fprintf(app.stdout, "Error: %v\n", err)
+			} else {
+				app.printStatus(report)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *Application) printHelp() {
+	fmt.Printf(`boltctl controls a running bolt load balancer through its admin API.
+		USAGE:
+			boltctl <COMMAND> [OPTIONS] [ARGS]
+
+		COMMANDS:
+			status                     Show pools and backends with health, weight and connections
+			drain <backend>            Stop sending new requests to a backend
+			enable <backend>           Send requests to a drained or disabled backend again
+			weight <backend> <n>       Change a backend's weight
+			reload                     Re-read bolt's configuration file
+			watch                      Redraw the status table until interrupted
+
+			<backend> is a backend ID from 'boltctl status' or its URL.
+
+		OPTIONS:
+			--addr <ADDR>              Admin listener URL or unix socket path (default: %s, env BOLT_ADMIN_ADDR)
+			--token <TOKEN>            Admin API bearer token (env BOLT_ADMIN_TOKEN)
+			--ca-file <FILE>           CA certificate used to verify a TLS admin listener
+			--cert <FILE>              Client certificate for the admin listener
+			--key <FILE>               Client certificate key
+			-o, --output <FORMAT>      Output format: table or json (default: table)
+			--pool <POOL>              Pool of the backend, when its URL is used in several pools
+			-n, --interval <DURATION>  Time between updates for watch (default: %s)
+
+		EXAMPLES:
+			# Take a backend out of rotation before maintenance
+			boltctl drain http://10.0.0.5:8080
+
+			# Send twice the traffic to a backend
+			boltctl weight 3f9c2a1b7d4e 2
+
+			# List unhealthy backends in a script
+			boltctl status -o json | jq '.pools[].backends[] | select(.healthy | not)'
+		`, DefaultAddress, DefaultInterval)
+}
+
+func (app *Application) Run(args []string) error {
+	if len(args) == 0 {
+		app.printHelp()
+		return nil
+	}
+
+	switch args[0] {
+	case "status":
+		return app.runStatus(args[1:])
+	case "drain", "enable":
+		return app.runBackendAction(args[0], args[1:])
+	case "weight":
+		return app.runWeight(args[1:])
+	case "reload":
+		return app.runReload(args[1:])
+	case "watch":
+		return app.runWatch(args[1:])
+	case "help", "-h", "--help":
+		app.printHelp()
+		return nil
+	default:
+		return fmt.Errorf("unknown command '%s', run 'boltctl help' for usage", args[0])
+	}
+}
+
+func main() {
+	app := &Application{stdout: os.Stdout}
+	if err := app.Run(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
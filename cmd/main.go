@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -23,77 +26,218 @@ type Application struct {
 	config       *config.Config
 	loadBalancer *core.LB
 	logger       *logger.Logger
+	strict       bool
+	configFormat string
 }
 
-func (app *Application) parseFlags() (configFile string, showVersion bool, showHelp bool, err error) {
-	flag.StringVar(&configFile, "config", DefaultConfigFile, "Path to configuration file")
-	flag.StringVar(&configFile, "c", DefaultConfigFile, "Path to configuration file (short)")
-	flag.BoolVar(&showVersion, "version", false, "Show version information")
-	flag.BoolVar(&showVersion, "v", false, "Show version information (short)")
-	flag.BoolVar(&showHelp, "help", false, "Show help information")
-	flag.BoolVar(&showHelp, "h", false, "Show help information (short)")
+func (app *Application) configFlags(fs *flag.FlagSet) *string {
+	configFile := new(string)
+	fs.StringVar(configFile, "config", DefaultConfigFile, "Path to configuration file")
+	fs.StringVar(configFile, "c", DefaultConfigFile, "Path to configuration file (short)")
+	fs.BoolVar(&app.strict, "strict", true, "Reject unknown configuration keys and invalid values")
+	fs.StringVar(&app.configFormat, "config-format", "", "Configuration format: yaml, json or toml (default: from file extension)")
+	return configFile
+}
+
+func (app *Application) parseFlags(args []string) (configFile string, showVersion bool, showHelp bool, err error) {
+	fs := flag.NewFlagSet("bolt", flag.ContinueOnError)
+	file := app.configFlags(fs)
+	fs.BoolVar(&showVersion, "version", false, "Show version information")
+	fs.BoolVar(&showVersion, "v", false, "Show version information (short)")
+	fs.BoolVar(&showHelp, "help", false, "Show help information")
+	fs.BoolVar(&showHelp, "h", false, "Show help information (short)")
 
-	flag.Parse()
+	if err := fs.Parse(args); err != nil {
+		return "", false, false, err
+	}
 
-	return configFile, showVersion, showHelp, nil
+	return *file, showVersion, showHelp, nil
 }
 
 func (app *Application) printHelp() {
 	fmt.Printf(`Go Load Balancer v%s
 		USAGE:
-			loadbalancer [OPTIONS]
+			bolt [COMMAND] [OPTIONS]
+
+		COMMANDS:
+			serve                  Start the load balancer (default)
+			validate               Load and validate a configuration file
+			print-config           Print the effective configuration after defaults and env overrides
+			init                   Write a commented starter configuration file
 
 		OPTIONS:
 			-c, --config <FILE>    Path to configuration file (default: %s)
+			--strict=false         Ignore unknown configuration keys and replace invalid values with defaults
+			--config-format <FMT>  Configuration format: yaml, json or toml (default: from file extension)
 			-v, --version          Show version information
 			-h, --help             Show this help message
 
+		PRINT-CONFIG OPTIONS:
+			-o, --output <FORMAT>  Output format: yaml, json or toml (default: yaml)
+			--out <FILE>           Write the configuration to a file instead of stdout
+
+		INIT OPTIONS:
+			-c, --config <FILE>    File to create (default: %s)
+			-f, --force            Overwrite an existing file
+
 		EXAMPLES:
 			# Start with default configuration
-			loadbalancer
-			
+			bolt
+
 			# Start with custom configuration file
-			loadbalancer -c /path/to/config.yaml
-			
+			bolt -c /path/to/config.yaml
+
+			# Check a configuration in a deploy pipeline
+			bolt validate -c /path/to/config.yaml
+
+			# Show the configuration bolt would actually run with
+			bolt print-config -c /path/to/config.yaml -o json
+
 			# Show version
-			loadbalancer --version
+			bolt --version
 
 		CONFIGURATION:
-			The load balancer uses YAML configuration files. See the example
-			configuration file for all available options.
+			The load balancer reads YAML, JSON or TOML configuration files. Run 'bolt init' to
+			create a commented starter configuration with all available options.
 
-		HEALTH ENDPOINTS:
+		ADMIN ENDPOINTS (admin listener, default 127.0.0.1:8190):
 			GET /health    - Load balancer health status
 			GET /status    - Detailed status information
+			Use boltctl to drain backends, change weights and reload the configuration.
+
+		SIGNALS:
+			SIGHUP         Reload the configuration file
 
-		For more information, visit: https://github.com/yourusername/go-loadbalancer
-		`, VERSION, DefaultConfigFile)
+		For more information, visit: https://github.com/farhapartex/bolt-load-balancer
+		`, VERSION, DefaultConfigFile, DefaultConfigFile)
 }
 
-func (app *Application) loadConfig(configFile string) error {
+func (app *Application) loadConfig(configFile string, allowDefault bool) error {
+	var cfg *config.Config
 	if _, err := os.Stat(configFile); os.IsNotExist(err) {
-		if configFile == DefaultConfigFile {
-			fmt.Printf("Configuration file '%s' not found, using default configuration\n", configFile)
-			app.config = config.DefaultConfig()
-			return nil
+		if !allowDefault || configFile != DefaultConfigFile {
+			return fmt.Errorf("configuration file '%s' does not exist", configFile)
+		}
+		fmt.Fprintf(os.Stderr, "Configuration file '%s' not found, using default configuration\n", configFile)
+		cfg = config.DefaultConfig()
+	} else {
+		cfg, err = config.LoadFromFileWithOptions(configFile, config.LoadOptions{
+			Strict: app.strict,
+			Format: app.configFormat,
+		})
+		if err != nil {
+			return err
 		}
-		return fmt.Errorf("configuration file '%s' does not exist", configFile)
 	}
 
-	cfg, err := config.LoadFromFile(configFile)
+	var err error
+	app.config, err = config.LoadFromEnv(cfg)
 	if err != nil {
+		return fmt.Errorf("failed to load config from environment: %w", err)
+	}
+
+	return nil
+}
+
+func (app *Application) runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	configFile := app.configFlags(fs)
+	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
-	app.config, err = config.LoadFromEnv(cfg)
+	if err := app.loadConfig(*configFile, false); err != nil {
+		return err
+	}
+
+	if err := app.config.Validate(); err != nil {
+		return fmt.Errorf("configuration is invalid after environment overrides: %w", err)
+	}
+
+	fmt.Printf("Configuration file '%s' is valid\n", *configFile)
+	return nil
+}
+
+func (app *Application) runPrintConfig(args []string) error {
+	fs := flag.NewFlagSet("print-config", flag.ContinueOnError)
+	configFile := app.configFlags(fs)
+	var format, outFile string
+	fs.StringVar(&format, "output", config.FormatYAML, "Output format: yaml, json or toml")
+	fs.StringVar(&format, "o", config.FormatYAML, "Output format: yaml, json or toml (short)")
+	fs.StringVar(&outFile, "out", "", "Write the configuration to a file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := app.loadConfig(*configFile, true); err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	formatSet := false
+	fs.Visit(func(f *flag.Flag) {
+		formatSet = formatSet || f.Name == "output" || f.Name == "o"
+	})
+	if outFile != "" {
+		fromName := config.FormatFromFilename(outFile)
+		switch {
+		case !formatSet:
+			format = fromName
+		case hasConfigExtension(outFile) && fromName != format:
+			return fmt.Errorf("output format %s does not match the extension of '%s'", format, outFile)
+		}
+	}
+
+	if format == config.FormatYAML && outFile == "" {
+		fmt.Print(app.config.DataReprensation())
+		return nil
+	}
+
+	data, err := app.config.EncodeWithSources(format)
 	if err != nil {
-		return fmt.Errorf("failed to load config from yaml file: %w", err)
+		return err
+	}
+	if outFile != "" {
+		if err := os.WriteFile(outFile, data, 0644); err != nil {
+			return fmt.Errorf("failed to write configuration file '%s': %w", outFile, err)
+		}
+		return nil
+	}
+	os.Stdout.Write(data)
+	return nil
+}
+
+// hasConfigExtension reports whether filename ends in an extension that
+// names a configuration format.
+func hasConfigExtension(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml", ".json", ".toml":
+		return true
+	}
+	return false
+}
+
+func (app *Application) runInit(args []string) error {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	var configFile string
+	var force bool
+	fs.StringVar(&configFile, "config", DefaultConfigFile, "File to create")
+	fs.StringVar(&configFile, "c", DefaultConfigFile, "File to create (short)")
+	fs.BoolVar(&force, "force", false, "Overwrite an existing file")
+	fs.BoolVar(&force, "f", false, "Overwrite an existing file (short)")
+	if err := fs.Parse(args); err != nil {
+		return err
 	}
 
+	if err := config.WriteStarterConfig(configFile, force); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote starter configuration to '%s'\n", configFile)
 	return nil
 }
 
 func (app *Application) createLoadBalancer() error {
+	core.Version = VERSION
 	lb, err := core.NewLB(app.config)
 	if err != nil {
 		return err
@@ -114,6 +258,19 @@ func (app *Application) setupGracefulShutdown(cancel context.CancelFunc) {
 	}()
 }
 
+// setupReload reloads the configuration file whenever bolt receives SIGHUP.
+func (app *Application) setupReload() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+
+	go func() {
+		for range c {
+			app.logger.Info("Received SIGHUP, reloading configuration")
+			app.loadBalancer.Reload()
+		}
+	}()
+}
+
 func (app *Application) startLoadBalancer(ctx context.Context) error {
 	errChan := make(chan error, 1)
 	go func() {
@@ -142,8 +299,8 @@ func (app *Application) startLoadBalancer(ctx context.Context) error {
 	}
 }
 
-func (app *Application) Run() error {
-	configFile, showVersion, showHelp, err := app.parseFlags()
+func (app *Application) runServe(args []string) error {
+	configFile, showVersion, showHelp, err := app.parseFlags(args)
 	if err != nil {
 		return err
 	}
@@ -157,7 +314,7 @@ func (app *Application) Run() error {
 		return nil
 	}
 
-	if err := app.loadConfig(configFile); err != nil {
+	if err := app.loadConfig(configFile, true); err != nil {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
 
@@ -170,14 +327,37 @@ func (app *Application) Run() error {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	app.setupGracefulShutdown(cancel)
+	app.setupReload()
 
 	return app.startLoadBalancer(ctx)
 }
 
+func (app *Application) Run(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return app.runServe(args)
+	}
+
+	switch args[0] {
+	case "serve":
+		return app.runServe(args[1:])
+	case "validate":
+		return app.runValidate(args[1:])
+	case "print-config":
+		return app.runPrintConfig(args[1:])
+	case "init":
+		return app.runInit(args[1:])
+	default:
+		return fmt.Errorf("unknown command '%s', run 'bolt --help' for usage", args[0])
+	}
+}
+
 func main() {
 	app := &Application{}
 
-	if err := app.Run(); err != nil {
+	if err := app.Run(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
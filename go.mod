@@ -2,4 +2,17 @@ module github.com/farhapartex/bolt-load-balancer
 
 go 1.24.4
 
-require gopkg.in/yaml.v2 v2.4.0 // indirect
+require (
+	github.com/BurntSushi/toml v1.6.0
+	golang.org/x/crypto v0.48.0
+	google.golang.org/grpc v1.80.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	golang.org/x/net v0.49.0 // indirect
+	golang.org/x/sys v0.41.0 // indirect
+	golang.org/x/text v0.34.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260120221211-b8f7ae30c516 // indirect
+	google.golang.org/protobuf v1.36.11 // indirect
+)
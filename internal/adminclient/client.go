@@ -0,0 +1,197 @@
+package adminclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/core"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// Options describes how to reach a bolt admin listener.
+type Options struct {
+	// Address is the admin listener's base URL, such as
+	// http://127.0.0.1:8190, or the path of its unix socket, optionally
+	// prefixed with unix://.
+	Address string
+	// Token is sent as a bearer token when set.
+	Token string
+
+	// CAFile verifies an admin listener served over TLS.
+	CAFile string
+	// CertFile and KeyFile present a client certificate.
+	CertFile string
+	KeyFile  string
+}
+
+// Client calls the admin API of a running bolt.
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// Error is returned when the admin API answers with an error status.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("admin API returned %d: %s", e.StatusCode, e.Message)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(data, &apiErr) != nil || apiErr.Error == "" {
+			apiErr.Error = strings.TrimSpace(string(data))
+		}
+		return &Error{StatusCode: resp.StatusCode, Message: apiErr.Error}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode admin API response: %w", err)
+	}
+	return nil
+}
+
+// backendPath returns the admin API path of a backend given by ID or URL.
+func backendPath(backend, pool, action string) string {
+	path := "/admin/backends/" + url.PathEscape(backend)
+	if action != "" {
+		path += "/" + action
+	}
+	if pool != "" {
+		path += "?pool=" + url.QueryEscape(pool)
+	}
+	return path
+}
+
+func (c *Client) Status(ctx context.Context) (core.StatusReport, error) {
+	var report core.StatusReport
+	err := c.do(ctx, http.MethodGet, "/status", nil, &report)
+	return report, err
+}
+
+// Drain stops new requests to backend, a backend ID or URL. pool is only
+// needed when the URL is used in several pools.
+func (c *Client) Drain(ctx context.Context, backend, pool string) (core.BackendStatus, error) {
+	var status core.BackendStatus
+	err := c.do(ctx, http.MethodPost, backendPath(backend, pool, "drain"), nil, &status)
+	return status, err
+}
+
+func (c *Client) Enable(ctx context.Context, backend, pool string) (core.BackendStatus, error) {
+	var status core.BackendStatus
+	err := c.do(ctx, http.MethodPost, backendPath(backend, pool, "enable"), nil, &status)
+	return status, err
+}
+
+func (c *Client) SetWeight(ctx context.Context, backend, pool string, weight int) (core.BackendStatus, error) {
+	var status core.BackendStatus
+	body := map[string]int{"weight": weight}
+	err := c.do(ctx, http.MethodPatch, backendPath(backend, pool, ""), body, &status)
+	return status, err
+}
+
+// Reload makes bolt re-read its configuration file.
+func (c *Client) Reload(ctx context.Context) (core.ReloadResult, error) {
+	var result core.ReloadResult
+	err := c.do(ctx, http.MethodPost, "/admin/reload", nil, &result)
+	return result, err
+}
+
+func newTLSConfig(opts Options) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.CAFile)
+		}
+	}
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func NewClient(opts Options) (*Client, error) {
+	tlsConfig, err := newTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{TLSClientConfig: tlsConfig}
+	baseURL := strings.TrimSuffix(opts.Address, "/")
+
+	if socket, ok := strings.CutPrefix(opts.Address, "unix://"); ok || strings.HasPrefix(opts.Address, "/") {
+		if !ok {
+			socket = opts.Address
+		}
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		baseURL = "http://bolt"
+	} else if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+
+	return &Client{
+		baseURL:    baseURL,
+		token:      opts.Token,
+		httpClient: &http.Client{Transport: transport, Timeout: defaultTimeout},
+	}, nil
+}
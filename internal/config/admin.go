@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Admin roles. Read-only callers may use GET endpoints; read-write callers
+// may also change backends.
+const (
+	RoleReadOnly  = "read-only"
+	RoleReadWrite = "read-write"
+)
+
+// AdminAuthConfig protects the admin listener. Callers authenticate with a
+// bearer token or, when TLS is enabled, a client certificate signed by
+// ClientCAFile. With no tokens and no client CA, authentication is off.
+type AdminAuthConfig struct {
+	// TokensFile lists one "<role>:<token>" entry per line. Blank lines and
+	// lines starting with # are ignored.
+	TokensFile string `yaml:"tokens_file,omitempty"`
+	// TokensEnv names an environment variable holding comma or newline
+	// separated "<role>:<token>" entries.
+	TokensEnv    string `yaml:"tokens_env,omitempty"`
+	ClientCAFile string `yaml:"client_ca_file,omitempty"`
+	// ClientCertRoles maps certificate common names to roles. Verified
+	// certificates that are not listed get read-only access.
+	ClientCertRoles map[string]string `yaml:"client_cert_roles,omitempty"`
+}
+
+// Enabled reports whether any authentication method is configured.
+func (a AdminAuthConfig) Enabled() bool {
+	return a.TokensFile != "" || a.TokensEnv != "" || a.ClientCAFile != ""
+}
+
+// AdminTLSConfig serves the admin TCP listener over HTTPS.
+type AdminTLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+func validRole(role string) bool {
+	return role == RoleReadOnly || role == RoleReadWrite
+}
+
+func (c *Config) validateAdminAuth(problems *ValidationError) {
+	admin := c.Admin
+
+	if admin.TLS != nil {
+		if admin.TLS.CertFile == "" || admin.TLS.KeyFile == "" {
+			problems.add("admin.tls", c.positionOf("admin.tls"), "admin TLS needs both cert_file and key_file")
+		}
+	}
+
+	if admin.Auth.ClientCAFile != "" && admin.TLS == nil {
+		problems.add("admin.auth.client_ca_file", c.positionOf("admin.auth.client_ca_file"),
+			"client certificate authentication requires admin.tls")
+	}
+
+	for name, role := range admin.Auth.ClientCertRoles {
+		if !validRole(role) {
+			path := "admin.auth.client_cert_roles." + name
+			problems.add(path, c.positionOf(path), "invalid role %q. Supported roles: [%s %s]", role, RoleReadOnly, RoleReadWrite)
+		}
+	}
+
+	// Unauthenticated control endpoints must not be reachable from other
+	// machines.
+	if admin.Enabled && admin.Port != 0 && !admin.Auth.Enabled() && !isLoopbackHost(admin.Host) {
+		problems.add("admin.host", c.positionOf("admin.host"),
+			"admin listener on non-loopback address %q requires admin.auth", admin.Host)
+	}
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// ParseAdminToken splits a "<role>:<token>" entry.
+func ParseAdminToken(entry string) (role, token string, err error) {
+	role, token, ok := strings.Cut(strings.TrimSpace(entry), ":")
+	if !ok || token == "" {
+		return "", "", fmt.Errorf("admin token entries must look like '<role>:<token>'")
+	}
+	if !validRole(role) {
+		return "", "", fmt.Errorf("invalid role %q. Supported roles: [%s %s]", role, RoleReadOnly, RoleReadWrite)
+	}
+	return role, token, nil
+}
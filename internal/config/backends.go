@@ -0,0 +1,93 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Filename returns the file the configuration was loaded from, or "" when it
+// was not loaded from a file.
+func (c *Config) Filename() string {
+	return c.filename
+}
+
+// CanPersist reports whether SaveConfToFile can write the configuration back
+// to the file it was loaded from without losing or duplicating settings.
+func (c *Config) CanPersist() error {
+	if c.filename == "" {
+		return errors.New("configuration was not loaded from a file")
+	}
+	if c.sourceFiles > 1 {
+		return fmt.Errorf("configuration in '%s' uses includes or drop-ins", c.filename)
+	}
+	return nil
+}
+
+// poolBackends returns the backend list of the named pool, where the default
+// pool is the top-level backends.
+func (c *Config) poolBackends(pool string) (*[]BackendConfig, error) {
+	if pool == DefaultPoolName && (len(c.Backends) > 0 || len(c.Pools) == 0) {
+		return &c.Backends, nil
+	}
+	for i := range c.Pools {
+		if c.Pools[i].Name == pool {
+			return &c.Pools[i].Backends, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown pool %q", pool)
+}
+
+// AddBackend validates backend, fills in defaults and appends it to pool. It
+// returns the backend as added.
+func (c *Config) AddBackend(pool string, backend BackendConfig) (BackendConfig, error) {
+	backends, err := c.poolBackends(pool)
+	if err != nil {
+		return BackendConfig{}, err
+	}
+	for _, existing := range *backends {
+		if existing.URL == backend.URL {
+			return BackendConfig{}, fmt.Errorf("backend %s already exists in pool %q", backend.URL, pool)
+		}
+	}
+
+	added := []BackendConfig{backend}
+	problems := &ValidationError{}
+	c.validateBackends("backend", added, problems)
+	if err := problems.errOrNil(); err != nil {
+		return BackendConfig{}, err
+	}
+
+	*backends = append(*backends, added[0])
+	return added[0], nil
+}
+
+// RemoveBackend deletes the backend with the given URL from pool.
+func (c *Config) RemoveBackend(pool, url string) error {
+	backends, err := c.poolBackends(pool)
+	if err != nil {
+		return err
+	}
+	for i, backend := range *backends {
+		if backend.URL == url {
+			*backends = append((*backends)[:i], (*backends)[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("backend %s not found in pool %q", url, pool)
+}
+
+// UpdateBackend calls update with the configuration of the backend with the
+// given URL in pool.
+func (c *Config) UpdateBackend(pool, url string, update func(*BackendConfig)) error {
+	backends, err := c.poolBackends(pool)
+	if err != nil {
+		return err
+	}
+	for i := range *backends {
+		if (*backends)[i].URL == url {
+			update(&(*backends)[i])
+			return nil
+		}
+	}
+	return fmt.Errorf("backend %s not found in pool %q", url, pool)
+}
@@ -1,11 +1,15 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
-
-	"gopkg.in/yaml.v2"
 )
 
 type ServerConfig struct {
@@ -14,6 +18,24 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration `yaml:"read_timeout"`
 	WriteTimeout time.Duration `yaml:"write_timeout"`
 	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+
+	// TrustedProxies lists the addresses or CIDR ranges of proxies in front
+	// of bolt whose X-Forwarded-* and Forwarded headers are believed.
+	TrustedProxies []string `yaml:"trusted_proxies,omitempty"`
+	// ForwardedHeader adds an RFC 7239 Forwarded header to upstream requests.
+	ForwardedHeader bool `yaml:"forwarded_header,omitempty"`
+
+	// TLS serves the listener over HTTPS when set.
+	TLS *ServerTLSConfig `yaml:"tls,omitempty"`
+	// HTTPRedirect adds a plain HTTP listener that redirects to HTTPS.
+	HTTPRedirect *HTTPRedirectConfig `yaml:"http_redirect,omitempty"`
+	// HSTS adds a Strict-Transport-Security header to HTTPS responses.
+	HSTS *HSTSConfig `yaml:"hsts,omitempty"`
+
+	// H2C accepts cleartext HTTP/2 with prior knowledge alongside HTTP/1.1
+	// on a listener without TLS.
+	H2C   bool         `yaml:"h2c,omitempty"`
+	HTTP2 *HTTP2Config `yaml:"http2,omitempty"`
 }
 
 type BackendConfig struct {
@@ -21,6 +43,25 @@ type BackendConfig struct {
 	Weight      int           `yaml:"weight"`
 	MaxFails    int           `yaml:"max_fails"`
 	FailTimeout time.Duration `yaml:"fail_timeout"`
+
+	RequestHeaders  *HeaderRules `yaml:"request_headers,omitempty"`
+	ResponseHeaders *HeaderRules `yaml:"response_headers,omitempty"`
+
+	// TLS configures connections to https:// backends, for proxied
+	// requests and health checks alike.
+	TLS *BackendTLSConfig `yaml:"tls,omitempty"`
+
+	// Protocol is the HTTP version spoken to the backend: auto, http1, h2
+	// or h2c.
+	Protocol string              `yaml:"protocol,omitempty"`
+	HTTP2    *BackendHTTP2Config `yaml:"http2,omitempty"`
+
+	// Disabled backends receive no traffic until enabled through the admin
+	// API.
+	Disabled bool `yaml:"disabled,omitempty"`
+
+	// Source is the configuration file this backend was defined in.
+	Source string `yaml:"-"`
 }
 
 type HealthCheckConfig struct {
@@ -29,6 +70,11 @@ type HealthCheckConfig struct {
 	Timeout        time.Duration `yaml:"timeout"`
 	Path           string        `yaml:"path"`
 	ExpectedStatus int           `yaml:"expected_status"`
+
+	// Type is http, which checks Path for ExpectedStatus, or grpc, which
+	// calls the standard grpc.health.v1 service for GRPCService.
+	Type        string `yaml:"type,omitempty"`
+	GRPCService string `yaml:"grpc_service,omitempty"`
 }
 
 type LoggingConfig struct {
@@ -37,12 +83,89 @@ type LoggingConfig struct {
 	AccessLog bool   `yaml:"access_log"`
 }
 
+// RequestIDConfig controls how requests are tagged with an ID that is
+// forwarded to backends, returned to clients and added to every log line.
+type RequestIDConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Header carries the ID. An incoming value is reused when present.
+	Header string `yaml:"header"`
+	// Format of generated IDs: "uuidv7" or "ulid".
+	Format string `yaml:"format"`
+}
+
+// AdminConfig controls the listener serving health, status, metrics and
+// control endpoints, kept apart from proxied traffic.
+type AdminConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Host    string `yaml:"host"`
+	// Port of the TCP listener. Zero disables it, which requires Socket.
+	Port int `yaml:"port"`
+	// Socket is the path of an optional unix socket served alongside the
+	// TCP listener.
+	Socket string          `yaml:"socket,omitempty"`
+	Auth   AdminAuthConfig `yaml:"auth,omitempty"`
+	TLS    *AdminTLSConfig `yaml:"tls,omitempty"`
+
+	// Persist writes backend changes made through the admin API back to the
+	// configuration file.
+	Persist bool `yaml:"persist,omitempty"`
+	// Dashboard serves the web dashboard at /dashboard/.
+	Dashboard bool `yaml:"dashboard"`
+}
+
+// PublicEndpointsConfig exposes admin endpoints on the public listener at the
+// given paths. Empty paths are not intercepted and reach the backends.
+type PublicEndpointsConfig struct {
+	Health  string `yaml:"health,omitempty"`
+	Status  string `yaml:"status,omitempty"`
+	Metrics string `yaml:"metrics,omitempty"`
+}
+
+// MetricsConfig controls the Prometheus metrics endpoint.
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"`
+}
+
+// TracingConfig controls W3C trace context propagation and span export to an
+// OTLP/HTTP collector.
+type TracingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint is the collector's OTLP/HTTP traces URL.
+	Endpoint    string `yaml:"endpoint"`
+	ServiceName string `yaml:"service_name"`
+	// SampleRatio is the fraction of new traces recorded. Requests that
+	// already carry a traceparent follow the caller's decision.
+	SampleRatio   float64       `yaml:"sample_ratio"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+}
+
 type Config struct {
 	Server      ServerConfig      `yaml:"server"`
 	Backends    []BackendConfig   `yaml:"backends"`
 	Strategy    string            `yaml:"strategy"`
 	HealthCheck HealthCheckConfig `yaml:"health_check"`
 	Logging     LoggingConfig     `yaml:"logging"`
+	RequestID   RequestIDConfig   `yaml:"request_id"`
+	Admin       AdminConfig       `yaml:"admin"`
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+
+	PublicEndpoints PublicEndpointsConfig `yaml:"public_endpoints,omitempty"`
+	Pools           []PoolConfig          `yaml:"pools,omitempty"`
+	Routes          []RouteConfig         `yaml:"routes,omitempty"`
+	DefaultPool     string                `yaml:"default_pool,omitempty"`
+
+	RequestHeaders  *HeaderRules `yaml:"request_headers,omitempty"`
+	ResponseHeaders *HeaderRules `yaml:"response_headers,omitempty"`
+
+	// lenient replaces invalid values with defaults instead of reporting
+	// them. Configurations are strict unless loaded with Strict false.
+	lenient     bool
+	positions   map[string]position
+	filename    string
+	format      string
+	sourceFiles int
 }
 
 func DefaultConfig() *Config {
@@ -75,101 +198,320 @@ func DefaultConfig() *Config {
 			Format:    "text",
 			AccessLog: true,
 		},
+		RequestID: RequestIDConfig{
+			Enabled: true,
+			Header:  "X-Request-ID",
+			Format:  "uuidv7",
+		},
+		Admin: AdminConfig{
+			Enabled:   true,
+			Host:      "127.0.0.1",
+			Port:      8190,
+			Dashboard: true,
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+			Path:    "/metrics",
+		},
+		Tracing: TracingConfig{
+			Enabled:       false,
+			Endpoint:      "http://localhost:4318/v1/traces",
+			ServiceName:   "bolt",
+			SampleRatio:   1,
+			FlushInterval: 5 * time.Second,
+		},
 	}
 }
 
+// Validate fills in defaults for unset values and reports every invalid
+// setting at once. In strict mode invalid values are errors; otherwise they
+// are replaced with their defaults as older versions did.
 func (c *Config) Validate() error {
+	problems := &ValidationError{}
+
 	if c.Server.Port < 1 || c.Server.Port > 65535 {
-		return fmt.Errorf("server port must be between 1 and 65535, got %d", c.Server.Port)
+		problems.add("server.port", c.positionOf("server.port"),
+			"server port must be between 1 and 65535, got %d", c.Server.Port)
 	}
 
 	if c.Server.Host == "" {
 		c.Server.Host = "0.0.0.0"
 	}
 
-	if len(c.Backends) == 0 {
-		return fmt.Errorf("at least one backend must be configured")
+	for i, entry := range c.Server.TrustedProxies {
+		path := fmt.Sprintf("server.trusted_proxies[%d]", i)
+		if strings.Contains(entry, "/") {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				problems.add(path, c.positionOf(path), "invalid CIDR %q", entry)
+			}
+		} else if net.ParseIP(entry) == nil {
+			problems.add(path, c.positionOf(path), "invalid IP address %q", entry)
+		}
+	}
+
+	c.validateServerTLS(problems)
+	c.validateHTTPRedirect(problems)
+	c.validateHSTS(problems)
+	c.validateServerHTTP2(problems)
+
+	if len(c.Backends) == 0 && len(c.Pools) == 0 {
+		problems.add("backends", c.positionOf("backends"), "at least one backend must be configured")
+	}
+
+	c.validateBackends("backends", c.Backends, problems)
+
+	if c.Strategy == "" {
+		c.Strategy = "round_robin"
+	}
+	c.validateStrategy("strategy", c.Strategy, problems)
+	c.validateHealthCheck("health_check", &c.HealthCheck, problems)
+
+	c.validatePools(problems)
+	c.validateGRPCHealthChecks(problems)
+	c.validateRoutes(problems)
+	if c.RequestID.Header == "" {
+		c.RequestID.Header = "X-Request-ID"
+	} else if !validHeaderName(c.RequestID.Header) {
+		problems.add("request_id.header", c.positionOf("request_id.header"), "invalid header name %q", c.RequestID.Header)
+	}
+
+	if c.RequestID.Format == "" {
+		c.RequestID.Format = "uuidv7"
+	} else if c.RequestID.Format != "uuidv7" && c.RequestID.Format != "ulid" {
+		problems.add("request_id.format", c.positionOf("request_id.format"),
+			"invalid request ID format %q. Supported formats: [uuidv7 ulid]", c.RequestID.Format)
+	}
+
+	c.validateAdmin(problems)
+
+	if c.Metrics.Path == "" {
+		c.Metrics.Path = "/metrics"
+	} else if !strings.HasPrefix(c.Metrics.Path, "/") {
+		problems.add("metrics.path", c.positionOf("metrics.path"), "metrics path must start with '/', got %q", c.Metrics.Path)
+	}
+
+	c.validateTracing(problems)
+
+	c.validateHeaderRules("request_headers", c.RequestHeaders, problems)
+	c.validateHeaderRules("response_headers", c.ResponseHeaders, problems)
+
+	validLogLevels := []string{"debug", "info", "warn", "error"}
+	isValidLogLevel := false
+	for _, level := range validLogLevels {
+		if c.Logging.Level == level {
+			isValidLogLevel = true
+			break
+		}
+	}
+
+	if !isValidLogLevel {
+		if !c.lenient && c.Logging.Level != "" {
+			problems.add("logging.level", c.positionOf("logging.level"), "invalid log level %q. Supported levels: %v",
+				c.Logging.Level, validLogLevels)
+		} else {
+			c.Logging.Level = "info"
+		}
+	}
+
+	if c.Logging.Format != "json" && c.Logging.Format != "text" {
+		if !c.lenient && c.Logging.Format != "" {
+			problems.add("logging.format", c.positionOf("logging.format"), "invalid log format %q. Supported formats: [json text]",
+				c.Logging.Format)
+		} else {
+			c.Logging.Format = "text"
+		}
 	}
 
-	for i, backend := range c.Backends {
+	return problems.errOrNil()
+}
+
+func (c *Config) validateBackends(path string, backends []BackendConfig, problems *ValidationError) {
+	for i, backend := range backends {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+
 		if backend.URL == "" {
-			return fmt.Errorf("backend %d: URL cannot be empty", i)
+			problems.add(itemPath+".url", c.positionOf(itemPath+".url"), "backend %d: URL cannot be empty", i)
+		} else if _, err := url.Parse(backend.URL); err != nil {
+			problems.add(itemPath+".url", c.positionOf(itemPath+".url"), "backend %d: invalid URL: %v", i, err)
 		}
 
-		if backend.Weight < 1 {
-			c.Backends[i].Weight = 1
+		// An unset weight or max_fails is also zero, so only a zero written
+		// in the file is an error.
+		if (backend.Weight < 0 || backend.Weight == 0 && c.isSet(itemPath+".weight")) && !c.lenient {
+			problems.add(itemPath+".weight", c.positionOf(itemPath+".weight"), "weight must be at least 1, got %d", backend.Weight)
+		} else if backend.Weight < 1 {
+			backends[i].Weight = 1
 		}
 
-		if backend.MaxFails < 1 {
-			c.Backends[i].MaxFails = 3
+		if (backend.MaxFails < 0 || backend.MaxFails == 0 && c.isSet(itemPath+".max_fails")) && !c.lenient {
+			problems.add(itemPath+".max_fails", c.positionOf(itemPath+".max_fails"), "max_fails must be at least 1, got %d", backend.MaxFails)
+		} else if backend.MaxFails < 1 {
+			backends[i].MaxFails = 3
 		}
 
-		if backend.FailTimeout <= 0 {
-			c.Backends[i].FailTimeout = 30 * time.Second
+		if backend.FailTimeout < 0 && !c.lenient {
+			problems.add(itemPath+".fail_timeout", c.positionOf(itemPath+".fail_timeout"), "fail_timeout must be positive, got %s", backend.FailTimeout)
+		} else if backend.FailTimeout <= 0 {
+			backends[i].FailTimeout = 30 * time.Second
 		}
+
+		c.validateHeaderRules(itemPath+".request_headers", backend.RequestHeaders, problems)
+		c.validateHeaderRules(itemPath+".response_headers", backend.ResponseHeaders, problems)
+		c.validateBackendTLS(itemPath, backend, problems)
+		c.validateBackendHTTP2(itemPath, &backends[i], problems)
 	}
+}
 
+func (c *Config) validateStrategy(path, strategy string, problems *ValidationError) {
 	validStrategies := []string{"round_robin"}
-	if c.Strategy == "" {
-		c.Strategy = "round_robin"
-	}
 
 	isValidStrategy := false
-	for _, strategy := range validStrategies {
-		if c.Strategy == strategy {
+	for _, valid := range validStrategies {
+		if strategy == valid {
 			isValidStrategy = true
 			break
 		}
 	}
 
 	if !isValidStrategy {
-		return fmt.Errorf("invalid load balancing strategy: %s. Supported strategies: %v",
-			c.Strategy, validStrategies)
+		problems.add(path, c.positionOf(path), "invalid load balancing strategy: %s. Supported strategies: %v",
+			strategy, validStrategies)
 	}
+}
 
-	if c.HealthCheck.Interval <= 0 {
-		c.HealthCheck.Interval = 30 * time.Second
+func (c *Config) validateHealthCheck(path string, hc *HealthCheckConfig, problems *ValidationError) {
+	if hc.Interval < 0 && !c.lenient {
+		problems.add(path+".interval", c.positionOf(path+".interval"), "interval must be positive, got %s", hc.Interval)
+	} else if hc.Interval <= 0 {
+		hc.Interval = 30 * time.Second
 	}
 
-	if c.HealthCheck.Timeout <= 0 {
-		c.HealthCheck.Timeout = 5 * time.Second
+	if hc.Timeout < 0 && !c.lenient {
+		problems.add(path+".timeout", c.positionOf(path+".timeout"), "timeout must be positive, got %s", hc.Timeout)
+	} else if hc.Timeout <= 0 {
+		hc.Timeout = 5 * time.Second
 	}
 
-	if c.HealthCheck.Path == "" {
-		c.HealthCheck.Path = "/health"
+	if hc.Path == "" {
+		hc.Path = "/health"
 	}
 
-	if c.HealthCheck.ExpectedStatus == 0 {
-		c.HealthCheck.ExpectedStatus = 200
+	switch hc.Type {
+	case "":
+		hc.Type = HealthCheckHTTP
+	case HealthCheckHTTP, HealthCheckGRPC:
+	default:
+		problems.add(path+".type", c.positionOf(path+".type"),
+			"invalid health check type %q. Supported: [http grpc]", hc.Type)
+	}
+	if hc.GRPCService != "" && hc.Type != HealthCheckGRPC {
+		problems.add(path+".grpc_service", c.positionOf(path+".grpc_service"), "grpc_service needs type grpc")
 	}
 
-	validLogLevels := []string{"debug", "info", "warn", "error"}
-	isValidLogLevel := false
-	for _, level := range validLogLevels {
-		if c.Logging.Level == level {
-			isValidLogLevel = true
-			break
+	if hc.ExpectedStatus == 0 {
+		hc.ExpectedStatus = 200
+	} else if !c.lenient && (hc.ExpectedStatus < 100 || hc.ExpectedStatus > 599) {
+		problems.add(path+".expected_status", c.positionOf(path+".expected_status"),
+			"expected_status must be a valid HTTP status code, got %d", hc.ExpectedStatus)
+	}
+}
+
+func (c *Config) validateAdmin(problems *ValidationError) {
+	if c.Admin.Host == "" {
+		c.Admin.Host = "127.0.0.1"
+	}
+
+	if c.Admin.Enabled {
+		if c.Admin.Port == 0 && c.Admin.Socket == "" {
+			problems.add("admin.port", c.positionOf("admin.port"), "admin listener needs a port or a socket")
+		} else if c.Admin.Port < 0 || c.Admin.Port > 65535 {
+			problems.add("admin.port", c.positionOf("admin.port"),
+				"admin port must be between 1 and 65535, got %d", c.Admin.Port)
+		} else if c.Admin.Port == c.Server.Port {
+			problems.add("admin.port", c.positionOf("admin.port"),
+				"admin port must differ from server port %d", c.Server.Port)
 		}
 	}
 
-	if !isValidLogLevel {
-		c.Logging.Level = "info"
+	c.validateAdminAuth(problems)
+
+	endpoints := []struct {
+		name string
+		path string
+	}{
+		{"health", c.PublicEndpoints.Health},
+		{"status", c.PublicEndpoints.Status},
+		{"metrics", c.PublicEndpoints.Metrics},
+	}
+	for _, endpoint := range endpoints {
+		if endpoint.path != "" && !strings.HasPrefix(endpoint.path, "/") {
+			path := "public_endpoints." + endpoint.name
+			problems.add(path, c.positionOf(path), "path must start with '/', got %q", endpoint.path)
+		}
+	}
+}
+
+func (c *Config) validateTracing(problems *ValidationError) {
+	if c.Tracing.ServiceName == "" {
+		c.Tracing.ServiceName = "bolt"
 	}
 
-	if c.Logging.Format != "json" && c.Logging.Format != "text" {
-		c.Logging.Format = "text"
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		problems.add("tracing.sample_ratio", c.positionOf("tracing.sample_ratio"),
+			"sample_ratio must be between 0 and 1, got %g", c.Tracing.SampleRatio)
 	}
 
-	return nil
+	if c.Tracing.FlushInterval < 0 && !c.lenient {
+		problems.add("tracing.flush_interval", c.positionOf("tracing.flush_interval"),
+			"flush_interval must be positive, got %s", c.Tracing.FlushInterval)
+	} else if c.Tracing.FlushInterval <= 0 {
+		c.Tracing.FlushInterval = 5 * time.Second
+	}
+
+	if !c.Tracing.Enabled {
+		return
+	}
+	if c.Tracing.Endpoint == "" {
+		problems.add("tracing.endpoint", c.positionOf("tracing.endpoint"), "tracing endpoint cannot be empty")
+	} else if endpoint, err := url.Parse(c.Tracing.Endpoint); err != nil || endpoint.Host == "" ||
+		(endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		problems.add("tracing.endpoint", c.positionOf("tracing.endpoint"),
+			"tracing endpoint must be an http or https URL, got %q", c.Tracing.Endpoint)
+	}
+}
+
+// isSet reports whether the setting at path was written in the file.
+func (c *Config) isSet(path string) bool {
+	_, ok := c.positions[path]
+	return ok
+}
+
+// positionOf returns the source position of path, falling back to the
+// closest enclosing key when the path itself was not present in the file.
+func (c *Config) positionOf(path string) position {
+	for path != "" {
+		if pos, ok := c.positions[path]; ok {
+			return pos
+		}
+
+		cut := strings.LastIndexAny(path, ".[")
+		if cut < 0 {
+			break
+		}
+		path = path[:cut]
+	}
+	return position{}
 }
 
+// SaveConfToFile writes the configuration in the format matching the file
+// extension.
 func (c *Config) SaveConfToFile(filename string) error {
-	data, err := yaml.Marshal(c)
+	data, err := c.Encode(FormatFromFilename(filename))
 	if err != nil {
-		return fmt.Errorf("failed to marshal configuration to YAML: %w", err)
+		return err
 	}
 
-	err = os.WriteFile(filename, data, 0644)
+	err = WriteFileAtomic(filename, data, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to write configuration file '%s': %w", filename, err)
 	}
@@ -177,9 +519,47 @@ func (c *Config) SaveConfToFile(filename string) error {
 	return nil
 }
 
+// WriteFileAtomic replaces path through a temporary file and a rename, so
+// readers never see a partial file. An existing file keeps its mode; a new
+// one gets perm.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Hash returns a digest of the effective configuration, letting operators
+// tell whether two instances run the same settings.
+func (c *Config) Hash() string {
+	data, err := c.Encode(FormatJSON)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
 func (c *Config) DataReprensation() string {
 	// DataReprensation returns a human-readable string representation of the configuration. Like Python __str__ method
-	data, err := yaml.Marshal(c)
+	data, err := c.EncodeWithSources(FormatYAML)
 	if err != nil {
 		return fmt.Sprintf("Error marshaling config: %v", err)
 	}
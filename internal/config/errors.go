@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FieldError describes a single problem found in a configuration file,
+// pointing at the offending YAML path and, when known, its line number.
+// File is only set for problems in included or drop-in files.
+type FieldError struct {
+	File    string
+	Path    string
+	Line    int
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("%s:%d: %s: %s", e.File, e.Line, e.Path, e.Message)
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Path, e.Message)
+	}
+	if e.Path != "" {
+		return fmt.Sprintf("%s: %s", e.Path, e.Message)
+	}
+	return e.Message
+}
+
+// ValidationError collects every problem found while loading or validating
+// a configuration so they can be reported together.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+
+	lines := make([]string, 0, len(e.Errors)+1)
+	lines = append(lines, fmt.Sprintf("%d configuration errors:", len(e.Errors)))
+	for _, fe := range e.Errors {
+		lines = append(lines, "  "+fe.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// position locates a key in the configuration files; file is empty for the
+// root file.
+type position struct {
+	file string
+	line int
+}
+
+func (e *ValidationError) add(path string, pos position, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{
+		File:    pos.file,
+		Path:    path,
+		Line:    pos.line,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (e *ValidationError) sort() {
+	sort.SliceStable(e.Errors, func(i, j int) bool {
+		if e.Errors[i].File != e.Errors[j].File {
+			return e.Errors[i].File < e.Errors[j].File
+		}
+		return e.Errors[i].Line < e.Errors[j].Line
+	})
+}
+
+func (e *ValidationError) errOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
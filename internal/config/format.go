@@ -0,0 +1,386 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+	FormatTOML = "toml"
+)
+
+// FormatFromFilename picks the configuration format from a file extension,
+// defaulting to YAML for unknown or missing extensions.
+func FormatFromFilename(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatYAML
+	}
+}
+
+// parseDocument parses data in the given format into a YAML node tree so all
+// formats share the same decoding, strict checks and validation.
+func parseDocument(data []byte, format string) (*yaml.Node, error) {
+	switch format {
+	case FormatYAML, "yml", "":
+		var root yaml.Node
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML configuration: %w", err)
+		}
+		return &root, nil
+	case FormatJSON:
+		root, err := parseJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JSON configuration: %w", err)
+		}
+		return root, nil
+	case FormatTOML:
+		root, err := parseTOML(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse TOML configuration: %w", err)
+		}
+		return root, nil
+	default:
+		return nil, fmt.Errorf("unsupported configuration format: %s", format)
+	}
+}
+
+// Encode renders the configuration in the requested format. Durations are
+// written as strings like "30s" in every format so the output can be loaded
+// back unchanged.
+func (c *Config) Encode(format string) ([]byte, error) {
+	return c.encode(format, false)
+}
+
+// EncodeWithSources is Encode with the file every backend was loaded from:
+// a comment in YAML and a source field in JSON and TOML. Loading the output
+// again ignores the source fields.
+func (c *Config) EncodeWithSources(format string) ([]byte, error) {
+	return c.encode(format, true)
+}
+
+func (c *Config) encode(format string, withSources bool) ([]byte, error) {
+	switch format {
+	case FormatYAML, "yml", "":
+		var node yaml.Node
+		if err := node.Encode(c); err != nil {
+			return nil, fmt.Errorf("failed to marshal configuration to YAML: %w", err)
+		}
+		if withSources {
+			c.annotateSources(&node, true)
+		}
+
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(&node); err != nil {
+			return nil, fmt.Errorf("failed to marshal configuration to YAML: %w", err)
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, fmt.Errorf("failed to marshal configuration to YAML: %w", err)
+		}
+		return buf.Bytes(), nil
+	case FormatJSON:
+		var node yaml.Node
+		if err := node.Encode(c); err != nil {
+			return nil, fmt.Errorf("failed to marshal configuration to JSON: %w", err)
+		}
+		if withSources {
+			c.annotateSources(&node, false)
+		}
+
+		var buf bytes.Buffer
+		if err := writeJSONNode(&buf, &node); err != nil {
+			return nil, fmt.Errorf("failed to marshal configuration to JSON: %w", err)
+		}
+
+		var out bytes.Buffer
+		if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+			return nil, fmt.Errorf("failed to marshal configuration to JSON: %w", err)
+		}
+		out.WriteByte('\n')
+		return out.Bytes(), nil
+	case FormatTOML:
+		var node yaml.Node
+		if err := node.Encode(c); err != nil {
+			return nil, fmt.Errorf("failed to marshal configuration to TOML: %w", err)
+		}
+		if withSources {
+			c.annotateSources(&node, false)
+		}
+
+		var generic map[string]interface{}
+		if err := node.Decode(&generic); err != nil {
+			return nil, fmt.Errorf("failed to marshal configuration to TOML: %w", err)
+		}
+
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(generic); err != nil {
+			return nil, fmt.Errorf("failed to marshal configuration to TOML: %w", err)
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported configuration format: %s", format)
+	}
+}
+
+// sourceKey is the field EncodeWithSources adds to backends in JSON and
+// TOML.
+const sourceKey = "source"
+
+// annotateSources marks every backend with the file it was loaded from, as
+// a comment or, for formats without comments, a source field.
+func (c *Config) annotateSources(node *yaml.Node, asComment bool) {
+	annotateBackends(mappingValue(node, "backends"), c.Backends, asComment)
+
+	pools := mappingValue(node, "pools")
+	if pools == nil || pools.Kind != yaml.SequenceNode {
+		return
+	}
+	for i, item := range pools.Content {
+		if i < len(c.Pools) {
+			annotateBackends(mappingValue(item, "backends"), c.Pools[i].Backends, asComment)
+		}
+	}
+}
+
+func annotateBackends(node *yaml.Node, backends []BackendConfig, asComment bool) {
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return
+	}
+
+	for i, item := range node.Content {
+		if i >= len(backends) || backends[i].Source == "" {
+			continue
+		}
+		if asComment {
+			item.HeadComment = "from " + backends[i].Source
+		} else {
+			item.Content = append(item.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: sourceKey},
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: backends[i].Source})
+		}
+	}
+}
+
+// parseJSON builds a YAML node tree from a JSON document, recording the line
+// of every value so errors point into the original file.
+func parseJSON(data []byte) (*yaml.Node, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	lineAt := func() int {
+		return bytes.Count(data[:decoder.InputOffset()], []byte("\n")) + 1
+	}
+
+	var parseValue func() (*yaml.Node, error)
+	parseValue = func() (*yaml.Node, error) {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		line := lineAt()
+
+		switch value := token.(type) {
+		case json.Delim:
+			if value == '{' {
+				node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: line}
+				for decoder.More() {
+					keyToken, err := decoder.Token()
+					if err != nil {
+						return nil, err
+					}
+					key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: keyToken.(string), Line: lineAt()}
+					child, err := parseValue()
+					if err != nil {
+						return nil, err
+					}
+					node.Content = append(node.Content, key, child)
+				}
+				_, err := decoder.Token()
+				return node, err
+			}
+
+			node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: line}
+			for decoder.More() {
+				child, err := parseValue()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, child)
+			}
+			_, err := decoder.Token()
+			return node, err
+		case string:
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Line: line}, nil
+		case json.Number:
+			tag := "!!int"
+			if strings.ContainsAny(value.String(), ".eE") {
+				tag = "!!float"
+			}
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value.String(), Line: line}, nil
+		case bool:
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(value), Line: line}, nil
+		default:
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null", Line: line}, nil
+		}
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return &yaml.Node{}, nil
+	}
+
+	value, err := parseValue()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after top-level value")
+	}
+
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{value}}, nil
+}
+
+// parseTOML builds a YAML node tree from a TOML document. TOML keys keep
+// their file order, but line numbers are not available for this format.
+func parseTOML(data []byte) (*yaml.Node, error) {
+	var raw map[string]interface{}
+	meta, err := toml.Decode(string(data), &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	order := make(map[string]int)
+	for i, key := range meta.Keys() {
+		if _, ok := order[key.String()]; !ok {
+			order[key.String()] = i
+		}
+	}
+
+	root, err := tomlNode(raw, "", order)
+	if err != nil {
+		return nil, err
+	}
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}, nil
+}
+
+func tomlNode(value interface{}, path string, order map[string]int) (*yaml.Node, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.SliceStable(keys, func(i, j int) bool {
+			return order[joinPath(path, keys[i])] < order[joinPath(path, keys[j])]
+		})
+
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, key := range keys {
+			child, err := tomlNode(v[key], joinPath(path, key), order)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+		}
+		return node, nil
+	case []map[string]interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			child, err := tomlNode(item, path, order)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			child, err := tomlNode(item, path, order)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	default:
+		node := &yaml.Node{}
+		if err := node.Encode(v); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+}
+
+// writeJSONNode converts a YAML node tree to compact JSON, keeping the
+// key order of the original document.
+func writeJSONNode(buf *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("null")
+			return nil
+		}
+		return writeJSONNode(buf, node.Content[0])
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, err := json.Marshal(node.Content[i].Value)
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := writeJSONNode(buf, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSONNode(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case yaml.AliasNode:
+		return writeJSONNode(buf, node.Alias)
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!int", "!!float", "!!bool":
+			buf.WriteString(node.Value)
+		case "!!null":
+			buf.WriteString("null")
+		default:
+			value, err := json.Marshal(node.Value)
+			if err != nil {
+				return err
+			}
+			buf.Write(value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Health check types, for health_check.type.
+const (
+	HealthCheckHTTP = "http"
+	HealthCheckGRPC = "grpc"
+)
+
+// SpeaksHTTP2 reports whether requests to the backend can use HTTP/2, as
+// gRPC needs. With protocol auto, that depends on an https:// backend
+// offering h2.
+func (b BackendConfig) SpeaksHTTP2() bool {
+	switch b.Protocol {
+	case ProtocolH2, ProtocolH2C:
+		return true
+	case ProtocolHTTP1:
+		return false
+	}
+	u, err := url.Parse(b.URL)
+	return err == nil && u.Scheme == "https"
+}
+
+// validateGRPCHealthChecks checks that the backends of pools with gRPC
+// health checks are reached over HTTP/2. It runs after validatePools, once
+// the protocols have their defaults.
+func (c *Config) validateGRPCHealthChecks(problems *ValidationError) {
+	if len(c.Backends) > 0 && c.HealthCheck.Type == HealthCheckGRPC {
+		c.checkGRPCBackends("backends", c.Backends, problems)
+	}
+	for i, pool := range c.Pools {
+		healthCheck := pool.HealthCheck
+		if healthCheck == nil {
+			healthCheck = &c.HealthCheck
+		}
+		if healthCheck.Type == HealthCheckGRPC {
+			c.checkGRPCBackends(fmt.Sprintf("pools[%d].backends", i), pool.Backends, problems)
+		}
+	}
+}
+
+func (c *Config) checkGRPCBackends(path string, backends []BackendConfig, problems *ValidationError) {
+	for i, backend := range backends {
+		if !backend.SpeaksHTTP2() {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			problems.add(itemPath, c.positionOf(itemPath),
+				"gRPC health checks need HTTP/2; set protocol to h2 or h2c for %s", backend.URL)
+		}
+	}
+}
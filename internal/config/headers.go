@@ -0,0 +1,60 @@
+package config
+
+import "fmt"
+
+// HeaderRules adds, sets and removes HTTP headers. Values may reference
+// per-request variables such as $remote_addr, $backend_url and $request_id.
+// Headers are removed first, then set, then added.
+type HeaderRules struct {
+	Add    map[string]string `yaml:"add,omitempty"`
+	Set    map[string]string `yaml:"set,omitempty"`
+	Remove []string          `yaml:"remove,omitempty"`
+}
+
+// HeaderVariables lists the variables available in header values.
+var HeaderVariables = []string{
+	"remote_addr", "host", "scheme", "request_uri", "request_id", "backend_url", "pool", "route",
+}
+
+func (c *Config) validateHeaderRules(path string, rules *HeaderRules, problems *ValidationError) {
+	if rules == nil {
+		return
+	}
+
+	for name := range rules.Add {
+		if !validHeaderName(name) {
+			problems.add(path+".add."+name, c.positionOf(path+".add."+name), "invalid header name %q", name)
+		}
+	}
+
+	for name := range rules.Set {
+		if !validHeaderName(name) {
+			problems.add(path+".set."+name, c.positionOf(path+".set."+name), "invalid header name %q", name)
+		}
+	}
+
+	for i, name := range rules.Remove {
+		if !validHeaderName(name) {
+			itemPath := fmt.Sprintf("%s.remove[%d]", path, i)
+			problems.add(itemPath, c.positionOf(itemPath), "invalid header name %q", name)
+		}
+	}
+}
+
+// validHeaderName reports whether name is a valid RFC 7230 token.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			continue
+		}
+		switch r {
+		case '!', '#', '$', '%', '&', '\'', '*', '+', '-', '.', '^', '_', '`', '|', '~':
+			continue
+		}
+		return false
+	}
+	return true
+}
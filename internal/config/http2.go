@@ -0,0 +1,111 @@
+package config
+
+import (
+	"net/url"
+	"time"
+)
+
+// Backend protocols, for a backend's protocol setting.
+const (
+	// ProtocolAuto negotiates HTTP/2 with ALPN for https:// backends and
+	// uses HTTP/1.1 for http:// ones.
+	ProtocolAuto  = "auto"
+	ProtocolHTTP1 = "http1"
+	// ProtocolH2 requires HTTP/2 over TLS.
+	ProtocolH2 = "h2"
+	// ProtocolH2C speaks cleartext HTTP/2 with prior knowledge.
+	ProtocolH2C = "h2c"
+)
+
+// HTTP2Config tunes HTTP/2 on the public listener.
+type HTTP2Config struct {
+	// MaxConcurrentStreams caps the streams a client may have open on one
+	// connection. Zero keeps Go's default of 100 or more.
+	MaxConcurrentStreams int `yaml:"max_concurrent_streams,omitempty"`
+	// PingInterval sends a ping on connections that have been quiet this
+	// long; PingTimeout closes them if the ping goes unanswered.
+	PingInterval time.Duration `yaml:"ping_interval,omitempty"`
+	PingTimeout  time.Duration `yaml:"ping_timeout,omitempty"`
+}
+
+// BackendHTTP2Config tunes the connections to a backend. With HTTP/2, many
+// requests share each connection, so max_connections bounds how far they
+// are spread.
+type BackendHTTP2Config struct {
+	// MaxConnections caps the connections to the backend. Requests wait for
+	// a free stream once the cap is reached. Zero means no limit.
+	MaxConnections int `yaml:"max_connections,omitempty"`
+	// MaxIdleConnections is how many idle connections are kept open.
+	MaxIdleConnections int           `yaml:"max_idle_connections,omitempty"`
+	PingInterval       time.Duration `yaml:"ping_interval,omitempty"`
+	PingTimeout        time.Duration `yaml:"ping_timeout,omitempty"`
+}
+
+func (c *Config) validateServerHTTP2(problems *ValidationError) {
+	if c.Server.H2C && c.Server.TLS != nil {
+		problems.add("server.h2c", c.positionOf("server.h2c"),
+			"h2c needs a plain HTTP listener; over TLS, HTTP/2 is offered with alpn")
+	}
+
+	conf := c.Server.HTTP2
+	if conf == nil {
+		return
+	}
+	if conf.MaxConcurrentStreams < 0 {
+		problems.add("server.http2.max_concurrent_streams", c.positionOf("server.http2.max_concurrent_streams"),
+			"max_concurrent_streams must not be negative, got %d", conf.MaxConcurrentStreams)
+	}
+	c.validatePing("server.http2", conf.PingInterval, conf.PingTimeout, problems)
+}
+
+func (c *Config) validateBackendHTTP2(path string, backend *BackendConfig, problems *ValidationError) {
+	scheme := ""
+	if u, err := url.Parse(backend.URL); err == nil {
+		scheme = u.Scheme
+	}
+
+	switch backend.Protocol {
+	case "":
+		backend.Protocol = ProtocolAuto
+	case ProtocolAuto, ProtocolHTTP1:
+	case ProtocolH2:
+		if scheme != "https" {
+			problems.add(path+".protocol", c.positionOf(path+".protocol"),
+				"protocol h2 needs an https:// backend URL; use h2c for cleartext HTTP/2")
+		}
+	case ProtocolH2C:
+		if scheme != "http" {
+			problems.add(path+".protocol", c.positionOf(path+".protocol"),
+				"protocol h2c needs an http:// backend URL; use h2 over TLS")
+		}
+	default:
+		problems.add(path+".protocol", c.positionOf(path+".protocol"),
+			"invalid protocol %q. Supported: [auto http1 h2 h2c]", backend.Protocol)
+	}
+
+	conf := backend.HTTP2
+	if conf == nil {
+		return
+	}
+	path += ".http2"
+	if conf.MaxConnections < 0 {
+		problems.add(path+".max_connections", c.positionOf(path+".max_connections"),
+			"max_connections must not be negative, got %d", conf.MaxConnections)
+	}
+	if conf.MaxIdleConnections < 0 {
+		problems.add(path+".max_idle_connections", c.positionOf(path+".max_idle_connections"),
+			"max_idle_connections must not be negative, got %d", conf.MaxIdleConnections)
+	}
+	c.validatePing(path, conf.PingInterval, conf.PingTimeout, problems)
+}
+
+func (c *Config) validatePing(path string, interval, timeout time.Duration, problems *ValidationError) {
+	if interval < 0 {
+		problems.add(path+".ping_interval", c.positionOf(path+".ping_interval"), "ping_interval must be positive, got %s", interval)
+	}
+	if timeout < 0 {
+		problems.add(path+".ping_timeout", c.positionOf(path+".ping_timeout"), "ping_timeout must be positive, got %s", timeout)
+	} else if timeout > 0 && interval == 0 {
+		problems.add(path+".ping_timeout", c.positionOf(path+".ping_timeout"), "ping_timeout needs ping_interval")
+	}
+}
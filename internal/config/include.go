@@ -0,0 +1,373 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DropInDir is the directory, relative to the root configuration file, whose
+// files are merged into the configuration after all includes.
+const DropInDir = "conf.d"
+
+var dropInPatterns = []string{"*.yaml", "*.yml", "*.json", "*.toml"}
+
+// sourceMap remembers which file every parsed node came from.
+type sourceMap struct {
+	root  string
+	files map[*yaml.Node]string
+}
+
+func newSourceMap(root string) *sourceMap {
+	return &sourceMap{root: root, files: make(map[*yaml.Node]string)}
+}
+
+func (sm *sourceMap) tag(node *yaml.Node, file string) {
+	if node == nil {
+		return
+	}
+	sm.files[node] = file
+	for _, child := range node.Content {
+		sm.tag(child, file)
+	}
+}
+
+// source returns the display name of the file node came from.
+func (sm *sourceMap) source(node *yaml.Node) string {
+	if file, ok := sm.files[node]; ok {
+		return file
+	}
+	return sm.root
+}
+
+// fileCount returns how many files contributed nodes.
+func (sm *sourceMap) fileCount() int {
+	files := make(map[string]bool)
+	for _, file := range sm.files {
+		files[file] = true
+	}
+	return len(files)
+}
+
+func (sm *sourceMap) position(node *yaml.Node) position {
+	file := sm.source(node)
+	if file == sm.root {
+		file = ""
+	}
+	return position{file: file, line: node.Line}
+}
+
+// documentSet resolves `include:` directives and drop-in files and merges
+// them into a single document. Mappings merge recursively, sequences such as
+// backends append, and scalars override earlier values. Two included files
+// setting the same scalar to different values is reported as a conflict.
+type documentSet struct {
+	baseDir  string
+	sources  *sourceMap
+	loading  map[string]bool
+	loaded   map[string]bool
+	setBy    map[string]*yaml.Node
+	problems *ValidationError
+}
+
+func newDocumentSet(rootFile string) *documentSet {
+	baseDir := "."
+	rootName := ""
+	if rootFile != "" {
+		baseDir = filepath.Dir(rootFile)
+		rootName = filepath.Base(rootFile)
+	}
+
+	return &documentSet{
+		baseDir:  baseDir,
+		sources:  newSourceMap(rootName),
+		loading:  make(map[string]bool),
+		loaded:   make(map[string]bool),
+		setBy:    make(map[string]*yaml.Node),
+		problems: &ValidationError{},
+	}
+}
+
+// resolve merges every file referenced from root into it. Drop-ins are only
+// read when root was loaded from a file.
+func (ds *documentSet) resolve(root *yaml.Node, rootFile string) (*yaml.Node, error) {
+	ds.sources.tag(root, ds.sources.root)
+	if rootFile != "" {
+		if absolute, err := filepath.Abs(rootFile); err == nil {
+			ds.loaded[absolute] = true
+		}
+	}
+
+	docs, err := ds.collect(root, rootFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if rootFile != "" {
+		dropIns, err := ds.dropInFiles()
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range dropIns {
+			included, err := ds.loadIncluded(file)
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, included...)
+		}
+	}
+
+	merged := documentMapping(docs[0])
+	for _, doc := range docs[1:] {
+		mapping := documentMapping(doc)
+		if mapping == nil {
+			continue
+		}
+		if merged == nil {
+			merged = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			root.Kind = yaml.DocumentNode
+			root.Content = []*yaml.Node{merged}
+		}
+		ds.merge(merged, mapping, "")
+	}
+
+	return root, nil
+}
+
+// collect returns doc followed by every document it includes, depth first.
+func (ds *documentSet) collect(doc *yaml.Node, filename string) ([]*yaml.Node, error) {
+	docs := []*yaml.Node{doc}
+
+	patterns, err := takeIncludes(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ds.displayName(filename), err)
+	}
+
+	dir := ds.baseDir
+	if filename != "" {
+		dir = filepath.Dir(filename)
+	}
+
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern '%s': %w", pattern, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return nil, fmt.Errorf("included file '%s' does not exist", pattern)
+		}
+		sort.Strings(matches)
+
+		for _, match := range matches {
+			included, err := ds.loadIncluded(match)
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, included...)
+		}
+	}
+
+	return docs, nil
+}
+
+func (ds *documentSet) loadIncluded(filename string) ([]*yaml.Node, error) {
+	absolute, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	if ds.loading[absolute] {
+		return nil, fmt.Errorf("include cycle detected at '%s'", ds.displayName(filename))
+	}
+	// A file matched more than once, say by an include and again as a
+	// drop-in, is only merged the first time.
+	if ds.loaded[absolute] {
+		return nil, nil
+	}
+	ds.loaded[absolute] = true
+	ds.loading[absolute] = true
+	defer delete(ds.loading, absolute)
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read included file '%s': %w", filename, err)
+	}
+
+	doc, err := parseDocument(data, FormatFromFilename(filename))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ds.displayName(filename), err)
+	}
+	ds.sources.tag(doc, ds.displayName(filename))
+
+	return ds.collect(doc, filename)
+}
+
+func (ds *documentSet) dropInFiles() ([]string, error) {
+	dir := filepath.Join(ds.baseDir, DropInDir)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, nil
+	}
+
+	var files []string
+	for _, pattern := range dropInPatterns {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (ds *documentSet) displayName(filename string) string {
+	if rel, err := filepath.Rel(ds.baseDir, filename); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return filename
+}
+
+func (ds *documentSet) merge(dst, src *yaml.Node, path string) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		keyPath := joinPath(path, key.Value)
+
+		index := mappingIndex(dst, key.Value)
+		if index < 0 {
+			dst.Content = append(dst.Content, key, value)
+			ds.recordLeaves(keyPath, value)
+			continue
+		}
+
+		existing := dst.Content[index+1]
+		switch {
+		case existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			ds.merge(existing, value, keyPath)
+		case existing.Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode:
+			if keyPath == "backends" {
+				ds.checkDuplicateBackends(existing, value)
+			}
+			existing.Content = append(existing.Content, value.Content...)
+		default:
+			if previous, ok := ds.setBy[keyPath]; ok && !sameValue(previous, value) {
+				ds.problems.add(keyPath, ds.sources.position(key),
+					"conflicts with value set in %s", ds.describe(previous))
+			}
+			dst.Content[index] = key
+			dst.Content[index+1] = value
+			ds.recordLeaves(keyPath, value)
+		}
+	}
+}
+
+// recordLeaves remembers which included file last set each scalar below
+// path, so a later file setting a different value can be reported.
+func (ds *documentSet) recordLeaves(path string, node *yaml.Node) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			ds.recordLeaves(joinPath(path, node.Content[i].Value), node.Content[i+1])
+		}
+	case yaml.ScalarNode:
+		ds.setBy[path] = node
+	}
+}
+
+func (ds *documentSet) checkDuplicateBackends(existing, added *yaml.Node) {
+	urls := make(map[string]*yaml.Node)
+	for _, item := range existing.Content {
+		if url := mappingValue(item, "url"); url != nil {
+			urls[url.Value] = url
+		}
+	}
+
+	for _, item := range added.Content {
+		url := mappingValue(item, "url")
+		if url == nil {
+			continue
+		}
+		if previous, ok := urls[url.Value]; ok {
+			ds.problems.add("backends", ds.sources.position(url),
+				"backend %s is already defined in %s", url.Value, ds.describe(previous))
+		}
+	}
+}
+
+func (ds *documentSet) describe(node *yaml.Node) string {
+	if node.Line == 0 {
+		return ds.sources.source(node)
+	}
+	return fmt.Sprintf("%s:%d", ds.sources.source(node), node.Line)
+}
+
+// takeIncludes removes the top-level include key from doc and returns the
+// patterns it listed.
+func takeIncludes(doc *yaml.Node) ([]string, error) {
+	mapping := documentMapping(doc)
+	if mapping == nil {
+		return nil, nil
+	}
+
+	index := mappingIndex(mapping, "include")
+	if index < 0 {
+		return nil, nil
+	}
+	value := mapping.Content[index+1]
+	mapping.Content = append(mapping.Content[:index], mapping.Content[index+2:]...)
+
+	var patterns []string
+	switch value.Kind {
+	case yaml.ScalarNode:
+		patterns = []string{value.Value}
+	case yaml.SequenceNode:
+		for _, item := range value.Content {
+			if item.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: include entries must be strings", item.Line)
+			}
+			patterns = append(patterns, item.Value)
+		}
+	default:
+		return nil, fmt.Errorf("line %d: include must be a string or a list of strings", value.Line)
+	}
+	return patterns, nil
+}
+
+func documentMapping(doc *yaml.Node) *yaml.Node {
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		doc = doc.Content[0]
+	}
+	if doc.Kind != yaml.MappingNode {
+		return nil
+	}
+	return doc
+}
+
+func mappingIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	if index := mappingIndex(mapping, key); index >= 0 {
+		return mapping.Content[index+1]
+	}
+	return nil
+}
+
+func sameValue(a, b *yaml.Node) bool {
+	return a.Kind == b.Kind && a.Kind == yaml.ScalarNode && a.Value == b.Value
+}
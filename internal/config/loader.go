@@ -1,27 +1,59 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"reflect"
 	"strconv"
 
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
+// LoadOptions controls how configuration files are parsed.
+type LoadOptions struct {
+	// Strict rejects unknown keys and invalid values instead of ignoring
+	// or silently replacing them.
+	Strict bool
+
+	// Format selects the parser: "yaml", "json" or "toml". When empty,
+	// LoadFromFile picks it from the file extension and LoadFromBytes
+	// assumes YAML.
+	Format string
+}
+
+func DefaultLoadOptions() LoadOptions {
+	return LoadOptions{Strict: true}
+}
+
 func LoadFromBytes(data []byte) (*Config, error) {
-	config := DefaultConfig()
-	if err := yaml.Unmarshal(data, config); err != nil {
-		return nil, fmt.Errorf("failed to parse YAML configuration: %w", err)
+	return LoadFromBytesWithOptions(data, DefaultLoadOptions())
+}
+
+// LoadFromBytesWithOptions parses a configuration document. Include patterns
+// in the document are resolved relative to the working directory.
+func LoadFromBytesWithOptions(data []byte, opts LoadOptions) (*Config, error) {
+	root, err := parseDocument(data, opts.Format)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := config.Validate(); err != nil {
-		return nil, fmt.Errorf("configuration validation failed: %w", err)
+	docs := newDocumentSet("")
+	root, err = docs.resolve(root, "")
+	if err != nil {
+		return nil, err
 	}
 
-	return config, nil
+	return decodeDocument(root, docs, opts)
 }
 
 func LoadFromFile(filename string) (*Config, error) {
+	return LoadFromFileWithOptions(filename, DefaultLoadOptions())
+}
+
+// LoadFromFileWithOptions loads filename together with the files it includes
+// and the drop-ins found in the conf.d directory next to it.
+func LoadFromFileWithOptions(filename string, opts LoadOptions) (*Config, error) {
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
 		return nil, fmt.Errorf("configuration file '%s' does not exist", filename)
 	}
@@ -31,11 +63,84 @@ func LoadFromFile(filename string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read configuration file '%s': %w", filename, err)
 	}
 
-	config, err := LoadFromBytes(data)
+	if opts.Format == "" {
+		opts.Format = FormatFromFilename(filename)
+	}
+
+	root, err := parseDocument(data, opts.Format)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse configuration file '%s': %w", filename, err)
 	}
 
+	docs := newDocumentSet(filename)
+	root, err = docs.resolve(root, filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration file '%s': %w", filename, err)
+	}
+
+	config, err := decodeDocument(root, docs, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse configuration file '%s': %w", filename, err)
+	}
+	config.filename = filename
+	config.format = opts.Format
+
+	return config, nil
+}
+
+// Reload reads the configuration again from the file it was loaded from,
+// using the same options.
+func (c *Config) Reload() (*Config, error) {
+	if c.filename == "" {
+		return nil, errors.New("configuration was not loaded from a file")
+	}
+	return LoadFromFileWithOptions(c.filename, LoadOptions{Strict: !c.lenient, Format: c.format})
+}
+
+func decodeDocument(root *yaml.Node, docs *documentSet, opts LoadOptions) (*Config, error) {
+	config := DefaultConfig()
+	config.lenient = !opts.Strict
+
+	if root.Kind != 0 {
+		if err := root.Decode(config); err != nil {
+			return nil, fmt.Errorf("failed to parse configuration: %w", err)
+		}
+	}
+
+	index := newNodeIndex(docs.sources)
+	index.walk(root, reflect.TypeOf(config), "")
+	config.positions = index.positions
+	config.sourceFiles = docs.sources.fileCount()
+
+	// The built-in default backend only applies to configurations that do
+	// not define their own pools.
+	if _, ok := index.positions["backends"]; !ok && len(config.Pools) > 0 {
+		config.Backends = nil
+	}
+
+	assignSources(config.Backends, "backends", index, docs.sources.root)
+	for i := range config.Pools {
+		assignSources(config.Pools[i].Backends, fmt.Sprintf("pools[%d].backends", i), index, docs.sources.root)
+	}
+
+	problems := docs.problems
+	if opts.Strict {
+		problems.Errors = append(problems.Errors, index.unknown...)
+	}
+
+	if err := config.Validate(); err != nil {
+		if verr, ok := err.(*ValidationError); ok {
+			problems.Errors = append(problems.Errors, verr.Errors...)
+		} else {
+			problems.add("", position{}, "%v", err)
+		}
+	}
+
+	problems.sort()
+	if err := problems.errOrNil(); err != nil {
+		return nil, fmt.Errorf("configuration validation failed: %w", err)
+	}
+
 	return config, nil
 }
 
@@ -60,3 +165,12 @@ func LoadFromEnv(baseConfig *Config) (*Config, error) {
 
 	return &config, nil
 }
+
+func assignSources(backends []BackendConfig, path string, index *nodeIndex, root string) {
+	for i := range backends {
+		backends[i].Source = root
+		if pos, ok := index.positions[fmt.Sprintf("%s[%d]", path, i)]; ok && pos.file != "" {
+			backends[i].Source = pos.file
+		}
+	}
+}
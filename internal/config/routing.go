@@ -0,0 +1,213 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// DefaultPoolName is the name of the pool built from the top-level backends,
+// strategy and health_check settings.
+const DefaultPoolName = "default"
+
+// PoolConfig is a named group of backends with its own strategy and health
+// check. Unset fields are inherited from the top-level settings.
+type PoolConfig struct {
+	Name        string             `yaml:"name"`
+	Backends    []BackendConfig    `yaml:"backends"`
+	Strategy    string             `yaml:"strategy,omitempty"`
+	HealthCheck *HealthCheckConfig `yaml:"health_check,omitempty"`
+}
+
+// RouteMatch lists the conditions a request must meet for a route to apply.
+// Empty conditions match every request.
+type RouteMatch struct {
+	// Host matches the Host header without port, either exactly or as a
+	// "*.example.com" wildcard.
+	Host       string   `yaml:"host,omitempty"`
+	PathPrefix string   `yaml:"path_prefix,omitempty"`
+	PathRegex  string   `yaml:"path_regex,omitempty"`
+	Methods    []string `yaml:"methods,omitempty"`
+	// Headers maps header names to required values; an empty value only
+	// requires the header to be present.
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// RewriteConfig replaces the part of the path matching Pattern with
+// Replacement, which may reference capture groups as $1 or ${name}.
+type RewriteConfig struct {
+	Pattern     string `yaml:"pattern"`
+	Replacement string `yaml:"replacement"`
+}
+
+// RouteConfig sends requests matching Match to Pool. Routes are evaluated in
+// order and the first match wins. The upstream path is rewritten by removing
+// StripPrefix, applying Rewrite and then prepending AddPrefix.
+type RouteConfig struct {
+	Name        string         `yaml:"name,omitempty"`
+	Match       RouteMatch     `yaml:"match"`
+	Pool        string         `yaml:"pool"`
+	StripPrefix string         `yaml:"strip_prefix,omitempty"`
+	AddPrefix   string         `yaml:"add_prefix,omitempty"`
+	Rewrite     *RewriteConfig `yaml:"rewrite,omitempty"`
+
+	RequestHeaders  *HeaderRules `yaml:"request_headers,omitempty"`
+	ResponseHeaders *HeaderRules `yaml:"response_headers,omitempty"`
+
+	// ClientCert overrides server.tls.client_auth.policy for this route.
+	ClientCert string `yaml:"client_cert,omitempty"`
+}
+
+// EffectivePools returns every configured pool with inherited settings
+// resolved, starting with the default pool when top-level backends are set.
+func (c *Config) EffectivePools() []PoolConfig {
+	pools := make([]PoolConfig, 0, len(c.Pools)+1)
+
+	if len(c.Backends) > 0 {
+		healthCheck := c.HealthCheck
+		pools = append(pools, PoolConfig{
+			Name:        DefaultPoolName,
+			Backends:    c.Backends,
+			Strategy:    c.Strategy,
+			HealthCheck: &healthCheck,
+		})
+	}
+
+	for _, pool := range c.Pools {
+		if pool.Strategy == "" {
+			pool.Strategy = c.Strategy
+		}
+		if pool.HealthCheck == nil {
+			healthCheck := c.HealthCheck
+			pool.HealthCheck = &healthCheck
+		}
+		pools = append(pools, pool)
+	}
+
+	return pools
+}
+
+// DefaultPoolFor returns the pool used when no route matches, or "" when such
+// requests should be rejected.
+func (c *Config) DefaultPoolFor() string {
+	if c.DefaultPool != "" {
+		return c.DefaultPool
+	}
+	if len(c.Backends) > 0 {
+		return DefaultPoolName
+	}
+	return ""
+}
+
+func (c *Config) validatePools(problems *ValidationError) {
+	names := make(map[string]bool)
+	if len(c.Backends) > 0 {
+		names[DefaultPoolName] = true
+	}
+
+	for i := range c.Pools {
+		pool := &c.Pools[i]
+		path := fmt.Sprintf("pools[%d]", i)
+
+		if pool.Name == "" {
+			problems.add(path+".name", c.positionOf(path+".name"), "pool name cannot be empty")
+		} else if names[pool.Name] {
+			problems.add(path+".name", c.positionOf(path+".name"), "duplicate pool name %q", pool.Name)
+		}
+		names[pool.Name] = true
+
+		if len(pool.Backends) == 0 {
+			problems.add(path+".backends", c.positionOf(path+".backends"), "pool %q must have at least one backend", pool.Name)
+		}
+		c.validateBackends(path+".backends", pool.Backends, problems)
+
+		if pool.Strategy != "" {
+			c.validateStrategy(path+".strategy", pool.Strategy, problems)
+		}
+		if pool.HealthCheck != nil {
+			c.validateHealthCheck(path+".health_check", pool.HealthCheck, problems)
+		}
+	}
+
+	if c.DefaultPool != "" && !names[c.DefaultPool] {
+		problems.add("default_pool", c.positionOf("default_pool"), "unknown pool %q", c.DefaultPool)
+	}
+}
+
+func (c *Config) validateRoutes(problems *ValidationError) {
+	pools := make(map[string]bool)
+	for _, pool := range c.EffectivePools() {
+		pools[pool.Name] = true
+	}
+
+	for i := range c.Routes {
+		route := &c.Routes[i]
+		path := fmt.Sprintf("routes[%d]", i)
+
+		if route.Pool == "" {
+			problems.add(path+".pool", c.positionOf(path+".pool"), "route must name a pool")
+		} else if !pools[route.Pool] {
+			problems.add(path+".pool", c.positionOf(path+".pool"), "unknown pool %q", route.Pool)
+		}
+
+		if route.Match.PathPrefix != "" && !strings.HasPrefix(route.Match.PathPrefix, "/") {
+			problems.add(path+".match.path_prefix", c.positionOf(path+".match.path_prefix"),
+				"path_prefix must start with '/', got %q", route.Match.PathPrefix)
+		}
+
+		if route.Match.PathRegex != "" {
+			if _, err := regexp.Compile(route.Match.PathRegex); err != nil {
+				problems.add(path+".match.path_regex", c.positionOf(path+".match.path_regex"), "invalid regex: %v", err)
+			}
+		}
+
+		if route.StripPrefix != "" && !strings.HasPrefix(route.StripPrefix, "/") {
+			problems.add(path+".strip_prefix", c.positionOf(path+".strip_prefix"),
+				"strip_prefix must start with '/', got %q", route.StripPrefix)
+		}
+
+		if route.AddPrefix != "" && !strings.HasPrefix(route.AddPrefix, "/") {
+			problems.add(path+".add_prefix", c.positionOf(path+".add_prefix"),
+				"add_prefix must start with '/', got %q", route.AddPrefix)
+		}
+
+		if route.Rewrite != nil {
+			if route.Rewrite.Pattern == "" {
+				problems.add(path+".rewrite.pattern", c.positionOf(path+".rewrite.pattern"), "rewrite pattern cannot be empty")
+			} else if _, err := regexp.Compile(route.Rewrite.Pattern); err != nil {
+				problems.add(path+".rewrite.pattern", c.positionOf(path+".rewrite.pattern"), "invalid regex: %v", err)
+			}
+		}
+
+		c.validateHeaderRules(path+".request_headers", route.RequestHeaders, problems)
+		c.validateHeaderRules(path+".response_headers", route.ResponseHeaders, problems)
+
+		if route.ClientCert != "" {
+			if !validClientCertPolicy(route.ClientCert) {
+				problems.add(path+".client_cert", c.positionOf(path+".client_cert"),
+					"invalid client certificate policy %q. Supported: [required optional none]", route.ClientCert)
+			} else if c.Server.TLS == nil || c.Server.TLS.ClientAuth == nil {
+				problems.add(path+".client_cert", c.positionOf(path+".client_cert"), "client_cert needs server.tls.client_auth")
+			}
+		}
+
+		for j, method := range route.Match.Methods {
+			method = strings.ToUpper(method)
+			route.Match.Methods[j] = method
+			if !isHTTPMethod(method) {
+				methodPath := fmt.Sprintf("%s.match.methods[%d]", path, j)
+				problems.add(methodPath, c.positionOf(methodPath), "unknown HTTP method %q", method)
+			}
+		}
+	}
+}
+
+func isHTTPMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
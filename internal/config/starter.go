@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+// StarterConfig is the commented configuration written by `bolt init`.
+const StarterConfig = `# Bolt load balancer configuration.
+# Validate changes with: bolt validate -c config.yaml
+
+server:
+  # Address the load balancer listens on.
+  port: 8100
+  host: "0.0.0.0"
+  read_timeout: "30s"
+  write_timeout: "30s"
+  idle_timeout: "60s"
+  # Terminate TLS on this listener. Certificates are picked by SNI and
+  # reloaded when their files change.
+  # tls:
+  #   cert_file: "/etc/bolt/tls/example.com.crt"
+  #   key_file: "/etc/bolt/tls/example.com.key"
+  #   certificates:
+  #     - cert_file: "/etc/bolt/tls/example.org.crt"
+  #       key_file: "/etc/bolt/tls/example.org.key"
+  #   min_version: "1.2"
+  #   alpn: ["h2", "http/1.1"]
+  #   # Or obtain certificates automatically from Let's Encrypt.
+  #   acme:
+  #     domains: ["example.com"]
+  #     email: "ops@example.com"
+  #     cache_dir: "/var/lib/bolt/acme"
+  #   # Verify client certificates; routes may override the policy.
+  #   client_auth:
+  #     ca_file: "/etc/bolt/tls/clients-ca.pem"
+  #     policy: "required"
+  # Redirect plain HTTP to HTTPS, except for ACME challenges.
+  # http_redirect:
+  #   port: 80
+  #   status_code: 301
+  # hsts:
+  #   max_age: "8760h"
+  # Accept cleartext HTTP/2 (h2c) from internal clients without TLS.
+  # h2c: true
+
+# Backend servers that receive the traffic.
+backends:
+  - url: "http://localhost:8081"
+    # Relative share of traffic for weighted strategies.
+    weight: 1
+    # Consecutive failures before the backend is taken out of rotation...
+    max_fails: 3
+    # ...and how long it stays out before being retried.
+    fail_timeout: "30s"
+    # HTTP version spoken to the backend: auto, http1, h2 or h2c.
+    # protocol: "auto"
+  - url: "http://localhost:8082"
+    weight: 1
+    max_fails: 3
+    fail_timeout: "30s"
+
+# Load balancing strategy. Supported: round_robin
+strategy: "round_robin"
+
+health_check:
+  enabled: true
+  interval: "30s"
+  timeout: "5s"
+  # Path probed on every backend and the status code that counts as healthy.
+  path: "/health"
+  expected_status: 200
+  # Or use the standard gRPC health service on h2/h2c backends.
+  # type: "grpc"
+  # grpc_service: ""
+
+logging:
+  # One of: debug, info, warn, error
+  level: "info"
+  # One of: text, json
+  format: "text"
+  access_log: true
+
+# Tag every request with an ID that is forwarded to backends, returned to the
+# client and added to every log line. An incoming ID in the header is reused.
+request_id:
+  enabled: true
+  header: "X-Request-ID"
+  # One of: uuidv7, ulid
+  format: "uuidv7"
+
+# Health, status, metrics and control endpoints are served on a separate
+# admin listener, optionally also on a unix socket.
+admin:
+  enabled: true
+  host: "127.0.0.1"
+  port: 8190
+  # Web dashboard at http://127.0.0.1:8190/dashboard/
+  dashboard: true
+  # socket: "/run/bolt/admin.sock"
+  # Required when the admin listener is reachable from other machines.
+  # Token entries look like "read-only:<token>" or "read-write:<token>".
+  # auth:
+  #   tokens_file: "/etc/bolt/admin-tokens"
+
+# Uncomment to also answer these paths on the public listener instead of
+# proxying them to the backends.
+# public_endpoints:
+#   health: "/health"
+
+# Prometheus metrics in the text exposition format, served on the admin
+# listener.
+metrics:
+  enabled: true
+  path: "/metrics"
+
+# Distributed tracing with W3C traceparent propagation. Spans are exported
+# to an OTLP/HTTP collector.
+tracing:
+  enabled: false
+  endpoint: "http://localhost:4318/v1/traces"
+  service_name: "bolt"
+  # Fraction of new traces recorded, between 0 and 1.
+  sample_ratio: 1.0
+  flush_interval: "5s"
+`
+
+// WriteStarterConfig writes StarterConfig to filename, refusing to replace an
+// existing file unless overwrite is set.
+func WriteStarterConfig(filename string, overwrite bool) error {
+	if !overwrite {
+		if _, err := os.Stat(filename); err == nil {
+			return fmt.Errorf("configuration file '%s' already exists", filename)
+		}
+	}
+
+	if err := os.WriteFile(filename, []byte(StarterConfig), 0644); err != nil {
+		return fmt.Errorf("failed to write configuration file '%s': %w", filename, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// nodeIndex records where every key of a parsed document lives and which keys
+// do not correspond to any configuration field.
+type nodeIndex struct {
+	positions map[string]position
+	unknown   []FieldError
+	sources   *sourceMap
+}
+
+func newNodeIndex(sources *sourceMap) *nodeIndex {
+	return &nodeIndex{
+		positions: make(map[string]position),
+		sources:   sources,
+	}
+}
+
+func (ni *nodeIndex) walk(node *yaml.Node, t reflect.Type, path string) {
+	if node == nil {
+		return
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			ni.walk(child, t, path)
+		}
+	case yaml.MappingNode:
+		ni.walkMapping(node, t, path)
+	case yaml.SequenceNode:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return
+		}
+		for i, item := range node.Content {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			ni.positions[itemPath] = ni.sources.position(item)
+			ni.walk(item, t.Elem(), itemPath)
+		}
+	}
+}
+
+func (ni *nodeIndex) walkMapping(node *yaml.Node, t reflect.Type, path string) {
+	var fields map[string]reflect.Type
+	switch t.Kind() {
+	case reflect.Struct:
+		fields = yamlFields(t)
+	case reflect.Map:
+	default:
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		keyPath := joinPath(path, key.Value)
+		pos := ni.sources.position(key)
+		ni.positions[keyPath] = pos
+
+		if t.Kind() == reflect.Map {
+			ni.walk(value, t.Elem(), keyPath)
+			continue
+		}
+
+		fieldType, ok := fields[key.Value]
+		if !ok && key.Value == sourceKey && t == reflect.TypeOf(BackendConfig{}) {
+			// Written by print-config; the source is worked out on load.
+			continue
+		}
+		if !ok {
+			ni.unknown = append(ni.unknown, FieldError{
+				File:    pos.file,
+				Path:    keyPath,
+				Line:    pos.line,
+				Message: fmt.Sprintf("unknown field %q", key.Value),
+			})
+			continue
+		}
+		ni.walk(value, fieldType, keyPath)
+	}
+}
+
+// yamlFields maps the YAML key of every exported field of t to its type,
+// following inline structs the same way the decoder does.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		tag := field.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if strings.Contains(opts, "inline") {
+			for k, v := range yamlFields(field.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+func joinPath(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
@@ -0,0 +1,450 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultCertReloadInterval is how often certificate files are checked for
+// changes when server.tls.reload_interval is not set.
+const DefaultCertReloadInterval = 30 * time.Second
+
+// TLSVersions maps the accepted server.tls.min_version values to their
+// crypto/tls constants.
+var TLSVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ServerTLSConfig serves the public listener over HTTPS.
+type ServerTLSConfig struct {
+	CertFile string `yaml:"cert_file,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty"`
+	// Certificates are additional certificates chosen by SNI. A client gets
+	// the first certificate, starting with cert_file, that is valid for the
+	// server name it asked for, or the first one if none is.
+	Certificates []CertificateConfig `yaml:"certificates,omitempty"`
+
+	// MinVersion is "1.2" or "1.3".
+	MinVersion string `yaml:"min_version"`
+	// CipherSuites restricts the TLS 1.2 cipher suites, by their names in
+	// crypto/tls such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. TLS 1.3
+	// suites are not configurable.
+	CipherSuites []string `yaml:"cipher_suites,omitempty"`
+	// ALPN lists the application protocols offered, most preferred first.
+	ALPN []string `yaml:"alpn,omitempty"`
+	// ReloadInterval is how often certificate files are checked for
+	// changes. Certificates are also reloaded on SIGHUP.
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+
+	// ACME obtains and renews a certificate automatically.
+	ACME *ACMEConfig `yaml:"acme,omitempty"`
+
+	// ClientAuth verifies client certificates.
+	ClientAuth *ClientAuthConfig `yaml:"client_auth,omitempty"`
+}
+
+// Client certificate policies, for server.tls.client_auth.policy and a
+// route's client_cert.
+const (
+	ClientCertRequired = "required"
+	ClientCertOptional = "optional"
+	ClientCertNone     = "none"
+)
+
+// ClientAuthConfig verifies client certificates against a CA pool. A
+// certificate that fails verification ends the handshake; whether one is
+// needed at all is decided per route once the request is read.
+type ClientAuthConfig struct {
+	CAFile string `yaml:"ca_file"`
+	// Policy applies to routes without their own client_cert setting.
+	Policy string `yaml:"policy"`
+	// Headers name the upstream request headers that carry details of the
+	// verified certificate. Incoming headers of the same names are always
+	// removed.
+	Headers ClientCertHeaders `yaml:"headers,omitempty"`
+}
+
+type ClientCertHeaders struct {
+	Subject     string `yaml:"subject,omitempty"`
+	SAN         string `yaml:"san,omitempty"`
+	Fingerprint string `yaml:"fingerprint,omitempty"`
+}
+
+// Names returns the configured header names.
+func (h ClientCertHeaders) Names() []string {
+	var names []string
+	for _, name := range []string{h.Subject, h.SAN, h.Fingerprint} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func validClientCertPolicy(policy string) bool {
+	return policy == ClientCertRequired || policy == ClientCertOptional || policy == ClientCertNone
+}
+
+type CertificateConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// AllCertificates returns cert_file followed by certificates.
+func (t *ServerTLSConfig) AllCertificates() []CertificateConfig {
+	var certs []CertificateConfig
+	if t.CertFile != "" || t.KeyFile != "" {
+		certs = append(certs, CertificateConfig{CertFile: t.CertFile, KeyFile: t.KeyFile})
+	}
+	return append(certs, t.Certificates...)
+}
+
+// CipherSuiteIDs returns the crypto/tls IDs of CipherSuites, or nil to use
+// Go's defaults. Names must have been validated.
+func (t *ServerTLSConfig) CipherSuiteIDs() []uint16 {
+	if len(t.CipherSuites) == 0 {
+		return nil
+	}
+	ids := make([]uint16, 0, len(t.CipherSuites))
+	for _, name := range t.CipherSuites {
+		if id, ok := cipherSuiteID(name); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
+
+// http2CipherSuites are the suites HTTP/2 requires when the list is
+// restricted (RFC 7540, section 9.2.2).
+var http2CipherSuites = []string{
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+}
+
+func (c *Config) validateServerTLS(problems *ValidationError) {
+	conf := c.Server.TLS
+	if conf == nil {
+		return
+	}
+
+	if len(conf.AllCertificates()) == 0 && conf.ACME == nil {
+		problems.add("server.tls", c.positionOf("server.tls"), "server TLS needs cert_file and key_file, certificates or acme")
+	} else if (conf.CertFile == "") != (conf.KeyFile == "") {
+		problems.add("server.tls", c.positionOf("server.tls"), "server TLS needs both cert_file and key_file")
+	}
+	for i, cert := range conf.Certificates {
+		if cert.CertFile == "" || cert.KeyFile == "" {
+			path := fmt.Sprintf("server.tls.certificates[%d]", i)
+			problems.add(path, c.positionOf(path), "certificate needs both cert_file and key_file")
+		}
+	}
+
+	if conf.MinVersion == "" {
+		conf.MinVersion = "1.2"
+	} else if _, ok := TLSVersions[conf.MinVersion]; !ok {
+		problems.add("server.tls.min_version", c.positionOf("server.tls.min_version"),
+			"invalid TLS version %q. Supported versions: [1.2 1.3]", conf.MinVersion)
+	}
+
+	for i, name := range conf.CipherSuites {
+		if _, ok := cipherSuiteID(name); !ok {
+			path := fmt.Sprintf("server.tls.cipher_suites[%d]", i)
+			problems.add(path, c.positionOf(path), "unknown or insecure cipher suite %q", name)
+		}
+	}
+
+	if len(conf.ALPN) == 0 {
+		conf.ALPN = []string{"h2", "http/1.1"}
+	}
+	for i, proto := range conf.ALPN {
+		if proto == "" {
+			path := fmt.Sprintf("server.tls.alpn[%d]", i)
+			problems.add(path, c.positionOf(path), "ALPN protocol names must not be empty")
+		}
+	}
+	if slices.Contains(conf.ALPN, "h2") && len(conf.CipherSuites) > 0 &&
+		!slices.ContainsFunc(http2CipherSuites, func(name string) bool { return slices.Contains(conf.CipherSuites, name) }) {
+		problems.add("server.tls.cipher_suites", c.positionOf("server.tls.cipher_suites"),
+			"HTTP/2 (h2 in alpn) requires %s or %s", http2CipherSuites[0], http2CipherSuites[1])
+	}
+
+	if conf.ReloadInterval < 0 && !c.lenient {
+		problems.add("server.tls.reload_interval", c.positionOf("server.tls.reload_interval"),
+			"reload_interval must be positive, got %s", conf.ReloadInterval)
+	} else if conf.ReloadInterval <= 0 {
+		conf.ReloadInterval = DefaultCertReloadInterval
+	}
+
+	c.validateACME(problems)
+	c.validateClientAuth(problems)
+}
+
+func (c *Config) validateClientAuth(problems *ValidationError) {
+	conf := c.Server.TLS.ClientAuth
+	if conf == nil {
+		return
+	}
+
+	if conf.CAFile == "" {
+		problems.add("server.tls.client_auth.ca_file", c.positionOf("server.tls.client_auth.ca_file"),
+			"client_auth needs a ca_file to verify client certificates")
+	}
+	if conf.Policy == "" {
+		conf.Policy = ClientCertRequired
+	} else if !validClientCertPolicy(conf.Policy) {
+		problems.add("server.tls.client_auth.policy", c.positionOf("server.tls.client_auth.policy"),
+			"invalid client certificate policy %q. Supported: [required optional none]", conf.Policy)
+	}
+
+	for field, name := range map[string]string{"subject": conf.Headers.Subject, "san": conf.Headers.SAN, "fingerprint": conf.Headers.Fingerprint} {
+		if name != "" && !validHeaderName(name) {
+			path := "server.tls.client_auth.headers." + field
+			problems.add(path, c.positionOf(path), "invalid header name %q", name)
+		}
+	}
+}
+
+// BackendTLSConfig controls how bolt connects to an https:// backend.
+type BackendTLSConfig struct {
+	// CAFile is a PEM bundle used instead of the system roots to verify the
+	// backend's certificate.
+	CAFile string `yaml:"ca_file,omitempty"`
+	// CertFile and KeyFile are presented to backends that require client
+	// certificates.
+	CertFile string `yaml:"cert_file,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty"`
+	// ServerName is sent as SNI and verified against the backend's
+	// certificate instead of the URL's host.
+	ServerName string `yaml:"server_name,omitempty"`
+	// InsecureSkipVerify accepts any backend certificate. Only meant for
+	// development.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify,omitempty"`
+}
+
+func (c *Config) validateBackendTLS(path string, backend BackendConfig, problems *ValidationError) {
+	conf := backend.TLS
+	if conf == nil {
+		return
+	}
+	path += ".tls"
+
+	if u, err := url.Parse(backend.URL); err == nil && u.Scheme != "https" {
+		problems.add(path, c.positionOf(path), "tls settings need an https:// backend URL, got %s", backend.URL)
+	}
+	if (conf.CertFile == "") != (conf.KeyFile == "") {
+		problems.add(path, c.positionOf(path), "client certificate needs both cert_file and key_file")
+	}
+}
+
+// ACME defaults.
+const (
+	// DefaultACMEDirectory is Let's Encrypt's production directory.
+	DefaultACMEDirectory   = "https://acme-v02.api.letsencrypt.org/directory"
+	DefaultACMERenewBefore = 30 * 24 * time.Hour
+)
+
+// ACME challenge types.
+const (
+	ChallengeHTTP01    = "http-01"
+	ChallengeTLSALPN01 = "tls-alpn-01"
+)
+
+// ACMEConfig obtains a certificate for Domains from an ACME CA and renews
+// it before it expires. Configuring it accepts the CA's terms of service.
+type ACMEConfig struct {
+	Domains []string `yaml:"domains"`
+	// Email is registered with the account so the CA can send expiry
+	// notices.
+	Email        string `yaml:"email,omitempty"`
+	DirectoryURL string `yaml:"directory_url"`
+	// DirectoryCAFile is trusted for the directory connection in addition
+	// to the system roots, for test CAs such as Pebble.
+	DirectoryCAFile string `yaml:"directory_ca_file,omitempty"`
+	// Challenges are tried in order. http-01 is answered on the
+	// http_redirect listener, tls-alpn-01 on the HTTPS listener.
+	Challenges []string `yaml:"challenges"`
+	// CacheDir stores the account key and certificates across restarts.
+	CacheDir    string        `yaml:"cache_dir"`
+	RenewBefore time.Duration `yaml:"renew_before"`
+}
+
+// DefaultHSTSMaxAge is the Strict-Transport-Security max-age used when
+// server.hsts.max_age is not set.
+const DefaultHSTSMaxAge = 365 * 24 * time.Hour
+
+// HTTPRedirectConfig runs a plain HTTP listener next to the HTTPS one that
+// sends clients to the same host and path over HTTPS.
+type HTTPRedirectConfig struct {
+	Port int `yaml:"port"`
+	// HTTPSPort is the port put in the redirect, when clients reach the
+	// HTTPS listener on a different port than server.port. 443 is omitted.
+	HTTPSPort int `yaml:"https_port,omitempty"`
+	// StatusCode is 301 or 308. 308 keeps the request method and body.
+	StatusCode int `yaml:"status_code"`
+	// ExemptPaths are path prefixes proxied over plain HTTP instead of being
+	// redirected.
+	ExemptPaths []string `yaml:"exempt_paths"`
+}
+
+type HSTSConfig struct {
+	MaxAge            time.Duration `yaml:"max_age"`
+	IncludeSubdomains bool          `yaml:"include_subdomains,omitempty"`
+	Preload           bool          `yaml:"preload,omitempty"`
+}
+
+// HeaderValue returns the Strict-Transport-Security header value.
+func (h *HSTSConfig) HeaderValue() string {
+	value := fmt.Sprintf("max-age=%d", int64(h.MaxAge.Seconds()))
+	if h.IncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if h.Preload {
+		value += "; preload"
+	}
+	return value
+}
+
+func (c *Config) validateHTTPRedirect(problems *ValidationError) {
+	conf := c.Server.HTTPRedirect
+	if conf == nil {
+		return
+	}
+	if c.Server.TLS == nil {
+		problems.add("server.http_redirect", c.positionOf("server.http_redirect"), "http_redirect requires server.tls")
+	}
+
+	if conf.Port == 0 {
+		conf.Port = 80
+	} else if conf.Port < 1 || conf.Port > 65535 {
+		problems.add("server.http_redirect.port", c.positionOf("server.http_redirect.port"),
+			"invalid port %d. Must be between 1 and 65535", conf.Port)
+	}
+	if conf.Port == c.Server.Port {
+		problems.add("server.http_redirect.port", c.positionOf("server.http_redirect.port"),
+			"http_redirect port %d is already used by the server", conf.Port)
+	}
+
+	if conf.HTTPSPort == 0 {
+		conf.HTTPSPort = c.Server.Port
+	} else if conf.HTTPSPort < 1 || conf.HTTPSPort > 65535 {
+		problems.add("server.http_redirect.https_port", c.positionOf("server.http_redirect.https_port"),
+			"invalid port %d. Must be between 1 and 65535", conf.HTTPSPort)
+	}
+
+	switch conf.StatusCode {
+	case 0:
+		conf.StatusCode = http.StatusMovedPermanently
+	case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+	default:
+		problems.add("server.http_redirect.status_code", c.positionOf("server.http_redirect.status_code"),
+			"invalid redirect status %d, expected 301 or 308", conf.StatusCode)
+	}
+
+	if conf.ExemptPaths == nil {
+		conf.ExemptPaths = []string{"/.well-known/acme-challenge/"}
+	}
+	for i, prefix := range conf.ExemptPaths {
+		if !strings.HasPrefix(prefix, "/") {
+			path := fmt.Sprintf("server.http_redirect.exempt_paths[%d]", i)
+			problems.add(path, c.positionOf(path), "exempt path %q must start with /", prefix)
+		}
+	}
+}
+
+func (c *Config) validateHSTS(problems *ValidationError) {
+	conf := c.Server.HSTS
+	if conf == nil {
+		return
+	}
+	if c.Server.TLS == nil {
+		problems.add("server.hsts", c.positionOf("server.hsts"), "hsts requires server.tls")
+	}
+
+	if conf.MaxAge < 0 && !c.lenient {
+		problems.add("server.hsts.max_age", c.positionOf("server.hsts.max_age"),
+			"max_age must be positive, got %s", conf.MaxAge)
+	} else if conf.MaxAge <= 0 {
+		conf.MaxAge = DefaultHSTSMaxAge
+	}
+
+	// Browsers only accept preload entries that cover subdomains for at
+	// least a year.
+	if conf.Preload && (!conf.IncludeSubdomains || conf.MaxAge < DefaultHSTSMaxAge) {
+		problems.add("server.hsts.preload", c.positionOf("server.hsts.preload"),
+			"preload requires include_subdomains and a max_age of at least %s", DefaultHSTSMaxAge)
+	}
+}
+
+func (c *Config) validateACME(problems *ValidationError) {
+	conf := c.Server.TLS.ACME
+	if conf == nil {
+		return
+	}
+
+	if len(conf.Domains) == 0 {
+		problems.add("server.tls.acme.domains", c.positionOf("server.tls.acme.domains"), "acme needs at least one domain")
+	}
+	for i, domain := range conf.Domains {
+		// Wildcards can only be validated with DNS-01, which bolt can't
+		// answer.
+		if domain == "" || strings.ContainsAny(domain, "*:/ ") {
+			path := fmt.Sprintf("server.tls.acme.domains[%d]", i)
+			problems.add(path, c.positionOf(path), "invalid domain %q, expected a host name without wildcards", domain)
+		}
+	}
+
+	if conf.DirectoryURL == "" {
+		conf.DirectoryURL = DefaultACMEDirectory
+	} else if u, err := url.Parse(conf.DirectoryURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		problems.add("server.tls.acme.directory_url", c.positionOf("server.tls.acme.directory_url"),
+			"invalid directory URL %q", conf.DirectoryURL)
+	}
+
+	if conf.Challenges == nil {
+		conf.Challenges = []string{ChallengeTLSALPN01}
+		if c.Server.HTTPRedirect != nil {
+			conf.Challenges = append(conf.Challenges, ChallengeHTTP01)
+		}
+	}
+	if len(conf.Challenges) == 0 {
+		problems.add("server.tls.acme.challenges", c.positionOf("server.tls.acme.challenges"), "acme needs at least one challenge type")
+	}
+	for i, challenge := range conf.Challenges {
+		path := fmt.Sprintf("server.tls.acme.challenges[%d]", i)
+		switch challenge {
+		case ChallengeTLSALPN01:
+		case ChallengeHTTP01:
+			if c.Server.HTTPRedirect == nil {
+				problems.add(path, c.positionOf(path), "http-01 challenges are answered on server.http_redirect, which is not configured")
+			}
+		default:
+			problems.add(path, c.positionOf(path), "unknown challenge type %q. Supported: [http-01 tls-alpn-01]", challenge)
+		}
+	}
+
+	if conf.CacheDir == "" {
+		problems.add("server.tls.acme.cache_dir", c.positionOf("server.tls.acme.cache_dir"), "acme needs a cache_dir to store certificates")
+	}
+
+	if conf.RenewBefore < 0 && !c.lenient {
+		problems.add("server.tls.acme.renew_before", c.positionOf("server.tls.acme.renew_before"),
+			"renew_before must be positive, got %s", conf.RenewBefore)
+	} else if conf.RenewBefore <= 0 {
+		conf.RenewBefore = DefaultACMERenewBefore
+	}
+}
@@ -0,0 +1,463 @@
+package core
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+	"github.com/farhapartex/bolt-load-balancer/internal/logger"
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	acmeRetryMin     = time.Minute
+	acmeRetryMax     = time.Hour
+	acmeOrderTimeout = 5 * time.Minute
+)
+
+// ACMEStatus reports automatic certificate management in /status.
+type ACMEStatus struct {
+	Domains     []string  `json:"domains"`
+	NotAfter    time.Time `json:"not_after,omitzero"`
+	LastRenewal time.Time `json:"last_renewal,omitzero"`
+	NextRenewal time.Time `json:"next_renewal,omitzero"`
+
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorTime time.Time `json:"last_error_time,omitzero"`
+	// Failures counts failed attempts since the last success.
+	Failures int `json:"consecutive_failures"`
+}
+
+// acmeManager obtains the frontend certificate from an ACME CA, keeps it
+// in the cache directory and renews it before it expires. It answers the
+// CA's challenges while an order is in progress.
+type acmeManager struct {
+	conf       *config.ACMEConfig
+	client     *acme.Client
+	logger     *logger.Logger
+	registered bool
+
+	mutex  sync.RWMutex
+	cert   *tls.Certificate
+	status ACMEStatus
+	// httpTokens maps HTTP-01 challenge paths to their responses.
+	httpTokens map[string]string
+	// alpnCerts holds TLS-ALPN-01 challenge certificates by domain.
+	alpnCerts map[string]*tls.Certificate
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// certFile holds the private key followed by the certificate chain, so a
+// single rename replaces both.
+func (m *acmeManager) certFile() string {
+	return filepath.Join(m.conf.CacheDir, m.conf.Domains[0]+".pem")
+}
+
+// loadAccountKey reads the account key from the cache directory, creating
+// one on first use.
+func loadAccountKey(dir string) (crypto.Signer, error) {
+	path := filepath.Join(dir, "account.key")
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid ACME account key %s", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.WriteFileAtomic(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// covers reports whether cert is valid for every configured domain.
+func (m *acmeManager) covers(cert *tls.Certificate) bool {
+	for _, domain := range m.conf.Domains {
+		if cert.Leaf.VerifyHostname(domain) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// loadCached picks up a certificate stored by an earlier run, so restarts
+// don't order a new one.
+func (m *acmeManager) loadCached() {
+	cert, err := loadCertificate(config.CertificateConfig{CertFile: m.certFile(), KeyFile: m.certFile()})
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			m.logger.Warnf("Ignoring cached ACME certificate: %v", err)
+		}
+		return
+	}
+	if !m.covers(cert) {
+		m.logger.Infof("Cached ACME certificate %s doesn't cover %v, ordering a new one", m.certFile(), m.conf.Domains)
+		return
+	}
+	m.setCertificate(cert)
+}
+
+// renewalTime returns when cert is renewed: renew_before ahead of its
+// expiry, but no earlier than two thirds into its lifetime so short-lived
+// certificates aren't renewed over and over.
+func (m *acmeManager) renewalTime(cert *tls.Certificate) time.Time {
+	lifetime := cert.Leaf.NotAfter.Sub(cert.Leaf.NotBefore)
+	return cert.Leaf.NotAfter.Add(-min(m.conf.RenewBefore, lifetime/3))
+}
+
+func (m *acmeManager) setCertificate(cert *tls.Certificate) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.cert = cert
+	m.status.NotAfter = cert.Leaf.NotAfter
+	m.status.NextRenewal = m.renewalTime(cert)
+}
+
+// untilRenewal returns how long the current certificate can be kept, or
+// zero when a new one is needed now.
+func (m *acmeManager) untilRenewal() time.Duration {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if m.cert == nil {
+		return 0
+	}
+	return max(time.Until(m.renewalTime(m.cert)), 0)
+}
+
+// run orders a certificate when none is cached and renews it until stop is
+// called. Failed attempts are retried with a growing delay.
+func (m *acmeManager) run() {
+	retry := acmeRetryMin
+	for {
+		wait := m.untilRenewal()
+		if wait == 0 {
+			if err := m.obtain(m.ctx); err != nil {
+				if m.ctx.Err() != nil {
+					return
+				}
+				m.recordFailure(err, retry)
+				wait = retry
+				retry = min(retry*2, acmeRetryMax)
+			} else {
+				retry = acmeRetryMin
+				wait = m.untilRenewal()
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-m.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (m *acmeManager) recordFailure(err error, retry time.Duration) {
+	m.mutex.Lock()
+	m.status.LastError = err.Error()
+	m.status.LastErrorTime = time.Now()
+	m.status.NextRenewal = time.Now().Add(retry)
+	m.status.Failures++
+	failures := m.status.Failures
+	m.mutex.Unlock()
+
+	m.logger.Errorf("Failed to obtain ACME certificate for %v (attempt %d, retrying in %s): %v", m.conf.Domains, failures, retry, err)
+}
+
+func (m *acmeManager) register(ctx context.Context) error {
+	if m.registered {
+		return nil
+	}
+	account := &acme.Account{}
+	if m.conf.Email != "" {
+		account.Contact = []string{"mailto:" + m.conf.Email}
+	}
+	if _, err := m.client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("failed to register ACME account: %w", err)
+	}
+	m.registered = true
+	return nil
+}
+
+// obtain orders a certificate for the configured domains, stores it in the
+// cache directory and swaps it into the listener.
+func (m *acmeManager) obtain(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, acmeOrderTimeout)
+	defer cancel()
+
+	if err := m.register(ctx); err != nil {
+		return err
+	}
+	order, err := m.client.AuthorizeOrder(ctx, acme.DomainIDs(m.conf.Domains...))
+	if err != nil {
+		return fmt.Errorf("failed to create order: %w", err)
+	}
+	for _, authzURL := range order.AuthzURLs {
+		if err := m.authorize(ctx, authzURL); err != nil {
+			return err
+		}
+	}
+	if _, err := m.client.WaitOrder(ctx, order.URI); err != nil {
+		return fmt.Errorf("order failed: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: m.conf.Domains[0]},
+		DNSNames: m.conf.Domains,
+	}, key)
+	if err != nil {
+		return err
+	}
+	chain, _, err := m.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("failed to finalize order: %w", err)
+	}
+
+	cert, err := m.store(chain, key)
+	if err != nil {
+		return err
+	}
+	m.setCertificate(cert)
+	m.mutex.Lock()
+	m.status.LastRenewal = time.Now()
+	m.status.Failures = 0
+	m.mutex.Unlock()
+	m.logger.Infof("Obtained ACME certificate for %v, valid until %s", m.conf.Domains, cert.Leaf.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+// store writes the issued chain and its key to the cache directory and
+// returns them as a certificate.
+func (m *acmeManager) store(chain [][]byte, key *ecdsa.PrivateKey) (*tls.Certificate, error) {
+	var certPEM []byte
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("CA returned an unusable certificate: %w", err)
+	}
+	if !m.covers(&cert) {
+		return nil, fmt.Errorf("CA returned a certificate that doesn't cover %v", m.conf.Domains)
+	}
+
+	if err := config.WriteFileAtomic(m.certFile(), append(keyPEM, certPEM...), 0600); err != nil {
+		return nil, fmt.Errorf("failed to store certificate: %w", err)
+	}
+	return &cert, nil
+}
+
+// authorize proves control of one domain of an order, using the first
+// configured challenge type the CA offers.
+func (m *acmeManager) authorize(ctx context.Context, authzURL string) error {
+	authz, err := m.client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("failed to get authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	domain := authz.Identifier.Value
+
+	var challenge *acme.Challenge
+	for _, name := range m.conf.Challenges {
+		index := slices.IndexFunc(authz.Challenges, func(c *acme.Challenge) bool { return c.Type == name })
+		if index >= 0 {
+			challenge = authz.Challenges[index]
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("CA offered no supported challenge for %s", domain)
+	}
+
+	cleanup, err := m.prepareChallenge(challenge, domain)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if _, err := m.client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("failed to accept %s challenge for %s: %w", challenge.Type, domain, err)
+	}
+	if _, err := m.client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("%s challenge for %s failed: %w", challenge.Type, domain, err)
+	}
+	return nil
+}
+
+// prepareChallenge starts answering challenge and returns a function that
+// stops answering it.
+func (m *acmeManager) prepareChallenge(challenge *acme.Challenge, domain string) (func(), error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	switch challenge.Type {
+	case config.ChallengeHTTP01:
+		response, err := m.client.HTTP01ChallengeResponse(challenge.Token)
+		if err != nil {
+			return nil, err
+		}
+		path := m.client.HTTP01ChallengePath(challenge.Token)
+		m.httpTokens[path] = response
+		return func() {
+			m.mutex.Lock()
+			delete(m.httpTokens, path)
+			m.mutex.Unlock()
+		}, nil
+	case config.ChallengeTLSALPN01:
+		cert, err := m.client.TLSALPN01ChallengeCert(challenge.Token, domain)
+		if err != nil {
+			return nil, err
+		}
+		m.alpnCerts[domain] = &cert
+		return func() {
+			m.mutex.Lock()
+			delete(m.alpnCerts, domain)
+			m.mutex.Unlock()
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported challenge type %s", challenge.Type)
+}
+
+// serveHTTPChallenge answers pending HTTP-01 challenges. It reports whether
+// the request was one.
+func (m *acmeManager) serveHTTPChallenge(w http.ResponseWriter, r *http.Request) bool {
+	if m == nil {
+		return false
+	}
+	m.mutex.RLock()
+	response, ok := m.httpTokens[r.URL.Path]
+	m.mutex.RUnlock()
+	if !ok {
+		return false
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(response))
+	return true
+}
+
+// challengeCertificate returns the TLS-ALPN-01 certificate for hello when
+// it is a challenge connection, which only offers the acme-tls/1 protocol.
+func (m *acmeManager) challengeCertificate(hello *tls.ClientHelloInfo) (cert *tls.Certificate, isChallenge bool) {
+	if m == nil || !slices.Equal(hello.SupportedProtos, []string{acme.ALPNProto}) {
+		return nil, false
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.alpnCerts[hello.ServerName], true
+}
+
+func (m *acmeManager) certificate() *tls.Certificate {
+	if m == nil {
+		return nil
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.cert
+}
+
+func (m *acmeManager) Status() *ACMEStatus {
+	if m == nil {
+		return nil
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	status := m.status
+	return &status
+}
+
+func (m *acmeManager) stop() {
+	if m != nil {
+		m.cancel()
+	}
+}
+
+// newACMEManager returns nil when ACME is not configured. The cached
+// certificate, if any, is loaded right away; run orders one otherwise.
+func newACMEManager(conf *config.ACMEConfig, lgr *logger.Logger) (*acmeManager, error) {
+	if conf == nil {
+		return nil, nil
+	}
+	if err := os.MkdirAll(conf.CacheDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create ACME cache directory: %w", err)
+	}
+	key, err := loadAccountKey(conf.CacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ACME account key: %w", err)
+	}
+
+	client := &acme.Client{Key: key, DirectoryURL: conf.DirectoryURL, UserAgent: "bolt/" + Version}
+	if conf.DirectoryCAFile != "" {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		pemData, err := os.ReadFile(conf.DirectoryCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ACME directory CA: %w", err)
+		}
+		if !roots.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("no certificates found in %s", conf.DirectoryCAFile)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+		client.HTTPClient = &http.Client{Transport: transport}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	manager := &acmeManager{
+		conf:       conf,
+		client:     client,
+		logger:     lgr,
+		status:     ACMEStatus{Domains: conf.Domains},
+		httpTokens: make(map[string]string),
+		alpnCerts:  make(map[string]*tls.Certificate),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	manager.loadCached()
+	return manager, nil
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+)
+
+// AdminHandler serves the health, status, metrics and control endpoints
+// exposed on the admin listener.
+func (lb *LB) AdminHandler() http.Handler {
+	return lb.adminHandler
+}
+
+func (lb *LB) newAdminHandler(conf *config.Config) http.Handler {
+	protected := lb.protect(lb.newAdminMux(conf))
+	if !conf.Admin.Dashboard {
+		return protected
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", protected)
+	mux.Handle("GET /dashboard/", dashboardHandler())
+	mux.Handle("GET /{$}", http.RedirectHandler("/dashboard/", http.StatusFound))
+	return mux
+}
+
+func (lb *LB) newAdminMux(conf *config.Config) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", lb.handleHealthEndpoint)
+	mux.HandleFunc("GET /status", lb.handleStatusEndpoint)
+	if conf.Metrics.Enabled {
+		mux.Handle("GET "+conf.Metrics.Path, lb.metrics.registry)
+	}
+	lb.registerAdminAPI(mux)
+	return mux
+}
+
+// servePublicEndpoint answers requests for admin endpoints that were opted
+// into the public listener. It reports whether the request was handled.
+func (lb *LB) servePublicEndpoint(w http.ResponseWriter, r *http.Request, conf *config.Config) bool {
+	endpoints := conf.PublicEndpoints
+
+	switch {
+	case endpoints.Health != "" && r.URL.Path == endpoints.Health:
+		lb.handleHealthEndpoint(w, r)
+	case endpoints.Status != "" && r.URL.Path == endpoints.Status:
+		lb.handleStatusEndpoint(w, r)
+	case endpoints.Metrics != "" && r.URL.Path == endpoints.Metrics && conf.Metrics.Enabled:
+		lb.metrics.registry.ServeHTTP(w, r)
+	default:
+		return false
+	}
+	return true
+}
+
+// listenAdmin opens the admin TCP listener and unix socket, if configured.
+// Listeners are opened before serving so address conflicts fail Start.
+func (lb *LB) listenAdmin() ([]net.Listener, error) {
+	admin := lb.current().config.Admin
+	if !admin.Enabled {
+		return nil, nil
+	}
+
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}
+
+	if admin.Port != 0 {
+		address := net.JoinHostPort(admin.Host, strconv.Itoa(admin.Port))
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start admin listener on %s: %w", address, err)
+		}
+		if lb.adminTLS != nil {
+			listener = tls.NewListener(listener, lb.adminTLS)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	if admin.Socket != "" {
+		// A socket left behind by an unclean shutdown would block the listener.
+		if err := os.Remove(admin.Socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+			closeAll()
+			return nil, fmt.Errorf("failed to remove stale admin socket %s: %w", admin.Socket, err)
+		}
+		listener, err := net.Listen("unix", admin.Socket)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("failed to start admin listener on %s: %w", admin.Socket, err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
+
+func (lb *LB) serveAdmin(listeners []net.Listener) {
+	for _, listener := range listeners {
+		lb.logger.Infof("Admin endpoints listening on %s", listener.Addr())
+		go func(listener net.Listener) {
+			if err := lb.adminServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				lb.logger.Errorf("Admin listener on %s failed: %v", listener.Addr(), err)
+			}
+		}(listener)
+	}
+}
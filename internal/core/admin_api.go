@@ -0,0 +1,314 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+	"github.com/farhapartex/bolt-load-balancer/internal/loadbalancer"
+)
+
+// maxAdminBody limits the size of admin API request bodies.
+const maxAdminBody = 1 << 20
+
+// apiError is returned by the admin API handlers to choose the response
+// status.
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func newAPIError(status int, format string, args ...interface{}) *apiError {
+	return &apiError{status: status, message: fmt.Sprintf(format, args...)}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		status = apiErr.status
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func decodeJSONBody(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxAdminBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return newAPIError(http.StatusBadRequest, "invalid request body: %v", err)
+	}
+	return nil
+}
+
+// ConfigHash returns the digest of the running configuration, including
+// changes made through the admin API.
+func (lb *LB) ConfigHash() string {
+	lb.configMutex.RLock()
+	defer lb.configMutex.RUnlock()
+	return lb.configHash
+}
+
+// updateConfig applies change to the running configuration while holding the
+// config lock, then refreshes the config hash and persists the result when
+// admin.persist is set. change must look up pools and backends itself, so a
+// concurrent reload cannot swap them out from under it.
+func (lb *LB) updateConfig(change func(conf *config.Config) error) error {
+	lb.configMutex.Lock()
+	defer lb.configMutex.Unlock()
+
+	conf := lb.current().config
+	if err := change(conf); err != nil {
+		return err
+	}
+	lb.configHash = conf.Hash()
+
+	if !conf.Admin.Persist {
+		return nil
+	}
+	if err := conf.SaveConfToFile(conf.Filename()); err != nil {
+		lb.logger.Errorf("Failed to persist admin change: %v", err)
+		return newAPIError(http.StatusInternalServerError, "change applied but not persisted: %v", err)
+	}
+	return nil
+}
+
+func (lb *LB) findPool(name string) *Pool {
+	for _, pool := range lb.current().pools {
+		if pool.name == name {
+			return pool
+		}
+	}
+	return nil
+}
+
+// lookupBackend resolves the {id} path value, which is a backend ID or URL.
+// A URL present in several pools must be narrowed down with ?pool=. Callers
+// changing the backend hold the config lock.
+func (lb *LB) lookupBackend(r *http.Request) (*Pool, *loadbalancer.Backend, error) {
+	ref := r.PathValue("id")
+	poolName := r.URL.Query().Get("pool")
+
+	var foundPool *Pool
+	var found *loadbalancer.Backend
+	for _, pool := range lb.current().pools {
+		if poolName != "" && pool.name != poolName {
+			continue
+		}
+		if backend := pool.findBackend(ref); backend != nil {
+			if found != nil {
+				return nil, nil, newAPIError(http.StatusConflict,
+					"backend %s is in several pools, select one with ?pool=", ref)
+			}
+			foundPool, found = pool, backend
+		}
+	}
+
+	if found == nil {
+		return nil, nil, newAPIError(http.StatusNotFound, "backend %s not found", ref)
+	}
+	return foundPool, found, nil
+}
+
+func (lb *LB) handleListBackends(w http.ResponseWriter, r *http.Request) {
+	backends := make([]BackendStatus, 0)
+	for _, pool := range lb.current().pools {
+		for _, backend := range pool.backendPool.GetBackends() {
+			backends = append(backends, pool.backendStatus(backend))
+		}
+	}
+	writeJSON(w, http.StatusOK, backends)
+}
+
+type addBackendRequest struct {
+	Pool        string `json:"pool"`
+	URL         string `json:"url"`
+	Weight      int    `json:"weight"`
+	MaxFails    int    `json:"max_fails"`
+	FailTimeout string `json:"fail_timeout"`
+	Disabled    bool   `json:"disabled"`
+}
+
+func (lb *LB) handleAddBackend(w http.ResponseWriter, r *http.Request) {
+	var req addBackendRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if req.URL == "" {
+		writeAPIError(w, newAPIError(http.StatusBadRequest, "url is required"))
+		return
+	}
+
+	be_config := config.BackendConfig{
+		URL:      req.URL,
+		Weight:   req.Weight,
+		MaxFails: req.MaxFails,
+		Disabled: req.Disabled,
+	}
+	if req.FailTimeout != "" {
+		failTimeout, err := time.ParseDuration(req.FailTimeout)
+		if err != nil {
+			writeAPIError(w, newAPIError(http.StatusBadRequest, "invalid fail_timeout: %v", err))
+			return
+		}
+		be_config.FailTimeout = failTimeout
+	}
+
+	var pool *Pool
+	var backend *loadbalancer.Backend
+	err := lb.updateConfig(func(conf *config.Config) error {
+		poolName := req.Pool
+		if poolName == "" {
+			poolName = conf.DefaultPoolFor()
+		}
+		if poolName == "" {
+			return newAPIError(http.StatusBadRequest, "pool is required")
+		}
+		if pool = lb.findPool(poolName); pool == nil {
+			return newAPIError(http.StatusNotFound, "unknown pool %q", poolName)
+		}
+		if pool.findBackend(req.URL) != nil {
+			return newAPIError(http.StatusConflict, "backend %s already exists in pool %q", req.URL, pool.name)
+		}
+
+		added, err := conf.AddBackend(pool.name, be_config)
+		if err != nil {
+			return newAPIError(http.StatusBadRequest, "%v", err)
+		}
+		added.Source = conf.Filename()
+		if backend, err = pool.addBackend(added); err != nil {
+			// Keep the configuration in step with the running pool.
+			conf.RemoveBackend(pool.name, added.URL)
+			return err
+		}
+		return nil
+	})
+	if backend != nil {
+		// Check the new backend right away rather than waiting for the next
+		// health check interval.
+		go pool.healthChecker.CheckBackendOnce(backend)
+	}
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, pool.backendStatus(backend))
+}
+
+func (lb *LB) handleDeleteBackend(w http.ResponseWriter, r *http.Request) {
+	var status BackendStatus
+	err := lb.updateConfig(func(conf *config.Config) error {
+		pool, backend, err := lb.lookupBackend(r)
+		if err != nil {
+			return err
+		}
+		if pool.backendPool.Size() == 1 {
+			return newAPIError(http.StatusConflict, "cannot remove the last backend of pool %q", pool.name)
+		}
+
+		status = pool.backendStatus(backend)
+		if err := conf.RemoveBackend(pool.name, pool.configFor(backend).URL); err != nil {
+			return err
+		}
+		pool.removeBackend(backend)
+		return nil
+	})
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+type updateBackendRequest struct {
+	Weight *int `json:"weight"`
+}
+
+func (lb *LB) handleUpdateBackend(w http.ResponseWriter, r *http.Request) {
+	var req updateBackendRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if req.Weight == nil {
+		writeAPIError(w, newAPIError(http.StatusBadRequest, "nothing to update, expected weight"))
+		return
+	}
+	if *req.Weight < 1 {
+		writeAPIError(w, newAPIError(http.StatusBadRequest, "weight must be at least 1, got %d", *req.Weight))
+		return
+	}
+
+	var pool *Pool
+	var backend *loadbalancer.Backend
+	err := lb.updateConfig(func(conf *config.Config) error {
+		var err error
+		if pool, backend, err = lb.lookupBackend(r); err != nil {
+			return err
+		}
+		backend.SetWeight(*req.Weight)
+		return conf.UpdateBackend(pool.name, pool.configFor(backend).URL, func(be_config *config.BackendConfig) {
+			be_config.Weight = *req.Weight
+		})
+	})
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, pool.backendStatus(backend))
+}
+
+// handleSetBackendState returns a handler that moves a backend to state.
+// Draining is not persisted since it only matters until the backend is
+// removed or enabled again.
+func (lb *LB) handleSetBackendState(state loadbalancer.AdminState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var pool *Pool
+		var backend *loadbalancer.Backend
+		err := lb.updateConfig(func(conf *config.Config) error {
+			var err error
+			if pool, backend, err = lb.lookupBackend(r); err != nil {
+				return err
+			}
+			backend.SetAdminState(state)
+			if state == loadbalancer.StateDraining {
+				return nil
+			}
+			return conf.UpdateBackend(pool.name, pool.configFor(backend).URL, func(be_config *config.BackendConfig) {
+				be_config.Disabled = state == loadbalancer.StateDisabled
+			})
+		})
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, pool.backendStatus(backend))
+	}
+}
+
+func (lb *LB) registerAdminAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/backends", lb.handleListBackends)
+	mux.HandleFunc("POST /admin/backends", lb.handleAddBackend)
+	mux.HandleFunc("DELETE /admin/backends/{id}", lb.handleDeleteBackend)
+	mux.HandleFunc("PATCH /admin/backends/{id}", lb.handleUpdateBackend)
+	mux.HandleFunc("POST /admin/backends/{id}/drain", lb.handleSetBackendState(loadbalancer.StateDraining))
+	mux.HandleFunc("POST /admin/backends/{id}/disable", lb.handleSetBackendState(loadbalancer.StateDisabled))
+	mux.HandleFunc("POST /admin/backends/{id}/enable", lb.handleSetBackendState(loadbalancer.StateActive))
+	mux.HandleFunc("POST /admin/reload", lb.handleReload)
+	mux.HandleFunc("GET /events", lb.handleEvents)
+}
@@ -0,0 +1,235 @@
+package core
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+)
+
+type adminToken struct {
+	digest [sha256.Size]byte
+	role   string
+}
+
+// adminAuth authenticates admin callers and checks their role. A nil
+// adminAuth lets every request through.
+type adminAuth struct {
+	tokens    []adminToken
+	certRoles map[string]string
+	certAuth  bool
+}
+
+// principal identifies an authenticated admin caller without revealing its
+// credentials.
+type principal struct {
+	name string
+	role string
+}
+
+// lookupToken compares token against every configured token in constant
+// time, so response timing reveals neither which token matched nor how much
+// of it was right.
+func (a *adminAuth) lookupToken(token string) (adminToken, bool) {
+	digest := sha256.Sum256([]byte(token))
+
+	var found adminToken
+	matched := 0
+	for _, candidate := range a.tokens {
+		if subtle.ConstantTimeCompare(digest[:], candidate.digest[:]) == 1 {
+			found = candidate
+			matched = 1
+		}
+	}
+	return found, matched == 1
+}
+
+func (a *adminAuth) authenticate(r *http.Request) (principal, bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return principal{}, false
+		}
+		entry, ok := a.lookupToken(strings.TrimSpace(token))
+		if !ok {
+			return principal{}, false
+		}
+		return principal{name: "token:" + hex.EncodeToString(entry.digest[:4]), role: entry.role}, true
+	}
+
+	// The TLS handshake has already verified the chain against the client CA.
+	if a.certAuth && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		role, ok := a.certRoles[cn]
+		if !ok {
+			role = config.RoleReadOnly
+		}
+		return principal{name: "cert:" + cn, role: role}, true
+	}
+
+	return principal{}, false
+}
+
+func isReadOnlyMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// isCrossSite reports whether a browser sent r on behalf of another site.
+// Without authentication, or with client certificates, the browser would
+// otherwise let any page it visits drive the admin API. Clients other than
+// browsers send neither header and are let through.
+func isCrossSite(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return false
+	case "":
+	default:
+		return true
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err != nil || u.Host != r.Host
+}
+
+// protect authenticates every admin request, requires the read-write role for
+// mutating methods, rejects mutating requests from other sites and writes an
+// audit event for each mutating call.
+func (lb *LB) protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start_time := time.Now()
+		caller := principal{name: "anonymous", role: config.RoleReadWrite}
+
+		recorder := newResponseRecorder(w)
+		defer func() {
+			if isReadOnlyMethod(r.Method) {
+				return
+			}
+			lb.logger.Audit(r.Method+" "+r.URL.Path, map[string]interface{}{
+				"principal":   caller.name,
+				"role":        caller.role,
+				"remote_addr": r.RemoteAddr,
+				"status_code": recorder.Status(),
+				"duration_ms": time.Since(start_time).Milliseconds(),
+			})
+		}()
+
+		if !isReadOnlyMethod(r.Method) && isCrossSite(r) {
+			writeAPIError(recorder, newAPIError(http.StatusForbidden, "cross-site %s %s rejected", r.Method, r.URL.Path))
+			return
+		}
+
+		if lb.adminAuth != nil {
+			authenticated, ok := lb.adminAuth.authenticate(r)
+			if !ok {
+				caller = principal{name: "unauthenticated"}
+				recorder.Header().Set("WWW-Authenticate", `Bearer realm="bolt-admin"`)
+				writeAPIError(recorder, newAPIError(http.StatusUnauthorized, "authentication required"))
+				return
+			}
+			caller = authenticated
+		}
+
+		if !isReadOnlyMethod(r.Method) && caller.role != config.RoleReadWrite {
+			writeAPIError(recorder, newAPIError(http.StatusForbidden, "%s may not %s %s", caller.name, r.Method, r.URL.Path))
+			return
+		}
+
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+func parseAdminTokens(source, data string, separators string) ([]adminToken, error) {
+	var tokens []adminToken
+	for i, line := range strings.FieldsFunc(data, func(r rune) bool { return strings.ContainsRune(separators, r) }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		role, token, err := config.ParseAdminToken(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s entry %d: %w", source, i+1, err)
+		}
+		tokens = append(tokens, adminToken{digest: sha256.Sum256([]byte(token)), role: role})
+	}
+	return tokens, nil
+}
+
+func newAdminAuth(conf config.AdminAuthConfig) (*adminAuth, error) {
+	if !conf.Enabled() {
+		return nil, nil
+	}
+
+	auth := &adminAuth{certRoles: conf.ClientCertRoles, certAuth: conf.ClientCAFile != ""}
+
+	if conf.TokensFile != "" {
+		data, err := os.ReadFile(conf.TokensFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read admin tokens file: %w", err)
+		}
+		tokens, err := parseAdminTokens(conf.TokensFile, string(data), "\n")
+		if err != nil {
+			return nil, err
+		}
+		auth.tokens = append(auth.tokens, tokens...)
+	}
+
+	if conf.TokensEnv != "" {
+		value, ok := os.LookupEnv(conf.TokensEnv)
+		if !ok {
+			return nil, fmt.Errorf("admin tokens environment variable %s is not set", conf.TokensEnv)
+		}
+		tokens, err := parseAdminTokens(conf.TokensEnv, value, ",\n")
+		if err != nil {
+			return nil, err
+		}
+		auth.tokens = append(auth.tokens, tokens...)
+	}
+
+	return auth, nil
+}
+
+// newAdminTLSConfig loads the admin certificate and, when client certificate
+// authentication is on, the CA pool client certificates are verified against.
+func newAdminTLSConfig(conf config.AdminConfig) (*tls.Config, error) {
+	if conf.TLS == nil {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(conf.TLS.CertFile, conf.TLS.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load admin certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if conf.Auth.ClientCAFile != "" {
+		pem, err := os.ReadFile(conf.Auth.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read admin client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in admin client CA %s", conf.Auth.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		// Token-authenticated callers may connect without a certificate.
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,229 @@
+// Bolt dashboard. Polls the admin status API and redraws the page; request
+// and error rates are computed from the counters between polls.
+(function () {
+  "use strict";
+
+  const POLL_INTERVAL_MS = 2000;
+  const SAMPLES = 60;
+  const TOKEN_KEY = "bolt-admin-token";
+
+  // Per-backend samples, keyed by pool and backend ID.
+  const samples = new Map();
+
+  function el(tag, attrs, ...children) {
+    const node = document.createElement(tag);
+    for (const [key, value] of Object.entries(attrs || {})) {
+      if (key === "class") {
+        node.className = value;
+      } else if (key.startsWith("on")) {
+        node.addEventListener(key.slice(2), value);
+      } else {
+        node.setAttribute(key, value);
+      }
+    }
+    for (const child of children) {
+      if (child !== null && child !== undefined) {
+        node.append(child instanceof Node ? child : String(child));
+      }
+    }
+    return node;
+  }
+
+  async function api(method, path) {
+    const headers = {};
+    const token = sessionStorage.getItem(TOKEN_KEY);
+    if (token) {
+      headers["Authorization"] = "Bearer " + token;
+    }
+
+    const resp = await fetch(path, { method, headers, cache: "no-store" });
+    if (resp.status === 401) {
+      sessionStorage.removeItem(TOKEN_KEY);
+      document.getElementById("login").hidden = false;
+      throw new Error("authentication required");
+    }
+    const body = await resp.json().catch(() => ({}));
+    if (!resp.ok) {
+      throw new Error(body.error || resp.status + " " + resp.statusText);
+    }
+    return body;
+  }
+
+  function showError(message) {
+    const box = document.getElementById("error");
+    box.textContent = message;
+    box.hidden = !message;
+  }
+
+  function record(report) {
+    const now = Date.now();
+    const seen = new Set();
+
+    for (const pool of report.pools) {
+      for (const backend of pool.backends) {
+        const key = pool.name + "/" + backend.id;
+        seen.add(key);
+
+        let entry = samples.get(key);
+        if (!entry) {
+          entry = { last: null, rate: [], errors: [], latency: [] };
+          samples.set(key, entry);
+        }
+
+        if (entry.last && backend.requests >= entry.last.requests) {
+          const seconds = (now - entry.last.time) / 1000;
+          const requests = backend.requests - entry.last.requests;
+          const failed = backend.failed_requests - entry.last.failed;
+          push(entry.rate, requests / seconds);
+          push(entry.errors, requests > 0 ? (100 * failed) / requests : 0);
+        }
+        push(entry.latency, backend.latency_ms);
+        entry.last = { time: now, requests: backend.requests, failed: backend.failed_requests };
+      }
+    }
+
+    for (const key of samples.keys()) {
+      if (!seen.has(key)) {
+        samples.delete(key);
+      }
+    }
+  }
+
+  function push(series, value) {
+    series.push(value);
+    if (series.length > SAMPLES) {
+      series.shift();
+    }
+  }
+
+  function last(series) {
+    return series.length ? series[series.length - 1] : 0;
+  }
+
+  function sparkline(values) {
+    const ns = "http://www.w3.org/2000/svg";
+    const svg = document.createElementNS(ns, "svg");
+    svg.setAttribute("class", "spark");
+    svg.setAttribute("viewBox", "0 0 " + (SAMPLES - 1) + " 24");
+    svg.setAttribute("preserveAspectRatio", "none");
+
+    const max = Math.max(1, ...values);
+    const offset = SAMPLES - values.length;
+    const points = values.map((v, i) => (offset + i) + "," + (23 - (22 * v) / max).toFixed(1));
+    const line = document.createElementNS(ns, "polyline");
+    line.setAttribute("points", points.join(" "));
+    svg.append(line);
+
+    const title = document.createElementNS(ns, "title");
+    title.textContent = "max " + max.toFixed(1) + " ms";
+    svg.append(title);
+    return svg;
+  }
+
+  function checkHistory(checks) {
+    const strip = el("div", { class: "checks" });
+    for (const check of checks || []) {
+      const label = new Date(check.time).toLocaleTimeString() + " " +
+        (check.healthy ? "passed" : "failed: " + (check.error || "unknown error")) +
+        " (" + check.duration_ms.toFixed(1) + " ms)";
+      strip.append(el("span", { class: check.healthy ? "" : "failed", title: label }));
+    }
+    return strip;
+  }
+
+  async function setState(pool, backend, action) {
+    try {
+      await api("POST", "/admin/backends/" + encodeURIComponent(backend.id) + "/" + action +
+        "?pool=" + encodeURIComponent(pool.name));
+      showError("");
+      refresh();
+    } catch (err) {
+      showError(action + " " + backend.url + ": " + err.message);
+    }
+  }
+
+  function backendRow(pool, backend) {
+    const entry = samples.get(pool.name + "/" + backend.id) || { rate: [], errors: [], latency: [] };
+    const draining = backend.state !== "active";
+    const action = draining ? "enable" : "drain";
+
+    return el("tr", null,
+      el("td", null, el("span", { class: "dot " + backend.status }), backend.status),
+      el("td", { title: backend.id }, backend.url),
+      el("td", { class: "state-" + backend.state }, backend.state),
+      el("td", { class: "num" }, backend.weight),
+      el("td", { class: "num" }, backend.in_flight_requests),
+      el("td", { class: "num" }, last(entry.rate).toFixed(1)),
+      el("td", { class: "num" }, last(entry.errors).toFixed(1) + "%"),
+      el("td", { class: "num" }, backend.latency_ms.toFixed(1) + " ms"),
+      el("td", null, sparkline(entry.latency)),
+      el("td", null, checkHistory(backend.recent_checks)),
+      el("td", null, el("button", { onclick: () => setState(pool, backend, action) }, action)),
+    );
+  }
+
+  function poolSection(pool) {
+    const head = el("tr", null,
+      ...["Health", "Backend", "State", "Weight", "Conns", "Req/s", "Errors", "Latency", "", "Health checks", ""]
+        .map((label) => el("th", null, label)));
+
+    return el("section", null,
+      el("h2", null, pool.name,
+        el("small", null, pool.healthy_backends + "/" + pool.total_backends + " healthy, " + pool.algorithm)),
+      el("table", null, el("thead", null, head),
+        el("tbody", null, ...pool.backends.map((backend) => backendRow(pool, backend)))),
+    );
+  }
+
+  function formatUptime(seconds) {
+    const d = Math.floor(seconds / 86400);
+    const h = Math.floor((seconds % 86400) / 3600);
+    const m = Math.floor((seconds % 3600) / 60);
+    return (d ? d + "d " : "") + h + "h " + m + "m";
+  }
+
+  function render(report) {
+    const overall = document.getElementById("overall");
+    overall.textContent = report.status;
+    overall.className = "badge " + report.status;
+
+    const summary = document.getElementById("summary");
+    summary.replaceChildren(
+      ...[
+        ["Healthy", report.healthy_backends + "/" + report.total_backends],
+        ["In flight", report.in_flight_requests],
+        ["Uptime", formatUptime(report.uptime_seconds)],
+        ["Version", report.version],
+      ].flatMap(([label, value]) => [el("dt", null, label), el("dd", null, value)]),
+    );
+
+    document.getElementById("pools").replaceChildren(...report.pools.map(poolSection));
+    document.getElementById("updated").textContent = "Updated " + new Date().toLocaleTimeString();
+  }
+
+  async function refresh() {
+    try {
+      const report = await api("GET", "/status?history=true");
+      record(report);
+      render(report);
+      document.getElementById("login").hidden = true;
+      if (document.getElementById("error").textContent === "lost connection") {
+        showError("");
+      }
+    } catch (err) {
+      if (err.message !== "authentication required") {
+        showError("lost connection");
+      }
+    }
+  }
+
+  document.getElementById("login").addEventListener("submit", (event) => {
+    event.preventDefault();
+    sessionStorage.setItem(TOKEN_KEY, document.getElementById("token").value);
+    document.getElementById("token").value = "";
+    refresh();
+  });
+
+  refresh();
+  setInterval(refresh, POLL_INTERVAL_MS);
+})();
@@ -0,0 +1,332 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/health"
+)
+
+// Event types streamed by the events endpoint.
+const (
+	EventHealth  = "health"
+	EventReload  = "reload"
+	EventRequest = "request"
+)
+
+const (
+	// subscriberBuffer is the number of events queued for a slow client
+	// before further events are dropped.
+	subscriberBuffer = 256
+	eventsHeartbeat  = 15 * time.Second
+)
+
+// Event is one entry of the admin event stream. Fields that don't apply to
+// the event's type are left empty.
+type Event struct {
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	Pool      string    `json:"pool,omitempty"`
+	Backend   string    `json:"backend,omitempty"`
+	BackendID string    `json:"backend_id,omitempty"`
+
+	// Health transitions.
+	Previous string `json:"previous,omitempty"`
+	Current  string `json:"current,omitempty"`
+
+	// Configuration reloads.
+	Result     string `json:"result,omitempty"`
+	ConfigHash string `json:"config_hash,omitempty"`
+
+	// Sampled requests.
+	RequestID  string  `json:"request_id,omitempty"`
+	Method     string  `json:"method,omitempty"`
+	Path       string  `json:"path,omitempty"`
+	StatusCode int     `json:"status_code,omitempty"`
+	DurationMs float64 `json:"duration_ms,omitempty"`
+	ClientIP   string  `json:"client_ip,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// eventFilter selects the events a subscriber receives.
+type eventFilter struct {
+	types      map[string]bool
+	pool       string
+	backend    string
+	statuses   []string
+	pathPrefix string
+	sample     float64
+}
+
+func parseEventFilter(r *http.Request) (eventFilter, error) {
+	query := r.URL.Query()
+	filter := eventFilter{
+		types:      map[string]bool{EventHealth: true, EventReload: true},
+		pool:       query.Get("pool"),
+		backend:    strings.TrimSuffix(query.Get("backend"), "/"),
+		pathPrefix: query.Get("path_prefix"),
+		sample:     1,
+	}
+
+	if types := query.Get("types"); types != "" {
+		filter.types = make(map[string]bool)
+		for _, name := range strings.Split(types, ",") {
+			switch name = strings.TrimSpace(name); name {
+			case EventHealth, EventReload, EventRequest:
+				filter.types[name] = true
+			default:
+				return eventFilter{}, fmt.Errorf("unknown event type %q, expected health, reload or request", name)
+			}
+		}
+	}
+
+	if status := query.Get("status"); status != "" {
+		for _, s := range strings.Split(status, ",") {
+			s = strings.ToLower(strings.TrimSpace(s))
+			if !validStatusFilter(s) {
+				return eventFilter{}, fmt.Errorf("invalid status filter %q, expected a class like 5xx or a code like 503", s)
+			}
+			filter.statuses = append(filter.statuses, s)
+		}
+	}
+
+	if sample := query.Get("sample"); sample != "" {
+		ratio, err := strconv.ParseFloat(sample, 64)
+		if err != nil || ratio <= 0 || ratio > 1 {
+			return eventFilter{}, fmt.Errorf("sample must be a number in (0, 1], got %q", sample)
+		}
+		filter.sample = ratio
+	}
+
+	return filter, nil
+}
+
+func validStatusFilter(s string) bool {
+	if len(s) != 3 || s[0] < '1' || s[0] > '5' {
+		return false
+	}
+	if s[1:] == "xx" {
+		return true
+	}
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+func (f eventFilter) matches(event Event) bool {
+	if !f.types[event.Type] {
+		return false
+	}
+	if f.pool != "" && event.Type != EventReload && event.Pool != f.pool {
+		return false
+	}
+	if f.backend != "" && event.Type != EventReload &&
+		f.backend != event.BackendID && f.backend != strings.TrimSuffix(event.Backend, "/") {
+		return false
+	}
+	if event.Type != EventRequest {
+		return true
+	}
+
+	if f.pathPrefix != "" && !strings.HasPrefix(event.Path, f.pathPrefix) {
+		return false
+	}
+	if len(f.statuses) > 0 {
+		code := strconv.Itoa(event.StatusCode)
+		class := statusClass(event.StatusCode)
+		matched := false
+		for _, s := range f.statuses {
+			if s == code || s == class {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return f.sample >= 1 || rand.Float64() < f.sample
+}
+
+type subscriber struct {
+	filter  eventFilter
+	events  chan Event
+	dropped atomic.Int64
+}
+
+// eventHub fans events out to the clients of the events endpoint. Slow
+// clients lose events rather than holding up requests or health checks.
+type eventHub struct {
+	mutex       sync.RWMutex
+	subscribers map[*subscriber]bool
+	closed      chan struct{}
+	closeOnce   sync.Once
+
+	// requestSubscribers counts subscribers that asked for request events,
+	// so the proxy skips building them when nobody is listening.
+	requestSubscribers atomic.Int64
+}
+
+func (h *eventHub) subscribe(filter eventFilter) *subscriber {
+	sub := &subscriber{filter: filter, events: make(chan Event, subscriberBuffer)}
+	h.mutex.Lock()
+	h.subscribers[sub] = true
+	h.mutex.Unlock()
+	if filter.types[EventRequest] {
+		h.requestSubscribers.Add(1)
+	}
+	return sub
+}
+
+func (h *eventHub) unsubscribe(sub *subscriber) {
+	h.mutex.Lock()
+	delete(h.subscribers, sub)
+	h.mutex.Unlock()
+	if sub.filter.types[EventRequest] {
+		h.requestSubscribers.Add(-1)
+	}
+}
+
+func (h *eventHub) publish(event Event) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for sub := range h.subscribers {
+		if !sub.filter.matches(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+func (h *eventHub) wantsRequests() bool {
+	return h.requestSubscribers.Load() > 0
+}
+
+// close ends every open stream so shutdown doesn't wait for clients.
+func (h *eventHub) close() {
+	h.closeOnce.Do(func() { close(h.closed) })
+}
+
+// observeHealthCheck returns a health.Observer that publishes status
+// transitions of pool's backends.
+func (h *eventHub) observeHealthCheck(pool string) health.Observer {
+	return func(result health.CheckResult) {
+		if result.Previous == result.Current {
+			return
+		}
+		event := Event{
+			Type:      EventHealth,
+			Time:      result.Time,
+			Pool:      pool,
+			Backend:   result.Backend.URL.String(),
+			BackendID: backendID(pool, result.Backend.URL.String()),
+			Previous:  result.Previous.String(),
+			Current:   result.Current.String(),
+		}
+		if result.Err != nil {
+			event.Error = result.Err.Error()
+		}
+		h.publish(event)
+	}
+}
+
+func (h *eventHub) watchPools(pools []*Pool) {
+	for _, pool := range pools {
+		pool.healthChecker.AddObserver(h.observeHealthCheck(pool.name))
+	}
+}
+
+func (lb *LB) publishRequest(r *http.Request, requestID, clientIP, pool, backend string, status int, duration time.Duration) {
+	if !lb.events.wantsRequests() {
+		return
+	}
+	event := Event{
+		Type:       EventRequest,
+		Time:       time.Now(),
+		Pool:       pool,
+		Backend:    backend,
+		RequestID:  requestID,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		StatusCode: status,
+		DurationMs: float64(duration.Microseconds()) / 1000,
+		ClientIP:   clientIP,
+	}
+	if backend != noBackend {
+		event.BackendID = backendID(pool, backend)
+	}
+	lb.events.publish(event)
+}
+
+// handleEvents streams events matching the request's filters as server-sent
+// events until the client disconnects or bolt shuts down.
+func (lb *LB) handleEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		writeAPIError(w, newAPIError(http.StatusBadRequest, "%v", err))
+		return
+	}
+
+	// Subscribe before answering so the client sees every event published
+	// after its request is accepted.
+	sub := lb.events.subscribe(filter)
+	defer lb.events.unsubscribe(sub)
+
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	var id int64
+	var reported int64
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-lb.events.closed:
+			return
+		case <-heartbeat.C:
+			if dropped := sub.dropped.Load(); dropped > reported {
+				fmt.Fprintf(w, ": dropped %d events\n\n", dropped-reported)
+				reported = dropped
+			} else {
+				fmt.Fprint(w, ": ping\n\n")
+			}
+		case event := <-sub.events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			id++
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event.Type, data)
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subscribers: make(map[*subscriber]bool),
+		closed:      make(chan struct{}),
+	}
+}
@@ -0,0 +1,193 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies is the set of networks whose forwarding headers are
+// believed. Requests from other peers have those headers discarded.
+type TrustedProxies []*net.IPNet
+
+func ParseTrustedProxies(entries []string) (TrustedProxies, error) {
+	proxies := make(TrustedProxies, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy address %q", entry)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy network %q: %w", entry, err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+func (tp TrustedProxies) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range tp {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardingInfo describes the original client request as seen through any
+// trusted proxies in front of bolt.
+type forwardingInfo struct {
+	peer     string
+	clientIP string
+	trusted  bool
+	priorXFF string
+	proto    string
+	host     string
+	port     string
+	forward  string
+}
+
+func newForwardingInfo(r *http.Request, trusted TrustedProxies) *forwardingInfo {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+
+	info := &forwardingInfo{
+		peer:     peer,
+		clientIP: peer,
+		trusted:  trusted.Contains(net.ParseIP(peer)),
+		proto:    "http",
+		host:     r.Host,
+	}
+	if r.TLS != nil {
+		info.proto = "https"
+	}
+	info.port = requestPort(r, info.proto)
+
+	if !info.trusted {
+		return info
+	}
+
+	info.priorXFF = strings.Join(r.Header.Values("X-Forwarded-For"), ", ")
+	info.clientIP = clientFromChain(info.priorXFF, peer, trusted)
+	info.forward = strings.Join(r.Header.Values("Forwarded"), ", ")
+
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		info.proto = proto
+	}
+	if host := r.Header.Get("X-Forwarded-Host"); host != "" {
+		info.host = host
+	}
+	if port := r.Header.Get("X-Forwarded-Port"); port != "" {
+		info.port = port
+	} else if r.Header.Get("X-Forwarded-Proto") != "" || r.Header.Get("X-Forwarded-Host") != "" {
+		info.port = hostPort(info.host, info.proto)
+	}
+
+	return info
+}
+
+// clientFromChain walks the X-Forwarded-For chain from the right, skipping
+// trusted proxies, and returns the first address that is not trusted.
+func clientFromChain(chain, peer string, trusted TrustedProxies) string {
+	client := peer
+	hops := strings.Split(chain, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		ip := net.ParseIP(hop)
+		if ip == nil {
+			break
+		}
+		client = hop
+		if !trusted.Contains(ip) {
+			break
+		}
+	}
+	return client
+}
+
+func requestPort(r *http.Request, proto string) string {
+	if _, port, err := net.SplitHostPort(r.Host); err == nil {
+		return port
+	}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if _, port, err := net.SplitHostPort(addr.String()); err == nil {
+			return port
+		}
+	}
+	return hostPort("", proto)
+}
+
+func hostPort(host, proto string) string {
+	if _, port, err := net.SplitHostPort(host); err == nil {
+		return port
+	}
+	if proto == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// apply sets the forwarding headers on the outgoing request. The peer address
+// itself is appended to X-Forwarded-For by httputil.ReverseProxy.
+func (fi *forwardingInfo) apply(h http.Header, emitForwarded bool) {
+	if fi.priorXFF != "" {
+		h.Set("X-Forwarded-For", fi.priorXFF)
+	} else {
+		h.Del("X-Forwarded-For")
+	}
+
+	h.Set("X-Real-IP", fi.clientIP)
+	h.Set("X-Forwarded-Proto", fi.proto)
+	h.Set("X-Forwarded-Host", fi.host)
+	h.Set("X-Forwarded-Port", fi.port)
+
+	if !emitForwarded {
+		if !fi.trusted {
+			h.Del("Forwarded")
+		}
+		return
+	}
+
+	element := fmt.Sprintf("for=%s;host=%s;proto=%s", forwardedNode(fi.peer), quoteForwarded(fi.host), fi.proto)
+	if fi.forward != "" {
+		element = fi.forward + ", " + element
+	}
+	h.Set("Forwarded", element)
+}
+
+// forwardedNode formats an address as an RFC 7239 node, quoting IPv6
+// addresses as the grammar requires.
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return fmt.Sprintf(`"[%s]"`, ip)
+	}
+	return ip
+}
+
+func quoteForwarded(value string) string {
+	for _, r := range value {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", r)) {
+			return fmt.Sprintf("%q", value)
+		}
+	}
+	return value
+}
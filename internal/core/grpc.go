@@ -0,0 +1,140 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gRPC status codes that bolt reports on its own.
+const (
+	grpcCanceled         = 1
+	grpcUnknown          = 2
+	grpcDeadlineExceeded = 4
+	grpcPermissionDenied = 7
+	grpcUnimplemented    = 12
+	grpcInternal         = 13
+	grpcUnavailable      = 14
+	grpcUnauthenticated  = 16
+)
+
+// statusClientClosedRequest is recorded for calls the client canceled. It is
+// not a real HTTP status, but the one nginx logs for the same case.
+const statusClientClosedRequest = 499
+
+// isGRPC reports whether r is a gRPC call. Each call is its own HTTP/2
+// stream, and so its own request to balance.
+func isGRPC(r *http.Request) bool {
+	return isGRPCContentType(r.Header.Get("Content-Type"))
+}
+
+func isGRPCContentType(contentType string) bool {
+	return contentType == "application/grpc" ||
+		strings.HasPrefix(contentType, "application/grpc+") ||
+		strings.HasPrefix(contentType, "application/grpc;")
+}
+
+// grpcCodeFor maps an HTTP status to a gRPC status code, following gRPC's
+// HTTP to gRPC status code mapping.
+func grpcCodeFor(status int) int {
+	switch status {
+	case http.StatusBadRequest:
+		return grpcInternal
+	case http.StatusUnauthorized:
+		return grpcUnauthenticated
+	case http.StatusForbidden:
+		return grpcPermissionDenied
+	case http.StatusNotFound:
+		return grpcUnimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return grpcUnavailable
+	}
+	return grpcUnknown
+}
+
+// writeError answers a request bolt could not proxy. gRPC clients ignore
+// HTTP status codes and bodies, so they get a gRPC status instead.
+func writeError(w http.ResponseWriter, r *http.Request, message string, status int) {
+	if !isGRPC(r) {
+		http.Error(w, message, status)
+		return
+	}
+	writeGRPCStatus(w, grpcCodeFor(status), message)
+}
+
+// writeGRPCStatus sends a trailers-only gRPC response carrying code.
+func writeGRPCStatus(w http.ResponseWriter, code int, message string) {
+	setGRPCStatus(w.Header(), code, message)
+	w.WriteHeader(http.StatusOK)
+}
+
+func setGRPCStatus(header http.Header, code int, message string) {
+	header.Set("Content-Type", "application/grpc")
+	header.Set("Grpc-Status", strconv.Itoa(code))
+	header.Set("Grpc-Message", url.PathEscape(message))
+}
+
+// grpcStatusForError maps an error from the backend round trip to a gRPC
+// status, and to the HTTP status recorded for the call.
+func grpcStatusForError(err error) (int, string, int) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return grpcDeadlineExceeded, "deadline exceeded waiting for the backend", http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return grpcCanceled, "call canceled", statusClientClosedRequest
+	}
+	return grpcUnavailable, "Bad Gateway", http.StatusBadGateway
+}
+
+// grpcResponseFromHTTP turns a backend's non-gRPC error response, such as
+// a 503 from a proxy in front of it, into a trailers-only gRPC response, and
+// reports whether it did. Responses that already carry a grpc-status are
+// left alone.
+func grpcResponseFromHTTP(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusOK || resp.Header.Get("Grpc-Status") != "" {
+		return false
+	}
+
+	message := fmt.Sprintf("backend returned HTTP %d", resp.StatusCode)
+	code := grpcCodeFor(resp.StatusCode)
+	resp.Body.Close()
+	resp.Body = http.NoBody
+	resp.ContentLength = 0
+	resp.StatusCode = http.StatusOK
+	resp.Status = "200 OK"
+	resp.Header = http.Header{}
+	resp.Trailer = nil
+	setGRPCStatus(resp.Header, code, message)
+	return true
+}
+
+// grpcTimeout parses a grpc-timeout header: up to eight digits followed by
+// a unit of H, M, S, m, u or n.
+func grpcTimeout(value string) (time.Duration, bool) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, false
+	}
+	amount, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if err != nil || amount < 0 {
+		return 0, false
+	}
+
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	unit, ok := units[value[len(value)-1]]
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(amount) * unit, true
+}
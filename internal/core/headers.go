@@ -0,0 +1,71 @@
+package core
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+)
+
+// headerVars holds the per-request values available to header rules.
+type headerVars map[string]string
+
+// expand replaces $name and ${name} with the value of the variable. Unknown
+// variables, and a $ not followed by a name, are left as written.
+func (hv headerVars) expand(value string) string {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(value, '$')
+		if i < 0 {
+			b.WriteString(value)
+			return b.String()
+		}
+		b.WriteString(value[:i])
+		value = value[i:]
+
+		name, end := "", 1
+		if strings.HasPrefix(value, "${") {
+			if closing := strings.IndexByte(value, '}'); closing > 0 {
+				name, end = value[2:closing], closing+1
+			}
+		} else {
+			for end < len(value) && isVarByte(value[end]) {
+				end++
+			}
+			name = value[1:end]
+		}
+
+		if v, ok := hv[name]; ok && name != "" {
+			b.WriteString(v)
+		} else {
+			b.WriteString(value[:end])
+		}
+		value = value[end:]
+	}
+}
+
+func isVarByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// applyHeaderRules applies each set of rules in order, so later, more
+// specific rules win.
+func applyHeaderRules(h http.Header, vars headerVars, rules ...*config.HeaderRules) {
+	for _, rule := range rules {
+		if rule == nil {
+			continue
+		}
+
+		for _, name := range rule.Remove {
+			h.Del(name)
+		}
+
+		for name, value := range rule.Set {
+			h.Set(name, vars.expand(value))
+		}
+
+		for name, value := range rule.Add {
+			h.Add(name, vars.expand(value))
+		}
+	}
+}
@@ -2,29 +2,70 @@ package core
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httputil"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/farhapartex/bolt-load-balancer/internal/config"
-	"github.com/farhapartex/bolt-load-balancer/internal/health"
 	"github.com/farhapartex/bolt-load-balancer/internal/loadbalancer"
 	"github.com/farhapartex/bolt-load-balancer/internal/logger"
+	"github.com/farhapartex/bolt-load-balancer/internal/tracing"
 )
 
+// routingState holds everything a configuration reload replaces. Each request
+// uses the state that was current when it arrived.
+type routingState struct {
+	config         *config.Config
+	pools          []*Pool
+	router         *Router
+	trustedProxies TrustedProxies
+}
+
 type LB struct {
-	config        *config.Config
-	backendPool   *loadbalancer.BackendPool
-	algorithm     loadbalancer.Algorithm
-	healthChecker *health.HealthChecker
-	logger        *logger.Logger
-	httpServer    *http.Server
+	state        atomic.Pointer[routingState]
+	metrics      *lbMetrics
+	events       *eventHub
+	tracer       *tracing.Tracer
+	startTime    time.Time
+	configMutex  sync.RWMutex
+	configHash   string
+	started      bool
+	logger       *logger.Logger
+	httpServer   *http.Server
+	adminHandler http.Handler
+	adminServer  *http.Server
+	adminAuth    *adminAuth
+	adminTLS     *tls.Config
+	certs        *certStore
+	acme         *acmeManager
+
+	redirectServer *http.Server
+}
+
+func (lb *LB) current() *routingState {
+	return lb.state.Load()
+}
+
+func (lb *LB) currentPools() []*Pool {
+	return lb.current().pools
+}
+
+func (lb *LB) backendCounts() (healthy int, total int) {
+	for _, pool := range lb.current().pools {
+		healthy += pool.backendPool.HealthySize()
+		total += pool.backendPool.Size()
+	}
+	return healthy, total
 }
 
 func (lb *LB) handleHealthEndpoint(w http.ResponseWriter, r *http.Request) {
-	healthyBackends := lb.backendPool.HealthySize()
-	totalBackends := lb.backendPool.Size()
+	healthyBackends, totalBackends := lb.backendCounts()
 
 	if healthyBackends == 0 {
 		w.WriteHeader(http.StatusServiceUnavailable)
@@ -35,65 +76,185 @@ func (lb *LB) handleHealthEndpoint(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "HEALTHY: %d/%d backends available", healthyBackends, totalBackends)
 }
 
-func (lb *LB) handleStatusEndpoint(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	status := lb.healthChecker.GetHealthStatus(lb.backendPool)
-	status["load_balancer"] = map[string]interface{}{
-		"version":   "0.1.0",
-		"algorithm": lb.algorithm.Name(),
-		"uptime":    time.Since(time.Now()).String(), // Will be implemented properly in future versions
+func (lb *LB) logRequest(lgr *logger.Logger, r *http.Request, statusCode int, duration time.Duration, fields ...map[string]interface{}) {
+	userAgent := r.Header.Get("User-Agent")
+	if userAgent == "" {
+		userAgent = "-"
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{
-		"status": "ok",
-		"healthy_backends": %d,
-		"total_backends": %d,
-		"algorithm": "%s"
-	}`, lb.backendPool.HealthySize(), lb.backendPool.Size(), lb.algorithm.Name())
+	lgr.LogRequest(r.Method, r.URL.Path, r.RemoteAddr, userAgent, statusCode, duration, fields...)
 }
 
-func (lb *LB) logRequest(r *http.Request, statusCode int, duration time.Duration) {
-	userAgent := r.Header.Get("User-Agent")
-	if userAgent == "" {
-		userAgent = "-"
+// tagRequest reuses the request ID sent by the client or generates a new one,
+// forwards it upstream and echoes it in the response. It returns a logger that
+// adds the ID to every line logged for the request.
+func (lb *LB) tagRequest(w http.ResponseWriter, r *http.Request, conf config.RequestIDConfig) (*logger.Logger, string) {
+	if !conf.Enabled {
+		return lb.logger, r.Header.Get(conf.Header)
+	}
+
+	header := conf.Header
+	requestID := r.Header.Get(header)
+	if !validRequestID(requestID) {
+		requestID = newRequestID(conf.Format)
 	}
 
-	lb.logger.LogRequest(r.Method, r.URL.Path, r.RemoteAddr, userAgent, statusCode, duration)
+	r.Header.Set(header, requestID)
+	w.Header().Set(header, requestID)
+
+	return lb.logger.With(map[string]interface{}{"request_id": requestID}), requestID
+}
+
+// isStreaming reports whether the backend answered with a long-lived
+// stream, a gRPC call or server-sent events. It goes by the response, as
+// the request headers are up to the client.
+func isStreaming(resp *http.Response) bool {
+	contentType := resp.Header.Get("Content-Type")
+	return isGRPCContentType(contentType) || strings.HasPrefix(contentType, "text/event-stream")
 }
 
 func (lb *LB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	start_time := time.Now()
+	state := lb.current()
+	conf := state.config
+
+	if r.TLS != nil && conf.Server.HSTS != nil {
+		w.Header().Set("Strict-Transport-Security", conf.Server.HSTS.HeaderValue())
+	}
+
+	if lb.servePublicEndpoint(w, r, conf) {
+		return
+	}
 
-	if r.URL.Path == "/health" {
-		lb.handleHealthEndpoint(w, r)
+	lb.metrics.inFlight.Add(1)
+	defer lb.metrics.inFlight.Add(-1)
+
+	reqLogger, requestID := lb.tagRequest(w, r, conf.RequestID)
+	forwarding := newForwardingInfo(r, state.trustedProxies)
+	serverSpan := lb.startServerSpan(r, forwarding.clientIP, requestID)
+	vars := headerVars{
+		"remote_addr": forwarding.clientIP,
+		"host":        r.Host,
+		"scheme":      forwarding.proto,
+		"request_uri": r.URL.RequestURI(),
+		"request_id":  requestID,
+		"pool":        "",
+		"route":       "",
+		"backend_url": "",
+	}
+
+	route := state.router.Match(r)
+	if route == nil {
+		applyHeaderRules(w.Header(), vars, conf.ResponseHeaders)
+		writeError(w, r, "Not Found", http.StatusNotFound)
+		endSpan(serverSpan, http.StatusNotFound, http.StatusInternalServerError)
+		lb.metrics.observeRequest(noBackend, noBackend, r.Method, http.StatusNotFound, time.Since(start_time))
+		lb.publishRequest(r, requestID, forwarding.clientIP, noBackend, noBackend, http.StatusNotFound, time.Since(start_time))
+		lb.logRequest(reqLogger, r, http.StatusNotFound, time.Since(start_time))
 		return
 	}
+	pool := route.Pool()
+	vars["pool"] = pool.name
+	vars["route"] = route.name
+	serverSpan.SetName(r.Method + " " + route.name)
+	serverSpan.SetAttribute("http.route", route.name)
+	serverSpan.SetAttribute("bolt.pool", pool.name)
 
-	if r.URL.Path == "/status" {
-		lb.handleStatusEndpoint(w, r)
+	certPolicy := clientCertPolicy(conf.Server.TLS, route)
+	clientCert := verifiedClientCert(r.TLS)
+	if certPolicy == config.ClientCertRequired && clientCert == nil {
+		applyHeaderRules(w.Header(), vars, conf.ResponseHeaders, route.responseHeaders)
+		writeError(w, r, "Client Certificate Required", http.StatusForbidden)
+		endSpan(serverSpan, http.StatusForbidden, http.StatusInternalServerError)
+		lb.metrics.observeRequest(pool.name, noBackend, r.Method, http.StatusForbidden, time.Since(start_time))
+		lb.publishRequest(r, requestID, forwarding.clientIP, pool.name, noBackend, http.StatusForbidden, time.Since(start_time))
+		lb.logRequest(reqLogger, r, http.StatusForbidden, time.Since(start_time))
 		return
 	}
+	if certPolicy == config.ClientCertNone {
+		clientCert = nil
+	}
 
-	backend := lb.algorithm.NextBackend(lb.backendPool.GetBackends())
+	backend := pool.NextBackend()
 	if backend == nil {
-		lb.logger.Warn("No healthy backends available")
-		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
-		lb.logRequest(r, http.StatusServiceUnavailable, time.Since(start_time))
+		reqLogger.Warnf("No healthy backends available in pool %s", pool.name)
+		applyHeaderRules(w.Header(), vars, conf.ResponseHeaders, route.responseHeaders)
+		writeError(w, r, "Service Unavailable", http.StatusServiceUnavailable)
+		endSpan(serverSpan, http.StatusServiceUnavailable, http.StatusInternalServerError)
+		lb.metrics.observeRequest(pool.name, noBackend, r.Method, http.StatusServiceUnavailable, time.Since(start_time))
+		lb.publishRequest(r, requestID, forwarding.clientIP, pool.name, noBackend, http.StatusServiceUnavailable, time.Since(start_time))
+		lb.logRequest(reqLogger, r, http.StatusServiceUnavailable, time.Since(start_time))
 		return
 	}
+	backendURL := backend.URL.String()
+	serverSpan.SetAttribute("bolt.backend", backendURL)
+	backend.StartRequest()
+	defer backend.EndRequest()
+
+	upstreamPath := route.RewritePath(r.URL.Path)
+
+	backendConfig := pool.configFor(backend)
+	vars["backend_url"] = backendURL
+
+	var clientSpan *tracing.Span
+	// mappedStatus is the HTTP status behind a gRPC error bolt answered
+	// with, which goes out as a trailers-only 200.
+	mappedStatus := 0
 
 	proxy := httputil.NewSingleHostReverseProxy(backend.URL)
+	proxy.Transport = backend.Transport()
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		// Only bolt sets X-Original-URI; a client's value is never passed on.
+		req.Header.Del("X-Original-URI")
+		if upstreamPath != req.URL.Path {
+			req.Header.Set("X-Original-URI", req.URL.RequestURI())
+			path, query, hasQuery := strings.Cut(upstreamPath, "?")
+			req.URL.Path = path
+			req.URL.RawPath = ""
+			if hasQuery && req.URL.RawQuery != "" {
+				req.URL.RawQuery = query + "&" + req.URL.RawQuery
+			} else if hasQuery {
+				req.URL.RawQuery = query
+			}
+		}
+		director(req)
+		forwarding.apply(req.Header, conf.Server.ForwardedHeader)
+		if conf.Server.TLS != nil && conf.Server.TLS.ClientAuth != nil {
+			setClientCertHeaders(req.Header, conf.Server.TLS.ClientAuth.Headers, clientCert)
+		}
+		applyHeaderRules(req.Header, vars, conf.RequestHeaders, route.requestHeaders, backendConfig.RequestHeaders)
+
+		clientSpan = lb.startClientSpan(serverSpan, req, pool, backendURL)
+		clientSpan.Inject(req.Header)
+	}
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-		lb.logger.LogBackendRequest(backend.URL.String(), r.Method, r.URL.Path, 0, time.Since(start_time), err)
-		backend.MarkUnhealthy()
-		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		reqLogger.LogBackendRequest(backendURL, r.Method, r.URL.Path, 0, time.Since(start_time), err)
+		clientSpan.SetStatus(tracing.StatusError, err.Error())
+		clientSpan.End()
+		applyHeaderRules(w.Header(), vars, conf.ResponseHeaders, route.responseHeaders, backendConfig.ResponseHeaders)
+		if !isGRPC(r) {
+			backend.MarkUnhealthy()
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+			return
+		}
+		// Deadlines and cancellations come from the caller, not the backend.
+		if r.Context().Err() == nil {
+			backend.MarkUnhealthy()
+		}
+		code, message, status := grpcStatusForError(err)
+		mappedStatus = status
+		writeGRPCStatus(w, code, message)
 	}
 
+	var upstream_start time.Time
 	proxy.ModifyResponse = func(resp *http.Response) error {
 		duration := time.Since(start_time)
-		lb.logger.LogBackendRequest(backend.URL.String(), r.Method, r.URL.Path, resp.StatusCode, duration, nil)
+		upstreamLatency := time.Since(upstream_start)
+		backend.RecordLatency(upstreamLatency)
+		lb.metrics.upstreamLatency.Observe(upstreamLatency.Seconds(), pool.name, backendURL)
+		reqLogger.LogBackendRequest(backendURL, r.Method, r.URL.Path, resp.StatusCode, duration, nil)
+		endSpan(clientSpan, resp.StatusCode, http.StatusBadRequest)
 
 		if resp.StatusCode < 500 {
 			backend.MarkHealthy()
@@ -101,66 +262,255 @@ func (lb *LB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			backend.MarkUnhealthy()
 		}
 
+		if isStreaming(resp) {
+			// server.read_timeout and server.write_timeout bound ordinary
+			// requests; streams end when the client or the backend ends
+			// them. Only a gRPC call still reads its request once the
+			// backend has accepted it.
+			controller := http.NewResponseController(w)
+			controller.SetWriteDeadline(time.Time{})
+			if isGRPC(r) && r.ProtoMajor == 2 {
+				controller.SetReadDeadline(time.Time{})
+			}
+		}
+		if status := resp.StatusCode; isGRPC(r) && grpcResponseFromHTTP(resp) {
+			mappedStatus = status
+		}
+		if conf.RequestID.Enabled {
+			// The ID is already set on the response writer.
+			resp.Header.Del(conf.RequestID.Header)
+		}
+		if r.TLS != nil && conf.Server.HSTS != nil {
+			// bolt's policy replaces the backend's.
+			resp.Header.Del("Strict-Transport-Security")
+		}
+		applyHeaderRules(resp.Header, vars, conf.ResponseHeaders, route.responseHeaders, backendConfig.ResponseHeaders)
 		return nil
 	}
-	r.Header.Set("X-Forwarded-For", r.RemoteAddr)
-	r.Header.Set("X-Forwarded-Proto", "http")
-	if r.Header.Get("X-Real-IP") == "" {
-		r.Header.Set("X-Real-IP", r.RemoteAddr)
+
+	logFields := map[string]interface{}{"client_ip": forwarding.clientIP}
+	if upstreamPath != r.URL.Path {
+		logFields["upstream_path"] = upstreamPath
+	}
+
+	if timeout, ok := grpcTimeout(r.Header.Get("Grpc-Timeout")); ok && isGRPC(r) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
 	}
 
 	// Forward the request to the backend
-	proxy.ServeHTTP(w, r)
-	lb.logRequest(r, http.StatusOK, time.Since(start_time))
+	recorder := newResponseRecorder(w)
+	upstream_start = time.Now()
+	proxy.ServeHTTP(recorder, r)
+	status := recorder.Status()
+	if mappedStatus != 0 {
+		status = mappedStatus
+	}
+	backend.CountRequest(status >= 500)
+
+	duration := time.Since(start_time)
+	endSpan(serverSpan, status, http.StatusInternalServerError)
+	lb.metrics.observeRequest(pool.name, backendURL, r.Method, status, duration)
+	lb.publishRequest(r, requestID, forwarding.clientIP, pool.name, backendURL, status, duration)
+	lb.logRequest(reqLogger, r, status, duration, logFields)
+}
+
+// Logger returns the logger used for request, health and audit logs.
+func (lb *LB) Logger() *logger.Logger {
+	return lb.logger
 }
 
 func (lb *LB) Start() error {
-	lb.logger.Infof("Starting load balancer on %s", lb.httpServer.Addr)
-	lb.logger.Infof("Using %s algorithm with %d backends", lb.algorithm.Name(), lb.backendPool.Size())
+	adminListeners, err := lb.listenAdmin()
+	if err != nil {
+		return err
+	}
+	redirectListener, err := lb.listenRedirect()
+	if err != nil {
+		for _, listener := range adminListeners {
+			listener.Close()
+		}
+		return err
+	}
+	lb.serveAdmin(adminListeners)
+	lb.serveRedirect(redirectListener)
 
-	lb.healthChecker.Start(lb.backendPool)
+	lb.logger.Infof("Starting load balancer on %s", lb.httpServer.Addr)
+	lb.configMutex.Lock()
+	lb.startHealthChecks(lb.current().pools)
+	lb.started = true
+	lb.configMutex.Unlock()
 	lb.logger.Info("Health checker started")
-	return lb.httpServer.ListenAndServe()
+
+	if lb.certs == nil {
+		return lb.httpServer.ListenAndServe()
+	}
+
+	// The listener must be up before ACME orders start, as the CA connects
+	// back to it for TLS-ALPN-01 challenges.
+	listener, err := net.Listen("tcp", lb.httpServer.Addr)
+	if err != nil {
+		return err
+	}
+	go lb.certs.watch(lb.current().config.Server.TLS.ReloadInterval)
+	if lb.acme != nil {
+		go lb.acme.run()
+	}
+	return lb.httpServer.ServeTLS(listener, "", "")
 }
 
 func (lb *LB) Stop(ctx context.Context) error {
 	lb.logger.Info("Shutting down load balancer...")
-	lb.healthChecker.Stop()
+	lb.configMutex.Lock()
+	lb.stopHealthChecks(lb.current().pools)
+	lb.started = false
+	lb.configMutex.Unlock()
 	lb.logger.Info("Health checker stopped")
+	if lb.certs != nil {
+		lb.certs.stop()
+	}
+	lb.acme.stop()
+	if err := lb.tracer.Shutdown(ctx); err != nil {
+		lb.logger.Errorf("Failed to flush traces: %v", err)
+	}
+	lb.events.close()
+	if err := lb.adminServer.Shutdown(ctx); err != nil {
+		lb.logger.Errorf("Failed to stop admin listener: %v", err)
+	}
+	if lb.redirectServer != nil {
+		if err := lb.redirectServer.Shutdown(ctx); err != nil {
+			lb.logger.Errorf("Failed to stop HTTP redirect listener: %v", err)
+		}
+	}
 	return lb.httpServer.Shutdown(ctx)
 }
 
-func NewLB(conf *config.Config) (*LB, error) {
-	backendPool := loadbalancer.NewBackendPool()
-
-	for _, be_config := range conf.Backends {
-		backend, err := loadbalancer.NewBackend(
-			be_config.URL,
-			be_config.Weight,
-			be_config.MaxFails,
-			be_config.FailTimeout,
-		)
+func (lb *LB) startHealthChecks(pools []*Pool) {
+	for _, pool := range pools {
+		lb.logger.Infof("Pool %s: using %s algorithm with %d backends", pool.name, pool.algorithm.Name(), pool.backendPool.Size())
+		pool.healthChecker.Start(pool.backendPool)
+	}
+}
+
+func (lb *LB) stopHealthChecks(pools []*Pool) {
+	for _, pool := range pools {
+		pool.healthChecker.Stop()
+	}
+}
+
+// newRoutingState builds pools, routes and proxy settings for conf. Backends
+// that also exist in previous keep their health, admin state and in-flight
+// counts; their new settings wait for applyUpdates.
+func newRoutingState(conf *config.Config, previous *routingState) (state *routingState, err error) {
+	previousPools := make(map[string]*Pool)
+	if previous != nil {
+		for _, pool := range previous.pools {
+			previousPools[pool.name] = pool
+		}
+	}
+
+	pools := make([]*Pool, 0, len(conf.Pools)+1)
+	poolsByName := make(map[string]*Pool)
+	defer func() {
+		if err != nil {
+			for _, pool := range pools {
+				pool.discardUpdates()
+			}
+		}
+	}()
+
+	for _, pool_config := range conf.EffectivePools() {
+		pool, err := newPool(pool_config, previousPools[pool_config.Name])
 		if err != nil {
-			return nil, fmt.Errorf("failed to create backend %s: %w", be_config.URL, err)
+			return nil, fmt.Errorf("pool %s: %w", pool_config.Name, err)
 		}
-		backendPool.AddBackend(backend)
+		pools = append(pools, pool)
+		poolsByName[pool.name] = pool
+	}
+
+	router, err := NewRouter(conf.Routes, poolsByName, conf.DefaultPoolFor())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create router: %w", err)
 	}
-	factory := loadbalancer.NewAlgorithmFactory()
-	algorithm, err := factory.CreateAlgorithm(conf.Strategy)
+
+	trustedProxies, err := ParseTrustedProxies(conf.Server.TrustedProxies)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create algorithm: %w", err)
+		return nil, err
+	}
+
+	if conf.Admin.Persist {
+		if err := conf.CanPersist(); err != nil {
+			return nil, fmt.Errorf("admin.persist cannot be used: %w", err)
+		}
+	}
+
+	return &routingState{
+		config:         conf,
+		pools:          pools,
+		router:         router,
+		trustedProxies: trustedProxies,
+	}, nil
+}
+
+// applyUpdates applies the new settings of backends carried over from the
+// previous state, once this state is in use.
+func (s *routingState) applyUpdates() {
+	for _, pool := range s.pools {
+		pool.applyUpdates()
+	}
+}
+
+// closeDropped closes the transports of backends in previous that this
+// state did not carry over. Requests still running on them keep their
+// connections.
+func (s *routingState) closeDropped(previous *routingState) {
+	kept := make(map[*loadbalancer.Backend]bool)
+	for _, pool := range s.pools {
+		for _, backend := range pool.backendPool.GetBackends() {
+			kept[backend] = true
+		}
+	}
+	for _, pool := range previous.pools {
+		for _, backend := range pool.backendPool.GetBackends() {
+			if !kept[backend] {
+				closeTransport(backend.Transport())
+			}
+		}
+	}
+}
+
+func NewLB(conf *config.Config) (*LB, error) {
+	state, err := newRoutingState(conf, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	adminAuth, err := newAdminAuth(conf.Admin.Auth)
+	if err != nil {
+		return nil, err
+	}
+	adminTLS, err := newAdminTLSConfig(conf.Admin)
+	if err != nil {
+		return nil, err
 	}
 
-	healthChecker := health.NewHealthChecker(conf.HealthCheck)
 	lgr := logger.NewLogger(conf.Logging)
 
 	load_balance := &LB{
-		config:        conf,
-		backendPool:   backendPool,
-		algorithm:     algorithm,
-		healthChecker: healthChecker,
-		logger:        lgr,
+		events:     newEventHub(),
+		tracer:     tracing.NewTracer(conf.Tracing, lgr),
+		startTime:  time.Now(),
+		configHash: conf.Hash(),
+		adminAuth:  adminAuth,
+		adminTLS:   adminTLS,
+		logger:     lgr,
 	}
+	load_balance.state.Store(state)
+	load_balance.metrics = newLBMetrics(load_balance.currentPools)
+	load_balance.metrics.watchPools(state.pools)
+	load_balance.events.watchPools(state.pools)
+
 	load_balance.httpServer = &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", conf.Server.Host, conf.Server.Port),
 		Handler:      load_balance,
@@ -168,6 +518,47 @@ func NewLB(conf *config.Config) (*LB, error) {
 		WriteTimeout: conf.Server.WriteTimeout,
 		IdleTimeout:  conf.Server.IdleTimeout,
 	}
+	if conf.Server.H2C {
+		load_balance.httpServer.Protocols = new(http.Protocols)
+		load_balance.httpServer.Protocols.SetHTTP1(true)
+		load_balance.httpServer.Protocols.SetUnencryptedHTTP2(true)
+	}
+	if h2 := conf.Server.HTTP2; h2 != nil {
+		load_balance.httpServer.HTTP2 = &http.HTTP2Config{
+			MaxConcurrentStreams: h2.MaxConcurrentStreams,
+			SendPingTimeout:      h2.PingInterval,
+			PingTimeout:          h2.PingTimeout,
+		}
+	}
+	if conf.Server.TLS != nil {
+		load_balance.acme, err = newACMEManager(conf.Server.TLS.ACME, lgr)
+		if err != nil {
+			return nil, err
+		}
+		load_balance.certs, err = newCertStore(conf.Server.TLS, load_balance.acme, lgr)
+		if err != nil {
+			return nil, err
+		}
+		load_balance.httpServer.TLSConfig, err = newServerTLSConfig(conf.Server.TLS, load_balance.certs, load_balance.httpServer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if redirect := conf.Server.HTTPRedirect; redirect != nil {
+		load_balance.redirectServer = &http.Server{
+			Addr:         fmt.Sprintf("%s:%d", conf.Server.Host, redirect.Port),
+			Handler:      &httpsRedirect{conf: redirect, acme: load_balance.acme, next: load_balance},
+			ReadTimeout:  conf.Server.ReadTimeout,
+			WriteTimeout: conf.Server.WriteTimeout,
+			IdleTimeout:  conf.Server.IdleTimeout,
+		}
+	}
+	load_balance.adminHandler = load_balance.newAdminHandler(conf)
+	load_balance.adminServer = &http.Server{
+		Handler:     load_balance.adminHandler,
+		ReadTimeout: conf.Server.ReadTimeout,
+		IdleTimeout: conf.Server.IdleTimeout,
+	}
 
 	return load_balance, nil
 }
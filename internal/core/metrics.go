@@ -0,0 +1,117 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/health"
+	"github.com/farhapartex/bolt-load-balancer/internal/metrics"
+)
+
+// noBackend labels requests that were answered without reaching a backend.
+const noBackend = "none"
+
+type lbMetrics struct {
+	registry        *metrics.Registry
+	requests        *metrics.CounterVec
+	requestDuration *metrics.HistogramVec
+	upstreamLatency *metrics.HistogramVec
+	inFlight        *metrics.GaugeVec
+	healthChecks    *metrics.CounterVec
+	configReloads   *metrics.CounterVec
+}
+
+func (m *lbMetrics) observeRequest(pool, backend, method string, status int, duration time.Duration) {
+	m.requests.Inc(pool, backend, method, statusClass(status))
+	m.requestDuration.Observe(duration.Seconds(), pool, method)
+}
+
+func (m *lbMetrics) observeHealthCheck(pool string) health.Observer {
+	return func(result health.CheckResult) {
+		outcome := "success"
+		if !result.Healthy {
+			outcome = "failure"
+		}
+		m.healthChecks.Inc(pool, result.Backend.URL.String(), outcome)
+	}
+}
+
+// statusClass groups status codes as "2xx", "4xx" and so on.
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%dxx", status/100)
+}
+
+// watchPools counts the health checks of pools. It is called again for the
+// new pools after a configuration reload.
+func (m *lbMetrics) watchPools(pools []*Pool) {
+	for _, pool := range pools {
+		pool.healthChecker.AddObserver(m.observeHealthCheck(pool.name))
+	}
+}
+
+// newLBMetrics creates the load balancer's metrics. pools returns the pools
+// currently in use, which change when the configuration is reloaded.
+func newLBMetrics(pools func() []*Pool) *lbMetrics {
+	registry := metrics.NewRegistry()
+
+	m := &lbMetrics{
+		registry: registry,
+		requests: registry.NewCounterVec("bolt_requests_total",
+			"Requests handled, by pool, backend, method and status class.",
+			"pool", "backend", "method", "code"),
+		requestDuration: registry.NewHistogramVec("bolt_request_duration_seconds",
+			"Time from receiving a request to finishing its response.",
+			metrics.DefaultBuckets, "pool", "method"),
+		upstreamLatency: registry.NewHistogramVec("bolt_upstream_latency_seconds",
+			"Time from forwarding a request to receiving the backend's response headers.",
+			metrics.DefaultBuckets, "pool", "backend"),
+		inFlight: registry.NewGaugeVec("bolt_in_flight_requests",
+			"Requests currently being proxied."),
+		healthChecks: registry.NewCounterVec("bolt_health_checks_total",
+			"Active health checks, by pool, backend and result.",
+			"pool", "backend", "result"),
+		configReloads: registry.NewCounterVec("bolt_config_reloads_total",
+			"Configuration reloads, by result.",
+			"result"),
+	}
+
+	m.inFlight.Set(0)
+	m.configReloads.Add(0, "success")
+	m.configReloads.Add(0, "failure")
+
+	registry.NewGaugeFunc("bolt_backend_up",
+		"Whether a backend is currently considered healthy (1) or not (0).",
+		[]string{"pool", "backend"},
+		func(emit func(float64, ...string)) {
+			for _, pool := range pools() {
+				for _, backend := range pool.backendPool.GetBackends() {
+					up := 0.0
+					if backend.IsHealthy() {
+						up = 1
+					}
+					emit(up, pool.name, backend.URL.String())
+				}
+			}
+		})
+	registry.NewGaugeFunc("bolt_pool_backends",
+		"Backends configured in each pool.",
+		[]string{"pool"},
+		func(emit func(float64, ...string)) {
+			for _, pool := range pools() {
+				emit(float64(pool.backendPool.Size()), pool.name)
+			}
+		})
+	registry.NewGaugeFunc("bolt_pool_healthy_backends",
+		"Healthy backends in each pool.",
+		[]string{"pool"},
+		func(emit func(float64, ...string)) {
+			for _, pool := range pools() {
+				emit(float64(pool.backendPool.HealthySize()), pool.name)
+			}
+		})
+
+	return m
+}
@@ -0,0 +1,212 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+	"github.com/farhapartex/bolt-load-balancer/internal/health"
+	"github.com/farhapartex/bolt-load-balancer/internal/loadbalancer"
+)
+
+// Pool is a named set of backends balanced by its own algorithm and watched
+// by its own health checker.
+type Pool struct {
+	name          string
+	backendPool   *loadbalancer.BackendPool
+	algorithm     loadbalancer.Algorithm
+	healthChecker *health.HealthChecker
+	healthCheck   config.HealthCheckConfig
+
+	mutex         sync.RWMutex
+	backendConfig map[*loadbalancer.Backend]config.BackendConfig
+
+	// updates are pending until the reload that built the pool succeeds.
+	updates []backendUpdate
+}
+
+func (p *Pool) Name() string {
+	return p.name
+}
+
+func (p *Pool) NextBackend() *loadbalancer.Backend {
+	return p.algorithm.NextBackend(p.backendPool.GetBackends())
+}
+
+func (p *Pool) configFor(backend *loadbalancer.Backend) config.BackendConfig {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.backendConfig[backend]
+}
+
+func (p *Pool) addBackend(be_config config.BackendConfig) (*loadbalancer.Backend, error) {
+	backend, err := loadbalancer.NewBackend(
+		be_config.URL,
+		be_config.Weight,
+		be_config.MaxFails,
+		be_config.FailTimeout,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backend %s: %w", be_config.URL, err)
+	}
+	if be_config.Disabled {
+		backend.SetAdminState(loadbalancer.StateDisabled)
+	}
+	transport, err := newBackendTransport(be_config)
+	if err != nil {
+		return nil, fmt.Errorf("backend %s: %w", be_config.URL, err)
+	}
+	backend.SetTransport(transport)
+
+	p.adoptBackend(backend, be_config)
+	return backend, nil
+}
+
+// backendUpdate holds the settings a reload applies to a backend it keeps.
+// The backend is shared with the running pool, so they are only applied
+// once the reload can no longer fail.
+type backendUpdate struct {
+	backend   *loadbalancer.Backend
+	be_config config.BackendConfig
+	// transport replaces the backend's transport when set.
+	transport http.RoundTripper
+}
+
+// reuseBackend moves backend over from the pool it belonged to before a
+// reload, keeping its health and in-flight count. be_config is applied by
+// applyUpdates. Its transport, and with it open connections, is kept unless
+// the TLS, protocol or HTTP/2 settings changed from previous.
+func (p *Pool) reuseBackend(backend *loadbalancer.Backend, be_config, previous config.BackendConfig) error {
+	update := backendUpdate{backend: backend, be_config: be_config}
+	if !sameBackendTransport(be_config, previous) {
+		transport, err := newBackendTransport(be_config)
+		if err != nil {
+			return fmt.Errorf("backend %s: %w", be_config.URL, err)
+		}
+		update.transport = transport
+	}
+	p.updates = append(p.updates, update)
+
+	p.adoptBackend(backend, be_config)
+	return nil
+}
+
+// applyUpdates applies the settings of backends kept by a reload, once the
+// pool is in use.
+func (p *Pool) applyUpdates() {
+	for _, update := range p.updates {
+		backend, be_config := update.backend, update.be_config
+		if update.transport != nil {
+			closeTransport(backend.Transport())
+			backend.SetTransport(update.transport)
+		}
+
+		backend.Update(be_config.Weight, be_config.MaxFails, be_config.FailTimeout)
+		switch {
+		case be_config.Disabled:
+			backend.SetAdminState(loadbalancer.StateDisabled)
+		case backend.GetAdminState() == loadbalancer.StateDisabled:
+			backend.SetAdminState(loadbalancer.StateActive)
+		}
+	}
+	p.updates = nil
+}
+
+// discardUpdates drops the settings of a failed reload, closing transports
+// built for it, including those of backends the reload created.
+func (p *Pool) discardUpdates() {
+	reused := make(map[*loadbalancer.Backend]bool, len(p.updates))
+	for _, update := range p.updates {
+		reused[update.backend] = true
+		closeTransport(update.transport)
+	}
+	for _, backend := range p.backendPool.GetBackends() {
+		if !reused[backend] {
+			closeTransport(backend.Transport())
+		}
+	}
+	p.updates = nil
+}
+
+func (p *Pool) adoptBackend(backend *loadbalancer.Backend, be_config config.BackendConfig) {
+	p.mutex.Lock()
+	p.backendConfig[backend] = be_config
+	p.mutex.Unlock()
+	p.backendPool.AddBackend(backend)
+}
+
+func (p *Pool) removeBackend(backend *loadbalancer.Backend) {
+	p.backendPool.RemoveBackend(backend)
+	closeTransport(backend.Transport())
+	p.healthChecker.Forget(backend)
+	p.mutex.Lock()
+	delete(p.backendConfig, backend)
+	p.mutex.Unlock()
+}
+
+// findBackend looks a backend up by its ID or URL.
+func (p *Pool) findBackend(ref string) *loadbalancer.Backend {
+	for _, backend := range p.backendPool.GetBackends() {
+		url := backend.URL.String()
+		if ref == backendID(p.name, url) || strings.TrimSuffix(ref, "/") == strings.TrimSuffix(url, "/") {
+			return backend
+		}
+	}
+	return nil
+}
+
+// backendID derives a short identifier for a backend that stays the same
+// across restarts and can be used in URL paths.
+func backendID(pool, url string) string {
+	sum := sha256.Sum256([]byte(pool + "\x00" + url))
+	return hex.EncodeToString(sum[:6])
+}
+
+func NewPool(conf config.PoolConfig) (*Pool, error) {
+	return newPool(conf, nil)
+}
+
+// newPool builds a pool from conf. Backends found in previous, the pool of
+// the same name before a reload, are carried over instead of recreated.
+func newPool(conf config.PoolConfig, previous *Pool) (*Pool, error) {
+	factory := loadbalancer.NewAlgorithmFactory()
+	algorithm, err := factory.CreateAlgorithm(conf.Strategy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create algorithm: %w", err)
+	}
+
+	healthChecker := health.NewHealthChecker(*conf.HealthCheck)
+	healthChecker.SetUserAgent(fmt.Sprintf("BoltLoadBalancer/%s HealthChecker", Version))
+
+	pool := &Pool{
+		name:          conf.Name,
+		backendPool:   loadbalancer.NewBackendPool(),
+		algorithm:     algorithm,
+		healthChecker: healthChecker,
+		healthCheck:   *conf.HealthCheck,
+		backendConfig: make(map[*loadbalancer.Backend]config.BackendConfig, len(conf.Backends)),
+	}
+
+	for _, be_config := range conf.Backends {
+		if previous != nil {
+			if backend := previous.findBackend(be_config.URL); backend != nil {
+				if err := pool.reuseBackend(backend, be_config, previous.configFor(backend)); err != nil {
+					pool.discardUpdates()
+					return nil, err
+				}
+				pool.healthChecker.CopyHistory(previous.healthChecker, backend)
+				continue
+			}
+		}
+		if _, err := pool.addBackend(be_config); err != nil {
+			pool.discardUpdates()
+			return nil, err
+		}
+	}
+
+	return pool, nil
+}
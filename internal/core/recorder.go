@@ -0,0 +1,49 @@
+package core
+
+import "net/http"
+
+// responseRecorder remembers the status code written to the client. Unwrap
+// lets http.ResponseController reach the underlying writer for flushing and
+// hijacking.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	// Informational responses may precede the final status.
+	if rr.status == 0 && status >= 200 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	return rr.ResponseWriter.Write(b)
+}
+
+func (rr *responseRecorder) Flush() {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	http.NewResponseController(rr.ResponseWriter).Flush()
+}
+
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// Status returns the status sent to the client, or 200 if nothing was written.
+func (rr *responseRecorder) Status() int {
+	if rr.status == 0 {
+		return http.StatusOK
+	}
+	return rr.status
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w}
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+)
+
+// httpsRedirect answers the plain HTTP listener, sending clients to the
+// same host and path over HTTPS. Pending ACME HTTP-01 challenges are
+// answered directly and exempt paths are handled by next instead.
+type httpsRedirect struct {
+	conf *config.HTTPRedirectConfig
+	acme *acmeManager
+	next http.Handler
+}
+
+func (h *httpsRedirect) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.acme.serveHTTPChallenge(w, r) {
+		return
+	}
+	for _, prefix := range h.conf.ExemptPaths {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			h.next.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	host := r.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	if host == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if h.conf.HTTPSPort != 443 {
+		host += ":" + strconv.Itoa(h.conf.HTTPSPort)
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), h.conf.StatusCode)
+}
+
+// listenRedirect opens the HTTP redirect listener, if configured, so that
+// address conflicts fail Start.
+func (lb *LB) listenRedirect() (net.Listener, error) {
+	if lb.redirectServer == nil {
+		return nil, nil
+	}
+	return net.Listen("tcp", lb.redirectServer.Addr)
+}
+
+func (lb *LB) serveRedirect(listener net.Listener) {
+	if listener == nil {
+		return
+	}
+	lb.logger.Infof("Redirecting HTTP to HTTPS on %s", listener.Addr())
+	go func() {
+		if err := lb.redirectServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			lb.logger.Errorf("HTTP redirect listener on %s failed: %v", listener.Addr(), err)
+		}
+	}()
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+)
+
+// keepStartupSettings copies the settings that only take effect when bolt
+// starts from running into conf, so a reloaded configuration describes what
+// is actually running. Listener addresses, timeouts, TLS and HTTP/2
+// settings, the admin listener, metrics, tracing and logging need a restart
+// to change.
+func keepStartupSettings(conf, running *config.Config) {
+	conf.Server.Host = running.Server.Host
+	conf.Server.Port = running.Server.Port
+	conf.Server.ReadTimeout = running.Server.ReadTimeout
+	conf.Server.WriteTimeout = running.Server.WriteTimeout
+	conf.Server.IdleTimeout = running.Server.IdleTimeout
+	conf.Server.TLS = running.Server.TLS
+	conf.Server.HTTPRedirect = running.Server.HTTPRedirect
+	conf.Server.H2C = running.Server.H2C
+	conf.Server.HTTP2 = running.Server.HTTP2
+	conf.Admin = running.Admin
+	conf.Metrics = running.Metrics
+	conf.Tracing = running.Tracing
+	conf.Logging = running.Logging
+}
+
+// Reload re-reads the configuration file and replaces pools, routes, header
+// rules and proxy settings. Backends present before and after the reload
+// keep their health, drain state and in-flight requests. On error the
+// running configuration is left untouched. TLS certificates are reloaded
+// from their files as well.
+func (lb *LB) Reload() error {
+	if lb.certs != nil {
+		if err := lb.certs.reload(); err != nil {
+			lb.logger.Errorf("Failed to reload certificates: %v", err)
+		}
+	}
+
+	err := lb.reload()
+	if err != nil {
+		lb.metrics.configReloads.Inc("failure")
+		lb.logger.Errorf("Configuration reload failed: %v", err)
+		lb.events.publish(Event{Type: EventReload, Time: time.Now(), Result: "failure", ConfigHash: lb.ConfigHash(), Error: err.Error()})
+		return err
+	}
+	lb.metrics.configReloads.Inc("success")
+	lb.logger.Infof("Configuration reloaded, config hash %s", lb.ConfigHash())
+	lb.events.publish(Event{Type: EventReload, Time: time.Now(), Result: "success", ConfigHash: lb.ConfigHash()})
+	return nil
+}
+
+func (lb *LB) reload() error {
+	lb.configMutex.Lock()
+	defer lb.configMutex.Unlock()
+
+	previous := lb.current()
+	conf, err := previous.config.Reload()
+	if err != nil {
+		return err
+	}
+	keepStartupSettings(conf, previous.config)
+
+	state, err := newRoutingState(conf, previous)
+	if err != nil {
+		return err
+	}
+	lb.metrics.watchPools(state.pools)
+	lb.events.watchPools(state.pools)
+
+	if lb.started {
+		lb.stopHealthChecks(previous.pools)
+	}
+	lb.state.Store(state)
+	state.applyUpdates()
+	state.closeDropped(previous)
+	lb.configHash = conf.Hash()
+	if lb.started {
+		lb.startHealthChecks(state.pools)
+	}
+	return nil
+}
+
+// ReloadResult is returned by POST /admin/reload.
+type ReloadResult struct {
+	ConfigHash string   `json:"config_hash"`
+	Pools      []string `json:"pools"`
+}
+
+func (lb *LB) handleReload(w http.ResponseWriter, r *http.Request) {
+	if err := lb.Reload(); err != nil {
+		writeAPIError(w, newAPIError(http.StatusBadRequest, "reload failed: %v", err))
+		return
+	}
+
+	resp := ReloadResult{ConfigHash: lb.ConfigHash()}
+	for _, pool := range lb.current().pools {
+		resp.Pools = append(resp.Pools, pool.name)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
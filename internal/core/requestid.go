@@ -0,0 +1,73 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const maxRequestIDLength = 128
+
+// newRequestID generates a time-ordered request ID in the given format.
+func newRequestID(format string) string {
+	if format == "ulid" {
+		return newULID(time.Now())
+	}
+	return newUUIDv7(time.Now())
+}
+
+// newUUIDv7 returns an RFC 9562 version 7 UUID: a 48-bit Unix millisecond
+// timestamp followed by random bits.
+func newUUIDv7(now time.Time) string {
+	var b [16]byte
+	rand.Read(b[6:])
+
+	ms := uint64(now.UnixMilli())
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+	b[6] = (b[6] & 0x0f) | 0x70
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a ULID: a 48-bit millisecond timestamp and 80 random bits
+// encoded as 26 Crockford base32 characters.
+func newULID(now time.Time) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[0:8], uint64(now.UnixMilli())<<16)
+	rand.Read(b[6:])
+
+	var out [26]byte
+	// 128 bits are encoded as 26 five-bit groups, the first holding only
+	// the top 3 bits.
+	hi := binary.BigEndian.Uint64(b[0:8])
+	lo := binary.BigEndian.Uint64(b[8:16])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockfordAlphabet[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// validRequestID reports whether an incoming ID is safe to reuse in headers
+// and logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
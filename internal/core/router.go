@@ -0,0 +1,192 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+)
+
+// Route is a compiled routing rule: the conditions a request must meet and
+// the pool and path rewriting that apply to it.
+type Route struct {
+	name       string
+	host       string
+	pathPrefix string
+	pathRegex  *regexp.Regexp
+	methods    map[string]bool
+	headers    map[string]string
+	pool       *Pool
+
+	stripPrefix    string
+	addPrefix      string
+	rewritePattern *regexp.Regexp
+	rewriteTo      string
+
+	requestHeaders  *config.HeaderRules
+	responseHeaders *config.HeaderRules
+
+	clientCert string
+}
+
+func (rt *Route) Name() string {
+	return rt.name
+}
+
+func (rt *Route) Pool() *Pool {
+	return rt.pool
+}
+
+// RewritePath returns the path to send upstream for a request to path. A
+// rewrite may introduce a query string, which is merged with the original
+// query when the request is proxied.
+func (rt *Route) RewritePath(path string) string {
+	if rt.stripPrefix != "" && strings.HasPrefix(path, rt.stripPrefix) {
+		path = path[len(rt.stripPrefix):]
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+	}
+
+	if rt.rewritePattern != nil {
+		path = rt.rewritePattern.ReplaceAllString(path, rt.rewriteTo)
+	}
+
+	if rt.addPrefix != "" {
+		path = strings.TrimSuffix(rt.addPrefix, "/") + path
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+func (rt *Route) matches(r *http.Request) bool {
+	if rt.host != "" && !matchHost(rt.host, r.Host) {
+		return false
+	}
+
+	if rt.pathPrefix != "" && !strings.HasPrefix(r.URL.Path, rt.pathPrefix) {
+		return false
+	}
+
+	if rt.pathRegex != nil && !rt.pathRegex.MatchString(r.URL.Path) {
+		return false
+	}
+
+	if len(rt.methods) > 0 && !rt.methods[r.Method] {
+		return false
+	}
+
+	for name, value := range rt.headers {
+		values, ok := r.Header[http.CanonicalHeaderKey(name)]
+		if !ok {
+			return false
+		}
+		if value != "" && values[0] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchHost(pattern, hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	pattern = strings.ToLower(pattern)
+
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	return host == pattern
+}
+
+// Router picks the route for a request from an ordered list; the first
+// matching route wins and unmatched requests use the default route.
+type Router struct {
+	routes       []*Route
+	defaultRoute *Route
+}
+
+// Match returns the route for r, or nil when no route matches and there is
+// no default pool.
+func (rt *Router) Match(r *http.Request) *Route {
+	for _, route := range rt.routes {
+		if route.matches(r) {
+			return route
+		}
+	}
+	return rt.defaultRoute
+}
+
+func NewRouter(routes []config.RouteConfig, pools map[string]*Pool, defaultPool string) (*Router, error) {
+	router := &Router{}
+
+	if defaultPool != "" {
+		pool, ok := pools[defaultPool]
+		if !ok {
+			return nil, fmt.Errorf("unknown default pool %q", defaultPool)
+		}
+		router.defaultRoute = &Route{name: "default", pool: pool}
+	}
+
+	for i, rc := range routes {
+		pool, ok := pools[rc.Pool]
+		if !ok {
+			return nil, fmt.Errorf("route %d: unknown pool %q", i, rc.Pool)
+		}
+
+		compiled := &Route{
+			name:        rc.Name,
+			host:        rc.Match.Host,
+			pathPrefix:  rc.Match.PathPrefix,
+			headers:     rc.Match.Headers,
+			pool:        pool,
+			stripPrefix: rc.StripPrefix,
+			addPrefix:   rc.AddPrefix,
+
+			requestHeaders:  rc.RequestHeaders,
+			responseHeaders: rc.ResponseHeaders,
+			clientCert:      rc.ClientCert,
+		}
+		if compiled.name == "" {
+			compiled.name = fmt.Sprintf("route-%d", i)
+		}
+
+		if rc.Rewrite != nil {
+			re, err := regexp.Compile(rc.Rewrite.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("route %d: invalid rewrite pattern: %w", i, err)
+			}
+			compiled.rewritePattern = re
+			compiled.rewriteTo = rc.Rewrite.Replacement
+		}
+
+		if rc.Match.PathRegex != "" {
+			re, err := regexp.Compile(rc.Match.PathRegex)
+			if err != nil {
+				return nil, fmt.Errorf("route %d: invalid path regex: %w", i, err)
+			}
+			compiled.pathRegex = re
+		}
+
+		if len(rc.Match.Methods) > 0 {
+			compiled.methods = make(map[string]bool, len(rc.Match.Methods))
+			for _, method := range rc.Match.Methods {
+				compiled.methods[strings.ToUpper(method)] = true
+			}
+		}
+
+		router.routes = append(router.routes, compiled)
+	}
+
+	return router, nil
+}
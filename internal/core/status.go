@@ -0,0 +1,213 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/loadbalancer"
+)
+
+// Version is the build version reported by /status and in the health
+// checker's User-Agent. main sets it from its VERSION constant.
+var Version = "dev"
+
+// StatusSchemaVersion is incremented whenever a field of StatusReport changes
+// meaning or is removed. New fields may be added without a version bump.
+const StatusSchemaVersion = 1
+
+// StatusReport is the JSON document served by the status endpoint.
+type StatusReport struct {
+	SchemaVersion    int          `json:"schema_version"`
+	Status           string       `json:"status"`
+	Version          string       `json:"version"`
+	StartTime        time.Time    `json:"start_time"`
+	UptimeSeconds    float64      `json:"uptime_seconds"`
+	ConfigHash       string       `json:"config_hash"`
+	HealthyBackends  int          `json:"healthy_backends"`
+	TotalBackends    int          `json:"total_backends"`
+	InFlightRequests int64        `json:"in_flight_requests"`
+	Pools            []PoolStatus `json:"pools"`
+	// ACME is set when certificates are obtained automatically.
+	ACME *ACMEStatus `json:"acme,omitempty"`
+}
+
+type PoolStatus struct {
+	Name            string            `json:"name"`
+	Algorithm       string            `json:"algorithm"`
+	HealthyBackends int               `json:"healthy_backends"`
+	TotalBackends   int               `json:"total_backends"`
+	HealthCheck     HealthCheckStatus `json:"health_check"`
+	Backends        []BackendStatus   `json:"backends"`
+}
+
+type HealthCheckStatus struct {
+	Enabled        bool   `json:"enabled"`
+	Type           string `json:"type"`
+	Interval       string `json:"interval"`
+	Timeout        string `json:"timeout"`
+	Path           string `json:"path"`
+	ExpectedStatus int    `json:"expected_status"`
+}
+
+type BackendStatus struct {
+	ID               string     `json:"id"`
+	Pool             string     `json:"pool"`
+	URL              string     `json:"url"`
+	Status           string     `json:"status"`
+	State            string     `json:"state"`
+	Healthy          bool       `json:"healthy"`
+	Weight           int        `json:"weight"`
+	FailCount        int        `json:"fail_count"`
+	MaxFails         int        `json:"max_fails"`
+	LastCheck        *time.Time `json:"last_check,omitempty"`
+	LastCheckError   string     `json:"last_check_error,omitempty"`
+	InFlightRequests int64      `json:"in_flight_requests"`
+	Requests         int64      `json:"requests"`
+	FailedRequests   int64      `json:"failed_requests"`
+	LatencyMs        float64    `json:"latency_ms"`
+	Source           string     `json:"source,omitempty"`
+
+	// RecentChecks is only filled in when /status is called with
+	// ?history=true.
+	RecentChecks []HealthCheckRecord `json:"recent_checks,omitempty"`
+}
+
+// HealthCheckRecord is one entry of a backend's health check history.
+type HealthCheckRecord struct {
+	Time       time.Time `json:"time"`
+	Healthy    bool      `json:"healthy"`
+	DurationMs float64   `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// overallStatus is "ok" when every backend is healthy, "degraded" when only
+// some are and "unavailable" when none are.
+func overallStatus(healthy, total int) string {
+	switch {
+	case total > 0 && healthy == total:
+		return "ok"
+	case healthy > 0:
+		return "degraded"
+	default:
+		return "unavailable"
+	}
+}
+
+func (p *Pool) status(withHistory bool) PoolStatus {
+	backends := p.backendPool.GetBackends()
+	pool := PoolStatus{
+		Name:          p.name,
+		Algorithm:     p.algorithm.Name(),
+		TotalBackends: len(backends),
+		HealthCheck: HealthCheckStatus{
+			Enabled:        p.healthCheck.Enabled,
+			Type:           p.healthCheck.Type,
+			Interval:       p.healthCheck.Interval.String(),
+			Timeout:        p.healthCheck.Timeout.String(),
+			Path:           p.healthCheck.Path,
+			ExpectedStatus: p.healthCheck.ExpectedStatus,
+		},
+		Backends: make([]BackendStatus, 0, len(backends)),
+	}
+
+	for _, backend := range backends {
+		status := p.backendStatus(backend)
+		if withHistory {
+			status.RecentChecks = p.checkHistory(backend)
+		}
+		if status.Healthy {
+			pool.HealthyBackends++
+		}
+		pool.Backends = append(pool.Backends, status)
+	}
+
+	return pool
+}
+
+func (p *Pool) backendStatus(backend *loadbalancer.Backend) BackendStatus {
+	status := BackendStatus{
+		ID:               backendID(p.name, backend.URL.String()),
+		Pool:             p.name,
+		URL:              backend.URL.String(),
+		Status:           backend.GetStatus().String(),
+		State:            backend.GetAdminState().String(),
+		Healthy:          backend.IsHealthy(),
+		Weight:           backend.GetWeight(),
+		FailCount:        backend.GetFailCount(),
+		MaxFails:         backend.MaxFails,
+		InFlightRequests: backend.ActiveRequests(),
+		LatencyMs:        float64(backend.Latency().Microseconds()) / 1000,
+		Source:           p.configFor(backend).Source,
+	}
+	status.Requests, status.FailedRequests = backend.RequestCounts()
+	if result, ok := p.healthChecker.LastResult(backend); ok {
+		lastCheck := result.Time
+		status.LastCheck = &lastCheck
+		if result.Err != nil {
+			status.LastCheckError = result.Err.Error()
+		}
+	}
+	return status
+}
+
+func (p *Pool) checkHistory(backend *loadbalancer.Backend) []HealthCheckRecord {
+	results := p.healthChecker.History(backend)
+	records := make([]HealthCheckRecord, 0, len(results))
+	for _, result := range results {
+		record := HealthCheckRecord{
+			Time:       result.Time,
+			Healthy:    result.Healthy,
+			DurationMs: float64(result.Duration.Microseconds()) / 1000,
+		}
+		if result.Err != nil {
+			record.Error = result.Err.Error()
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// Status builds the report served by the status endpoint.
+func (lb *LB) Status() StatusReport {
+	return lb.status(false)
+}
+
+func (lb *LB) status(withHistory bool) StatusReport {
+	pools := lb.current().pools
+	report := StatusReport{
+		SchemaVersion: StatusSchemaVersion,
+		Version:       Version,
+		StartTime:     lb.startTime,
+		UptimeSeconds: time.Since(lb.startTime).Seconds(),
+		ConfigHash:    lb.ConfigHash(),
+		Pools:         make([]PoolStatus, 0, len(pools)),
+		ACME:          lb.acme.Status(),
+	}
+
+	for _, pool := range pools {
+		status := pool.status(withHistory)
+		report.HealthyBackends += status.HealthyBackends
+		report.TotalBackends += status.TotalBackends
+		for _, backend := range status.Backends {
+			report.InFlightRequests += backend.InFlightRequests
+		}
+		report.Pools = append(report.Pools, status)
+	}
+	report.Status = overallStatus(report.HealthyBackends, report.TotalBackends)
+
+	return report
+}
+
+func (lb *LB) handleStatusEndpoint(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	withHistory, _ := strconv.ParseBool(r.URL.Query().Get("history"))
+	if err := encoder.Encode(lb.status(withHistory)); err != nil {
+		lb.logger.Errorf("Failed to write status: %v", err)
+	}
+}
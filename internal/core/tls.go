@@ -0,0 +1,286 @@
+package core
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+	"github.com/farhapartex/bolt-load-balancer/internal/logger"
+	"golang.org/x/crypto/acme"
+)
+
+// certStore holds the frontend certificates, picks one per connection by
+// SNI and reloads them when their files change. The ACME certificate, if
+// any, is considered after the ones loaded from files.
+type certStore struct {
+	files  []config.CertificateConfig
+	acme   *acmeManager
+	logger *logger.Logger
+
+	mutex    sync.RWMutex
+	certs    []*tls.Certificate
+	modTimes []time.Time
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+func loadCertificate(files config.CertificateConfig) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate %s: %w", files.CertFile, err)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %s: %w", files.CertFile, err)
+		}
+	}
+	return &cert, nil
+}
+
+// modTime returns the later modification time of a certificate's two files.
+func modTime(files config.CertificateConfig) time.Time {
+	var latest time.Time
+	for _, name := range []string{files.CertFile, files.KeyFile} {
+		if info, err := os.Stat(name); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// reload loads every certificate again. A certificate that fails to load
+// keeps its previous version, so a half-written renewal doesn't take the
+// listener down.
+func (s *certStore) reload() error {
+	var errs []error
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, files := range s.files {
+		modified := modTime(files)
+		cert, err := loadCertificate(files)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if s.certs[i] != nil && !modified.Equal(s.modTimes[i]) {
+			s.logger.Infof("Reloaded certificate %s, valid until %s", files.CertFile, cert.Leaf.NotAfter.Format(time.RFC3339))
+		}
+		s.certs[i] = cert
+		s.modTimes[i] = modified
+	}
+	return errors.Join(errs...)
+}
+
+// changed reports whether any certificate file was modified since it was
+// last loaded.
+func (s *certStore) changed() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for i, files := range s.files {
+		if !modTime(files).Equal(s.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *certStore) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			if !s.changed() {
+				continue
+			}
+			if err := s.reload(); err != nil {
+				s.logger.Errorf("Failed to reload certificates: %v", err)
+			}
+		}
+	}
+}
+
+func (s *certStore) stop() {
+	s.stopOnce.Do(func() { close(s.stopChan) })
+}
+
+// getCertificate returns the first certificate valid for the requested
+// server name, or the first certificate when none is or no name was sent.
+func (s *certStore) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cert, isChallenge := s.acme.challengeCertificate(hello); isChallenge {
+		if cert == nil {
+			return nil, fmt.Errorf("no pending ACME challenge for %q", hello.ServerName)
+		}
+		return cert, nil
+	}
+
+	s.mutex.RLock()
+	certs := s.certs
+	s.mutex.RUnlock()
+	if cert := s.acme.certificate(); cert != nil {
+		certs = append(slices.Clip(certs), cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate available yet")
+	}
+
+	if hello.ServerName != "" {
+		for _, cert := range certs {
+			if cert.Leaf.VerifyHostname(hello.ServerName) == nil {
+				return cert, nil
+			}
+		}
+	}
+	return certs[0], nil
+}
+
+func newCertStore(conf *config.ServerTLSConfig, manager *acmeManager, lgr *logger.Logger) (*certStore, error) {
+	files := conf.AllCertificates()
+	store := &certStore{
+		files:    files,
+		acme:     manager,
+		logger:   lgr,
+		certs:    make([]*tls.Certificate, len(files)),
+		modTimes: make([]time.Time, len(files)),
+		stopChan: make(chan struct{}),
+	}
+	if err := store.reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// newServerTLSConfig builds the public listener's TLS settings. When h2 is
+// not offered, HTTP/2 is turned off on server, which would otherwise enable
+// it on its own. With client_auth, a certificate is verified whenever the
+// client sends one; routes decide whether it is required.
+func newServerTLSConfig(conf *config.ServerTLSConfig, store *certStore, server *http.Server) (*tls.Config, error) {
+	if !slices.Contains(conf.ALPN, "h2") {
+		server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+
+	protos := slices.Clone(conf.ALPN)
+	if conf.ACME != nil && slices.Contains(conf.ACME.Challenges, config.ChallengeTLSALPN01) {
+		protos = append(protos, acme.ALPNProto)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     config.TLSVersions[conf.MinVersion],
+		CipherSuites:   conf.CipherSuiteIDs(),
+		NextProtos:     protos,
+		GetCertificate: store.getCertificate,
+	}
+	if conf.ClientAuth != nil {
+		pemData, err := os.ReadFile(conf.ClientAuth.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("no certificates found in client CA %s", conf.ClientAuth.CAFile)
+		}
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// clientCertPolicy returns the client certificate policy for a request
+// matched to route.
+func clientCertPolicy(conf *config.ServerTLSConfig, route *Route) string {
+	if conf == nil || conf.ClientAuth == nil {
+		return config.ClientCertNone
+	}
+	if route.clientCert != "" {
+		return route.clientCert
+	}
+	return conf.ClientAuth.Policy
+}
+
+// verifiedClientCert returns the client's leaf certificate if it was
+// verified against the client CA pool.
+func verifiedClientCert(state *tls.ConnectionState) *x509.Certificate {
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+// setClientCertHeaders replaces the configured client certificate headers
+// with details of cert. A nil cert only removes them, so clients cannot
+// pass their own.
+func setClientCertHeaders(header http.Header, names config.ClientCertHeaders, cert *x509.Certificate) {
+	for _, name := range names.Names() {
+		header.Del(name)
+	}
+	if cert == nil {
+		return
+	}
+
+	if names.Subject != "" {
+		header.Set(names.Subject, cert.Subject.String())
+	}
+	if names.SAN != "" {
+		var sans []string
+		for _, name := range cert.DNSNames {
+			sans = append(sans, "DNS:"+name)
+		}
+		for _, ip := range cert.IPAddresses {
+			sans = append(sans, "IP:"+ip.String())
+		}
+		for _, uri := range cert.URIs {
+			sans = append(sans, "URI:"+uri.String())
+		}
+		for _, email := range cert.EmailAddresses {
+			sans = append(sans, "email:"+email)
+		}
+		if len(sans) > 0 {
+			header.Set(names.SAN, strings.Join(sans, ", "))
+		}
+	}
+	if names.Fingerprint != "" {
+		sum := sha256.Sum256(cert.Raw)
+		header.Set(names.Fingerprint, hex.EncodeToString(sum[:]))
+	}
+}
+
+// newBackendTLSConfig builds the client TLS settings for a backend with its
+// own CA, client certificate or server name.
+func newBackendTLSConfig(conf *config.BackendTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         conf.ServerName,
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+	}
+	if conf.CAFile != "" {
+		pemData, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backend CA: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("no certificates found in %s", conf.CAFile)
+		}
+	}
+	if conf.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load backend client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
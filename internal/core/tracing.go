@@ -0,0 +1,43 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/tracing"
+)
+
+func (lb *LB) startServerSpan(r *http.Request, clientIP, requestID string) *tracing.Span {
+	span := lb.tracer.StartServerSpan(r.Method, r.Header)
+	span.SetAttribute("http.request.method", r.Method)
+	span.SetAttribute("url.path", r.URL.Path)
+	span.SetAttribute("server.address", r.Host)
+	span.SetAttribute("client.address", clientIP)
+	if requestID != "" {
+		span.SetAttribute("bolt.request_id", requestID)
+	}
+	return span
+}
+
+// startClientSpan starts the span for forwarding the request to backend.
+func (lb *LB) startClientSpan(parent *tracing.Span, req *http.Request, pool *Pool, backendURL string) *tracing.Span {
+	span := lb.tracer.StartClientSpan(req.Method, parent)
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("url.full", req.URL.String())
+	span.SetAttribute("server.address", req.URL.Host)
+	span.SetAttribute("bolt.pool", pool.name)
+	span.SetAttribute("bolt.backend", backendURL)
+	span.SetAttribute("bolt.algorithm", pool.algorithm.Name())
+	return span
+}
+
+// endSpan records the response status and ends span. Statuses at or above
+// errorFrom mark the span as failed: 500 for server spans and 400 for client
+// spans, following the OpenTelemetry HTTP conventions.
+func endSpan(span *tracing.Span, status int, errorFrom int) {
+	span.SetAttribute("http.response.status_code", status)
+	if status >= errorFrom {
+		span.SetStatus(tracing.StatusError, fmt.Sprintf("HTTP %d", status))
+	}
+	span.End()
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+)
+
+// newBackendTransport returns a transport for a backend with its own TLS,
+// protocol or HTTP/2 settings. Backends without any share
+// http.DefaultTransport and get a nil transport.
+func newBackendTransport(be_config config.BackendConfig) (http.RoundTripper, error) {
+	if be_config.TLS == nil && be_config.HTTP2 == nil && (be_config.Protocol == "" || be_config.Protocol == config.ProtocolAuto) {
+		return nil, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if be_config.TLS != nil {
+		tlsConfig, err := newBackendTLSConfig(be_config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	transport.Protocols = new(http.Protocols)
+	switch be_config.Protocol {
+	case config.ProtocolHTTP1:
+		transport.Protocols.SetHTTP1(true)
+	case config.ProtocolH2:
+		transport.Protocols.SetHTTP2(true)
+	case config.ProtocolH2C:
+		transport.Protocols.SetUnencryptedHTTP2(true)
+	default:
+		transport.Protocols.SetHTTP1(true)
+		transport.Protocols.SetHTTP2(true)
+	}
+
+	if conf := be_config.HTTP2; conf != nil {
+		transport.MaxConnsPerHost = conf.MaxConnections
+		if conf.MaxIdleConnections > 0 {
+			transport.MaxIdleConnsPerHost = conf.MaxIdleConnections
+		}
+		transport.HTTP2 = &http.HTTP2Config{
+			SendPingTimeout: conf.PingInterval,
+			PingTimeout:     conf.PingTimeout,
+		}
+	}
+	return transport, nil
+}
+
+// sameBackendTransport reports whether a and b lead to the same transport,
+// so the one already built and its open connections can be kept.
+func sameBackendTransport(a, b config.BackendConfig) bool {
+	if a.Protocol != b.Protocol {
+		return false
+	}
+	if (a.TLS == nil) != (b.TLS == nil) || a.TLS != nil && *a.TLS != *b.TLS {
+		return false
+	}
+	if (a.HTTP2 == nil) != (b.HTTP2 == nil) || a.HTTP2 != nil && *a.HTTP2 != *b.HTTP2 {
+		return false
+	}
+	return true
+}
+
+// closeTransport drops the idle connections of a backend's own transport
+// once it is no longer used.
+func closeTransport(transport http.RoundTripper) {
+	if transport, ok := transport.(*http.Transport); ok {
+		transport.CloseIdleConnections()
+	}
+}
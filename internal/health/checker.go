@@ -11,40 +11,162 @@ import (
 	"github.com/farhapartex/bolt-load-balancer/internal/loadbalancer"
 )
 
+// CheckResult describes the outcome of one health check of a backend.
+type CheckResult struct {
+	Backend *loadbalancer.Backend
+	// Healthy reports whether this check passed. The backend's status only
+	// changes to unhealthy after MaxFails failed checks.
+	Healthy  bool
+	Previous loadbalancer.BackendStatus
+	Current  loadbalancer.BackendStatus
+	Time     time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// historySize is the number of recent checks kept for each backend.
+const historySize = 20
+
+// Observer is called after every health check.
+type Observer func(result CheckResult)
+
 type HealthChecker struct {
 	config     config.HealthCheckConfig
 	httpClient *http.Client
 	stopChan   chan struct{}
+	stopOnce   sync.Once
 	wg         sync.WaitGroup
+
+	userAgent string
+
+	observersMutex sync.RWMutex
+	observers      []Observer
+
+	historyMutex sync.RWMutex
+	history      map[*loadbalancer.Backend][]CheckResult
+}
+
+// SetUserAgent sets the User-Agent header sent with health check requests.
+func (hc *HealthChecker) SetUserAgent(userAgent string) {
+	hc.userAgent = userAgent
+}
+
+// LastResult returns the most recent check of backend, if it has been
+// checked.
+func (hc *HealthChecker) LastResult(backend *loadbalancer.Backend) (CheckResult, bool) {
+	hc.historyMutex.RLock()
+	defer hc.historyMutex.RUnlock()
+	results := hc.history[backend]
+	if len(results) == 0 {
+		return CheckResult{}, false
+	}
+	return results[len(results)-1], true
+}
+
+// History returns the most recent checks of backend, oldest first.
+func (hc *HealthChecker) History(backend *loadbalancer.Backend) []CheckResult {
+	hc.historyMutex.RLock()
+	defer hc.historyMutex.RUnlock()
+	results := make([]CheckResult, len(hc.history[backend]))
+	copy(results, hc.history[backend])
+	return results
+}
+
+// CopyHistory carries the check history of backend over from another
+// checker, used when a reload replaces the checker of a pool.
+func (hc *HealthChecker) CopyHistory(from *HealthChecker, backend *loadbalancer.Backend) {
+	results := from.History(backend)
+	hc.historyMutex.Lock()
+	defer hc.historyMutex.Unlock()
+	hc.history[backend] = results
+}
+
+// Forget drops the check history of a backend removed from the pool.
+func (hc *HealthChecker) Forget(backend *loadbalancer.Backend) {
+	hc.historyMutex.Lock()
+	defer hc.historyMutex.Unlock()
+	delete(hc.history, backend)
+}
+
+// AddObserver registers fn to be called with the result of every check.
+func (hc *HealthChecker) AddObserver(fn Observer) {
+	hc.observersMutex.Lock()
+	defer hc.observersMutex.Unlock()
+	hc.observers = append(hc.observers, fn)
+}
+
+func (hc *HealthChecker) notify(result CheckResult) {
+	hc.historyMutex.Lock()
+	results := append(hc.history[result.Backend], result)
+	if len(results) > historySize {
+		results = results[len(results)-historySize:]
+	}
+	hc.history[result.Backend] = results
+	hc.historyMutex.Unlock()
+
+	hc.observersMutex.RLock()
+	defer hc.observersMutex.RUnlock()
+	for _, fn := range hc.observers {
+		fn(result)
+	}
 }
 
 func (hc *HealthChecker) checkBackend(backend *loadbalancer.Backend) {
-	healthURL := fmt.Sprintf("%s%s", backend.URL.String(), hc.config.Path)
+	start_time := time.Now()
+	previous := backend.GetStatus()
 
+	err := hc.probe(backend)
+	if err == nil {
+		backend.MarkHealthy()
+	} else {
+		backend.MarkUnhealthy()
+	}
+
+	hc.notify(CheckResult{
+		Backend:  backend,
+		Healthy:  err == nil,
+		Previous: previous,
+		Current:  backend.GetStatus(),
+		Time:     start_time,
+		Duration: time.Since(start_time),
+		Err:      err,
+	})
+}
+
+func (hc *HealthChecker) probe(backend *loadbalancer.Backend) error {
 	ctx, cancel := context.WithTimeout(context.Background(), hc.config.Timeout)
 	defer cancel()
 
+	client := hc.httpClient
+	if transport := backend.Transport(); transport != nil {
+		// Probe over the same TLS and protocol settings as proxied requests.
+		withTransport := *hc.httpClient
+		withTransport.Transport = transport
+		client = &withTransport
+	}
+	if hc.config.Type == config.HealthCheckGRPC {
+		return hc.probeGRPC(ctx, client, backend)
+	}
+
+	healthURL := fmt.Sprintf("%s%s", backend.URL.String(), hc.config.Path)
 	req, err := http.NewRequestWithContext(ctx, "GET", healthURL, nil)
 	if err != nil {
-		backend.MarkUnhealthy()
-		return
+		return err
 	}
 
-	req.Header.Set("User-Agent", "BoltLoadBalancer/0.1.0 HealthChecker")
+	req.Header.Set("User-Agent", hc.userAgent)
 	req.Header.Set("Accept", "*/*")
 
-	resp, err := hc.httpClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
-		backend.MarkUnhealthy()
-		return
+		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == hc.config.ExpectedStatus {
-		backend.MarkHealthy()
-	} else {
-		backend.MarkUnhealthy()
+	if resp.StatusCode != hc.config.ExpectedStatus {
+		return fmt.Errorf("unexpected status %d, expected %d", resp.StatusCode, hc.config.ExpectedStatus)
 	}
+	return nil
 }
 
 func (hc *HealthChecker) checkAllBackends(backendPool *loadbalancer.BackendPool) {
@@ -89,7 +211,7 @@ func (hc *HealthChecker) Start(backendPool *loadbalancer.BackendPool) {
 }
 
 func (hc *HealthChecker) Stop() {
-	close(hc.stopChan)
+	hc.stopOnce.Do(func() { close(hc.stopChan) })
 	hc.wg.Wait()
 }
 
@@ -99,40 +221,6 @@ func (hc *HealthChecker) CheckBackendOnce(backend *loadbalancer.Backend) bool {
 	return backend.IsHealthy()
 }
 
-func (hc *HealthChecker) GetHealthStatus(backendPool *loadbalancer.BackendPool) map[string]interface{} {
-	backends := backendPool.GetBackends()
-	total := len(backends)
-	healthy := 0
-
-	backendStatuses := make([]map[string]interface{}, 0, total)
-
-	for _, backend := range backends {
-		status := map[string]interface{}{
-			"url":        backend.URL.String(),
-			"status":     backend.GetStatus().String(),
-			"fail_count": backend.GetFailCount(),
-		}
-		backendStatuses = append(backendStatuses, status)
-
-		if backend.IsHealthy() {
-			healthy++
-		}
-	}
-
-	return map[string]interface{}{
-		"total_backends":   total,
-		"healthy_backends": healthy,
-		"backends":         backendStatuses,
-		"health_check": map[string]interface{}{
-			"enabled":         hc.config.Enabled,
-			"interval":        hc.config.Interval.String(),
-			"timeout":         hc.config.Timeout.String(),
-			"path":            hc.config.Path,
-			"expected_status": hc.config.ExpectedStatus,
-		},
-	}
-}
-
 func NewHealthChecker(config config.HealthCheckConfig) *HealthChecker {
 	return &HealthChecker{
 		config: config,
@@ -142,6 +230,8 @@ func NewHealthChecker(config config.HealthCheckConfig) *HealthChecker {
 				return http.ErrUseLastResponse
 			},
 		},
-		stopChan: make(chan struct{}),
+		stopChan:  make(chan struct{}),
+		userAgent: "BoltLoadBalancer HealthChecker",
+		history:   make(map[*loadbalancer.Backend][]CheckResult),
 	}
 }
@@ -0,0 +1,141 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/loadbalancer"
+)
+
+// grpcHealthPath is the method of the standard gRPC health service,
+// grpc.health.v1.Health/Check.
+const grpcHealthPath = "/grpc.health.v1.Health/Check"
+
+// servingStatus values of grpc.health.v1.HealthCheckResponse.
+var servingStatus = map[uint64]string{
+	0: "UNKNOWN",
+	1: "SERVING",
+	2: "NOT_SERVING",
+	3: "SERVICE_UNKNOWN",
+}
+
+// probeGRPC calls the backend's gRPC health service and passes only when
+// it reports SERVING. The two messages involved are small enough to encode
+// by hand.
+func (hc *HealthChecker) probeGRPC(ctx context.Context, client *http.Client, backend *loadbalancer.Backend) error {
+	// HealthCheckRequest{service: 1}, in a gRPC frame.
+	var message []byte
+	if service := hc.config.GRPCService; service != "" {
+		message = append([]byte{0x0a}, binary.AppendUvarint(nil, uint64(len(service)))...)
+		message = append(message, service...)
+	}
+	frame := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(message)))
+	frame = append(frame, message...)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, backend.URL.JoinPath(grpcHealthPath).String(), bytes.NewReader(frame))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("User-Agent", hc.userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.ProtoMajor != 2 {
+		return fmt.Errorf("gRPC health check needs HTTP/2, backend answered with %s", resp.Proto)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from gRPC health service", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// Errors come in the trailers, or in the headers of a response without
+	// a body.
+	code := resp.Trailer.Get("Grpc-Status")
+	if code == "" {
+		code = resp.Header.Get("Grpc-Status")
+	}
+	if code != "0" {
+		msg := resp.Trailer.Get("Grpc-Message")
+		if msg == "" {
+			msg = resp.Header.Get("Grpc-Message")
+		}
+		if unescaped, err := url.PathUnescape(msg); err == nil {
+			msg = unescaped
+		}
+		return fmt.Errorf("gRPC health check failed with grpc-status %s: %s", code, msg)
+	}
+
+	status, err := parseHealthCheckResponse(body)
+	if err != nil {
+		return err
+	}
+	if status != 1 {
+		name, ok := servingStatus[status]
+		if !ok {
+			name = fmt.Sprint(status)
+		}
+		return fmt.Errorf("gRPC health service reports %s", name)
+	}
+	return nil
+}
+
+// parseHealthCheckResponse reads the status field of the
+// HealthCheckResponse in a single gRPC frame.
+func parseHealthCheckResponse(body []byte) (uint64, error) {
+	if len(body) < 5 {
+		return 0, errors.New("gRPC health response is missing its message")
+	}
+	if body[0] != 0 {
+		return 0, errors.New("compressed gRPC health responses are not supported")
+	}
+	length := binary.BigEndian.Uint32(body[1:5])
+	if uint32(len(body)-5) < length {
+		return 0, errors.New("gRPC health response is truncated")
+	}
+	message := body[5 : 5+length]
+
+	var status uint64
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			return 0, errors.New("malformed gRPC health response")
+		}
+		message = message[n:]
+
+		switch tag & 7 {
+		case 0: // varint
+			value, n := binary.Uvarint(message)
+			if n <= 0 {
+				return 0, errors.New("malformed gRPC health response")
+			}
+			if tag>>3 == 1 {
+				status = value
+			}
+			message = message[n:]
+		case 2: // length-delimited, unknown to us
+			size, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < size {
+				return 0, errors.New("malformed gRPC health response")
+			}
+			message = message[n+int(size):]
+		default:
+			return 0, fmt.Errorf("unexpected field %d in gRPC health response", tag>>3)
+		}
+	}
+	return status, nil
+}
@@ -2,7 +2,7 @@ package loadbalancer
 
 import (
 	"errors"
-	"sync/atomic"
+	"sync"
 )
 
 type Algorithm interface {
@@ -10,30 +10,54 @@ type Algorithm interface {
 	Name() string
 }
 
+// RoundRobinAlgorithm spreads requests over the available backends in
+// proportion to their weights, using smooth weighted round robin: a backend
+// of weight 3 next to one of weight 1 gets requests a, a, b, a rather than
+// a, a, a, b. Equal weights alternate in order.
 type RoundRobinAlgorithm struct {
-	current uint64
+	mutex   sync.Mutex
+	current map[*Backend]int
 }
 
 func NewRoundRobinAlgorithm() *RoundRobinAlgorithm {
-	return &RoundRobinAlgorithm{current: 0}
+	return &RoundRobinAlgorithm{current: make(map[*Backend]int)}
 }
 
 func (rr *RoundRobinAlgorithm) NextBackend(backends []*Backend) *Backend {
-	if len(backends) == 0 {
-		return nil
-	}
-	healthyBackends := make([]*Backend, 0, len(backends))
+	rr.mutex.Lock()
+	defer rr.mutex.Unlock()
+
+	var selected *Backend
+	total := 0
 	for _, backend := range backends {
-		if backend.IsHealthy() {
-			healthyBackends = append(healthyBackends, backend)
+		if !backend.IsAvailable() {
+			continue
+		}
+		weight := max(backend.GetWeight(), 1)
+		rr.current[backend] += weight
+		total += weight
+		if selected == nil || rr.current[backend] > rr.current[selected] {
+			selected = backend
 		}
 	}
-	if len(healthyBackends) == 0 {
+	if selected == nil {
 		return nil
 	}
-	next := atomic.AddUint64(&rr.current, 1)
-	index := (next - 1) % uint64(len(healthyBackends))
-	return healthyBackends[index]
+	rr.current[selected] -= total
+
+	// Forget backends that have left the pool.
+	if len(rr.current) > len(backends) {
+		listed := make(map[*Backend]bool, len(backends))
+		for _, backend := range backends {
+			listed[backend] = true
+		}
+		for backend := range rr.current {
+			if !listed[backend] {
+				delete(rr.current, backend)
+			}
+		}
+	}
+	return selected
 }
 
 func (rr *RoundRobinAlgorithm) Name() string {
@@ -2,11 +2,17 @@ package loadbalancer
 
 import (
 	"fmt"
+	"net/http"
 	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// latencyWeight is the weight of the newest sample in the moving average
+// returned by Backend.Latency.
+const latencyWeight = 0.2
+
 type BackendStatus int
 
 const (
@@ -33,6 +39,34 @@ func (s BackendStatus) String() string {
 	}
 }
 
+// AdminState is the operator-controlled state of a backend, independent of
+// its health.
+type AdminState int
+
+const (
+	// StateActive backends receive traffic while healthy
+	StateActive AdminState = iota
+
+	// StateDraining backends finish in-flight requests but take no new ones
+	StateDraining
+
+	// StateDisabled backends receive no traffic
+	StateDisabled
+)
+
+func (s AdminState) String() string {
+	switch s {
+	case StateActive:
+		return "active"
+	case StateDraining:
+		return "draining"
+	case StateDisabled:
+		return "disabled"
+	default:
+		return "invalid"
+	}
+}
+
 type Backend struct {
 	URL             *url.URL
 	Weight          int
@@ -43,6 +77,13 @@ type Backend struct {
 	LastFailTime    time.Time
 	LastHealthCheck time.Time
 
+	activeRequests int64
+	totalRequests  int64
+	failedRequests int64
+	latency        time.Duration
+	adminState     AdminState
+	transport      http.RoundTripper
+
 	mutex sync.RWMutex
 }
 
@@ -94,9 +135,110 @@ func (b *Backend) GetFailCount() int {
 }
 
 func (b *Backend) GetWeight() int {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
 	return b.Weight
 }
 
+func (b *Backend) SetWeight(weight int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.Weight = weight
+}
+
+// Update applies new settings from a configuration reload, keeping the
+// backend's health and in-flight requests.
+func (b *Backend) Update(weight int, maxFails int, failTimeout time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.Weight = weight
+	b.MaxFails = maxFails
+	b.FailTimeout = failTimeout
+}
+
+// Transport returns the round tripper used to reach the backend, or nil to
+// use http.DefaultTransport.
+func (b *Backend) Transport() http.RoundTripper {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.transport
+}
+
+func (b *Backend) SetTransport(transport http.RoundTripper) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.transport = transport
+}
+
+func (b *Backend) GetAdminState() AdminState {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.adminState
+}
+
+func (b *Backend) SetAdminState(state AdminState) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.adminState = state
+}
+
+// IsAvailable reports whether the backend may be given new requests: it is
+// healthy and neither draining nor disabled.
+func (b *Backend) IsAvailable() bool {
+	return b.GetAdminState() == StateActive && b.IsHealthy()
+}
+
+// StartRequest records a request being proxied to the backend. It must be
+// paired with a call to EndRequest.
+func (b *Backend) StartRequest() {
+	atomic.AddInt64(&b.activeRequests, 1)
+}
+
+func (b *Backend) EndRequest() {
+	atomic.AddInt64(&b.activeRequests, -1)
+}
+
+// ActiveRequests returns the number of requests currently being proxied to
+// the backend.
+func (b *Backend) ActiveRequests() int64 {
+	return atomic.LoadInt64(&b.activeRequests)
+}
+
+// CountRequest records a finished request. failed marks requests answered
+// with a server error or not answered at all.
+func (b *Backend) CountRequest(failed bool) {
+	atomic.AddInt64(&b.totalRequests, 1)
+	if failed {
+		atomic.AddInt64(&b.failedRequests, 1)
+	}
+}
+
+// RequestCounts returns the number of requests finished since the backend
+// was added and how many of them failed.
+func (b *Backend) RequestCounts() (total int64, failed int64) {
+	return atomic.LoadInt64(&b.totalRequests), atomic.LoadInt64(&b.failedRequests)
+}
+
+// RecordLatency adds a response time sample to the backend's moving average.
+func (b *Backend) RecordLatency(d time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.latency == 0 {
+		b.latency = d
+		return
+	}
+	b.latency = time.Duration(latencyWeight*float64(d) + (1-latencyWeight)*float64(b.latency))
+}
+
+// Latency returns the moving average of recent response times, or zero when
+// no response has been received yet.
+func (b *Backend) Latency() time.Duration {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.latency
+}
+
 func (b *Backend) DataReprensation() string {
 	b.mutex.RLock()
 	defer b.mutex.RUnlock()
@@ -137,6 +279,21 @@ func (bp *BackendPool) AddBackend(backend *Backend) {
 	bp.backends = append(bp.backends, backend)
 }
 
+// RemoveBackend takes backend out of the pool. Requests already holding the
+// backend are unaffected. It reports whether the backend was in the pool.
+func (bp *BackendPool) RemoveBackend(backend *Backend) bool {
+	bp.mutex.Lock()
+	defer bp.mutex.Unlock()
+
+	for i, existing := range bp.backends {
+		if existing == backend {
+			bp.backends = append(bp.backends[:i:i], bp.backends[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
 func (bp *BackendPool) GetBackends() []*Backend {
 	bp.mutex.RLock()
 	defer bp.mutex.RUnlock()
@@ -3,6 +3,7 @@ package logger
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"time"
@@ -17,6 +18,9 @@ const (
 	INFO
 	WARN
 	ERROR
+
+	// AUDIT records administrative actions and is written at every level
+	AUDIT
 )
 
 func (l LogLevel) DataReprensation() string {
@@ -29,6 +33,8 @@ func (l LogLevel) DataReprensation() string {
 		return "WARN"
 	case ERROR:
 		return "ERROR"
+	case AUDIT:
+		return "AUDIT"
 	default:
 		return "UNKNOWN"
 	}
@@ -39,6 +45,28 @@ type Logger struct {
 	format    string
 	accessLog bool
 	stdLogger *log.Logger
+	fields    map[string]interface{}
+}
+
+// SetOutput redirects the logger, for example to capture lines in tests.
+func (l *Logger) SetOutput(w io.Writer) {
+	l.stdLogger.SetOutput(w)
+}
+
+// With returns a logger that adds fields to every line it writes, such as
+// the request ID of the request being served.
+func (l *Logger) With(fields map[string]interface{}) *Logger {
+	merged := make(map[string]interface{}, len(l.fields)+len(fields))
+	for key, value := range l.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+
+	child := *l
+	child.fields = merged
+	return &child
 }
 
 func (l *Logger) shouldLog(level LogLevel) bool {
@@ -52,6 +80,17 @@ func (l *Logger) log(level LogLevel, message string, fields map[string]interface
 
 	timestamp := time.Now().Format(time.RFC3339)
 
+	if len(l.fields) > 0 {
+		merged := make(map[string]interface{}, len(l.fields)+len(fields))
+		for key, value := range l.fields {
+			merged[key] = value
+		}
+		for key, value := range fields {
+			merged[key] = value
+		}
+		fields = merged
+	}
+
 	if l.format == "json" {
 		entry := LogEntry{
 			Timestamp: timestamp,
@@ -126,7 +165,7 @@ func (l *Logger) Errorf(format string, args ...interface{}) {
 	l.Error(fmt.Sprintf(format, args...))
 }
 
-func (l *Logger) LogRequest(method, path, remoteAddr, userAgent string, statusCode int, duration time.Duration) {
+func (l *Logger) LogRequest(method, path, remoteAddr, userAgent string, statusCode int, duration time.Duration, extra ...map[string]interface{}) {
 	if !l.accessLog {
 		return
 	}
@@ -139,6 +178,11 @@ func (l *Logger) LogRequest(method, path, remoteAddr, userAgent string, statusCo
 		"status_code": statusCode,
 		"duration_ms": duration.Milliseconds(),
 	}
+	for _, f := range extra {
+		for key, value := range f {
+			fields[key] = value
+		}
+	}
 
 	message := fmt.Sprintf("%s %s - %d", method, path, statusCode)
 	l.log(INFO, message, fields)
@@ -161,6 +205,16 @@ func (l *Logger) LogBackendRequest(backendURL, method, path string, statusCode i
 	}
 }
 
+// Audit records an administrative action. Audit events are written
+// regardless of the configured log level.
+func (l *Logger) Audit(action string, fields map[string]interface{}) {
+	entry := map[string]interface{}{"action": action}
+	for key, value := range fields {
+		entry[key] = value
+	}
+	l.log(AUDIT, "Audit: "+action, entry)
+}
+
 type LogEntry struct {
 	Timestamp string                 `json:"timestamp"`
 	Level     string                 `json:"level"`
@@ -0,0 +1,210 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+	"github.com/farhapartex/bolt-load-balancer/internal/logger"
+)
+
+type SpanKind int
+
+// Span kinds as numbered by OTLP.
+const (
+	SpanKindServer SpanKind = 2
+	SpanKindClient SpanKind = 3
+)
+
+type StatusCode int
+
+// Span status codes as numbered by OTLP.
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Span records one operation. All methods are safe to call on a nil span, so
+// callers don't need to check whether tracing is enabled.
+type Span struct {
+	tracer  *Tracer
+	context SpanContext
+	parent  SpanID
+	kind    SpanKind
+	start   time.Time
+
+	mutex         sync.Mutex
+	name          string
+	end           time.Time
+	attributes    map[string]interface{}
+	status        StatusCode
+	statusMessage string
+	ended         bool
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.name = name
+}
+
+// SetAttribute records a string, bool, int, int64 or float64 attribute.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.attributes[key] = value
+}
+
+func (s *Span) SetStatus(code StatusCode, message string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.status = code
+	s.statusMessage = message
+}
+
+// Inject writes the span's context into outgoing request headers.
+func (s *Span) Inject(h http.Header) {
+	if s == nil {
+		return
+	}
+	h.Set(TraceparentHeader, s.context.Traceparent())
+	if s.context.TraceState != "" {
+		h.Set(TracestateHeader, s.context.TraceState)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
+
+// End finishes the span and queues it for export if it was sampled. Calls
+// after the first are ignored.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mutex.Unlock()
+
+	if s.context.Sampled && s.tracer.exporter != nil {
+		s.tracer.exporter.enqueue(s)
+	}
+}
+
+// Tracer creates spans and hands sampled ones to the OTLP exporter. A nil
+// Tracer creates nil spans.
+type Tracer struct {
+	sampleRatio float64
+	exporter    *Exporter
+}
+
+// StartServerSpan starts a span for an incoming request. It continues the
+// trace from the request's traceparent header when one is present and valid,
+// following the caller's sampling decision; otherwise it starts a new trace
+// sampled at the configured ratio.
+func (t *Tracer) StartServerSpan(name string, h http.Header) *Span {
+	if t == nil {
+		return nil
+	}
+
+	parent, err := ParseTraceparent(h.Get(TraceparentHeader))
+	if err != nil {
+		traceID := newTraceID()
+		return t.newSpan(name, SpanKindServer, SpanContext{
+			TraceID: traceID,
+			SpanID:  newSpanID(),
+			Sampled: t.shouldSample(traceID),
+		}, SpanID{})
+	}
+
+	return t.newSpan(name, SpanKindServer, SpanContext{
+		TraceID:    parent.TraceID,
+		SpanID:     newSpanID(),
+		Sampled:    parent.Sampled,
+		TraceState: cleanTracestate(h.Get(TracestateHeader)),
+	}, parent.SpanID)
+}
+
+// StartClientSpan starts a child of parent for an outgoing request.
+func (t *Tracer) StartClientSpan(name string, parent *Span) *Span {
+	if t == nil || parent == nil {
+		return nil
+	}
+
+	sc := parent.context
+	return t.newSpan(name, SpanKindClient, SpanContext{
+		TraceID:    sc.TraceID,
+		SpanID:     newSpanID(),
+		Sampled:    sc.Sampled,
+		TraceState: sc.TraceState,
+	}, sc.SpanID)
+}
+
+func (t *Tracer) newSpan(name string, kind SpanKind, sc SpanContext, parent SpanID) *Span {
+	return &Span{
+		tracer:     t,
+		context:    sc,
+		parent:     parent,
+		kind:       kind,
+		start:      time.Now(),
+		name:       name,
+		attributes: make(map[string]interface{}),
+	}
+}
+
+// shouldSample keeps a traceID-derived fraction of new traces, so every
+// service using the same ratio makes the same decision for a trace.
+func (t *Tracer) shouldSample(traceID TraceID) bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+	if t.sampleRatio <= 0 {
+		return false
+	}
+	bound := uint64(t.sampleRatio * (1 << 63))
+	return binary.BigEndian.Uint64(traceID[8:])>>1 < bound
+}
+
+// Shutdown exports every queued span and stops the exporter.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil || t.exporter == nil {
+		return nil
+	}
+	return t.exporter.Shutdown(ctx)
+}
+
+// NewTracer returns a tracer for conf, or nil when tracing is disabled.
+func NewTracer(conf config.TracingConfig, lgr *logger.Logger) *Tracer {
+	if !conf.Enabled {
+		return nil
+	}
+
+	return &Tracer{
+		sampleRatio: conf.SampleRatio,
+		exporter:    NewExporter(conf, lgr),
+	}
+}
@@ -0,0 +1,560 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+	"github.com/farhapartex/bolt-load-balancer/internal/core"
+)
+
+// acmeStandIn is a minimal ACME CA in the spirit of Pebble. It validates
+// challenges against bolt's listeners on 127.0.0.1 and signs certificates
+// with a test CA. Request signatures are not checked.
+type acmeStandIn struct {
+	t      *testing.T
+	ca     *testCA
+	server *httptest.Server
+
+	// HTTPPort and TLSPort are where challenges are validated.
+	HTTPPort int
+	TLSPort  int
+	// Reject fails every challenge.
+	Reject bool
+
+	mutex      sync.Mutex
+	thumbprint string
+	nextID     int
+	orders     map[string]*standInOrder
+	authzs     map[string]*standInAuthz
+	// Orders counts created orders.
+	Orders int
+}
+
+type standInOrder struct {
+	status  string
+	domains []string
+	authzs  []string
+	cert    []byte
+}
+
+type standInAuthz struct {
+	domain string
+	status string
+	token  string
+	err    string
+}
+
+func newACMEStandIn(t *testing.T, ca *testCA) *acmeStandIn {
+	s := &acmeStandIn{t: t, ca: ca, orders: make(map[string]*standInOrder), authzs: make(map[string]*standInAuthz)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /directory", s.handleDirectory)
+	mux.HandleFunc("/nonce", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("POST /account", s.handleAccount)
+	mux.HandleFunc("POST /order", s.handleNewOrder)
+	mux.HandleFunc("POST /order/{id}", s.handleOrder)
+	mux.HandleFunc("POST /authz/{id}", s.handleAuthz)
+	mux.HandleFunc("POST /challenge/{id}", s.handleChallenge)
+	mux.HandleFunc("POST /finalize/{id}", s.handleFinalize)
+	mux.HandleFunc("POST /cert/{id}", s.handleCert)
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", rand.Text())
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *acmeStandIn) DirectoryURL() string {
+	return s.server.URL + "/directory"
+}
+
+func (s *acmeStandIn) OrderCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.Orders
+}
+
+func (s *acmeStandIn) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// readJWS returns the decoded protected header and payload of a request.
+func (s *acmeStandIn) readJWS(r *http.Request) (protected map[string]json.RawMessage, payload []byte) {
+	var jws struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		s.t.Errorf("ACME stand-in: invalid JWS: %v", err)
+		return nil, nil
+	}
+	header, _ := base64.RawURLEncoding.DecodeString(jws.Protected)
+	json.Unmarshal(header, &protected)
+	payload, _ = base64.RawURLEncoding.DecodeString(jws.Payload)
+	return protected, payload
+}
+
+func (s *acmeStandIn) handleDirectory(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"newNonce":   s.server.URL + "/nonce",
+		"newAccount": s.server.URL + "/account",
+		"newOrder":   s.server.URL + "/order",
+		"revokeCert": s.server.URL + "/revoke",
+		"keyChange":  s.server.URL + "/key-change",
+		"meta":       map[string]string{"termsOfService": s.server.URL + "/terms"},
+	})
+}
+
+func (s *acmeStandIn) handleAccount(w http.ResponseWriter, r *http.Request) {
+	protected, _ := s.readJWS(r)
+	var jwk struct {
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+	if err := json.Unmarshal(protected["jwk"], &jwk); err != nil {
+		s.t.Errorf("ACME stand-in: account request without jwk: %v", err)
+	}
+	// RFC 7638 thumbprint of an EC key.
+	sum := sha256.Sum256([]byte(fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, jwk.Crv, jwk.X, jwk.Y)))
+	s.mutex.Lock()
+	s.thumbprint = base64.RawURLEncoding.EncodeToString(sum[:])
+	s.mutex.Unlock()
+
+	w.Header().Set("Location", s.server.URL+"/account/1")
+	s.writeJSON(w, http.StatusCreated, map[string]string{"status": "valid"})
+}
+
+func (s *acmeStandIn) orderJSON(id string, order *standInOrder) map[string]interface{} {
+	var identifiers []map[string]string
+	for _, domain := range order.domains {
+		identifiers = append(identifiers, map[string]string{"type": "dns", "value": domain})
+	}
+	var authzs []string
+	for _, authzID := range order.authzs {
+		authzs = append(authzs, s.server.URL+"/authz/"+authzID)
+	}
+	v := map[string]interface{}{
+		"status":         order.status,
+		"identifiers":    identifiers,
+		"authorizations": authzs,
+		"finalize":       s.server.URL + "/finalize/" + id,
+	}
+	if order.cert != nil {
+		v["certificate"] = s.server.URL + "/cert/" + id
+	}
+	return v
+}
+
+func (s *acmeStandIn) handleNewOrder(w http.ResponseWriter, r *http.Request) {
+	_, payload := s.readJWS(r)
+	var request struct {
+		Identifiers []struct{ Value string }
+	}
+	json.Unmarshal(payload, &request)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Orders++
+	s.nextID++
+	id := fmt.Sprint(s.nextID)
+	order := &standInOrder{status: "pending"}
+	for _, identifier := range request.Identifiers {
+		s.nextID++
+		authzID := fmt.Sprint(s.nextID)
+		s.authzs[authzID] = &standInAuthz{domain: identifier.Value, status: "pending", token: rand.Text()}
+		order.domains = append(order.domains, identifier.Value)
+		order.authzs = append(order.authzs, authzID)
+	}
+	s.orders[id] = order
+
+	w.Header().Set("Location", s.server.URL+"/order/"+id)
+	s.writeJSON(w, http.StatusCreated, s.orderJSON(id, order))
+}
+
+func (s *acmeStandIn) handleOrder(w http.ResponseWriter, r *http.Request) {
+	s.readJWS(r)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	id := r.PathValue("id")
+	order := s.orders[id]
+	if order.status == "pending" {
+		order.status = "ready"
+		for _, authzID := range order.authzs {
+			if s.authzs[authzID].status != "valid" {
+				order.status = "invalid"
+			}
+		}
+	}
+	w.Header().Set("Location", s.server.URL+"/order/"+id)
+	s.writeJSON(w, http.StatusOK, s.orderJSON(id, order))
+}
+
+func (s *acmeStandIn) authzJSON(id string, authz *standInAuthz) map[string]interface{} {
+	var challenges []map[string]interface{}
+	for _, kind := range []string{"http-01", "tls-alpn-01"} {
+		challenge := map[string]interface{}{
+			"type":   kind,
+			"url":    s.server.URL + "/challenge/" + id + "?type=" + kind,
+			"token":  authz.token,
+			"status": authz.status,
+		}
+		if authz.err != "" {
+			challenge["error"] = map[string]string{"type": "urn:ietf:params:acme:error:unauthorized", "detail": authz.err}
+		}
+		challenges = append(challenges, challenge)
+	}
+	return map[string]interface{}{
+		"identifier": map[string]string{"type": "dns", "value": authz.domain},
+		"status":     authz.status,
+		"challenges": challenges,
+	}
+}
+
+func (s *acmeStandIn) handleAuthz(w http.ResponseWriter, r *http.Request) {
+	s.readJWS(r)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	id := r.PathValue("id")
+	s.writeJSON(w, http.StatusOK, s.authzJSON(id, s.authzs[id]))
+}
+
+// handleChallenge validates the challenge right away, so the authorization
+// is final when the client starts polling it.
+func (s *acmeStandIn) handleChallenge(w http.ResponseWriter, r *http.Request) {
+	s.readJWS(r)
+	id := r.PathValue("id")
+	kind := r.URL.Query().Get("type")
+	s.mutex.Lock()
+	authz := s.authzs[id]
+	keyAuth := authz.token + "." + s.thumbprint
+	s.mutex.Unlock()
+
+	err := fmt.Errorf("rejected by the test")
+	if !s.Reject {
+		if kind == "http-01" {
+			err = s.validateHTTP01(authz.domain, authz.token, keyAuth)
+		} else {
+			err = s.validateTLSALPN01(authz.domain, keyAuth)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	authz.status = "valid"
+	if err != nil {
+		authz.status = "invalid"
+		authz.err = err.Error()
+	}
+	s.writeJSON(w, http.StatusOK, map[string]string{"type": kind, "url": s.server.URL + r.URL.RequestURI(), "token": authz.token, "status": authz.status})
+}
+
+func (s *acmeStandIn) validateHTTP01(domain, token, keyAuth string) error {
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/.well-known/acme-challenge/%s", s.HTTPPort, token), nil)
+	req.Host = domain
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != keyAuth {
+		return fmt.Errorf("unexpected HTTP-01 response %d %q", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (s *acmeStandIn) validateTLSALPN01(domain, keyAuth string) error {
+	conn, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", s.TLSPort), &tls.Config{
+		ServerName:         domain,
+		NextProtos:         []string{"acme-tls/1"},
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	state := conn.ConnectionState()
+	if state.NegotiatedProtocol != "acme-tls/1" {
+		return fmt.Errorf("negotiated %q instead of acme-tls/1", state.NegotiatedProtocol)
+	}
+
+	expected := sha256.Sum256([]byte(keyAuth))
+	for _, ext := range state.PeerCertificates[0].Extensions {
+		if !ext.Id.Equal(asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}) {
+			continue
+		}
+		var digest []byte
+		if _, err := asn1.Unmarshal(ext.Value, &digest); err != nil || string(digest) != string(expected[:]) {
+			return fmt.Errorf("wrong acmeIdentifier in challenge certificate")
+		}
+		return nil
+	}
+	return fmt.Errorf("challenge certificate has no acmeIdentifier")
+}
+
+func (s *acmeStandIn) handleFinalize(w http.ResponseWriter, r *http.Request) {
+	_, payload := s.readJWS(r)
+	var request struct {
+		CSR string `json:"csr"`
+	}
+	json.Unmarshal(payload, &request)
+	der, _ := base64.RawURLEncoding.DecodeString(request.CSR)
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, map[string]string{"type": "urn:ietf:params:acme:error:badCSR", "detail": err.Error()})
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	id := r.PathValue("id")
+	order := s.orders[id]
+	s.ca.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(s.ca.serial),
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, s.ca.cert, csr.PublicKey, s.ca.key)
+	if err != nil {
+		s.t.Errorf("ACME stand-in: failed to sign: %v", err)
+	}
+	order.cert = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.ca.cert.Raw})...)
+	order.status = "valid"
+
+	w.Header().Set("Location", s.server.URL+"/order/"+id)
+	s.writeJSON(w, http.StatusOK, s.orderJSON(id, order))
+}
+
+func (s *acmeStandIn) handleCert(w http.ResponseWriter, r *http.Request) {
+	s.readJWS(r)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	w.Write(s.orders[r.PathValue("id")].cert)
+}
+
+func acmeStatus(t *testing.T, lb *core.LB) *core.ACMEStatus {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	lb.AdminHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var report core.StatusReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Status is not valid JSON: %v", err)
+	}
+	if report.ACME == nil {
+		t.Fatal("Expected ACME in the status report")
+	}
+	return report.ACME
+}
+
+func TestACMETLSALPN01(t *testing.T) {
+	backend := newTestBackend(t, "one")
+	ca := newTestCA(t)
+	standIn := newACMEStandIn(t, ca)
+	cacheDir := t.TempDir()
+
+	acmeConfig := func(port int) string {
+		return fmt.Sprintf(`
+server:
+  host: 127.0.0.1
+  port: %d
+  tls:
+    acme:
+      domains: [a.example, www.a.example]
+      email: ops@a.example
+      directory_url: %q
+      cache_dir: %q
+backends:
+  - url: %q
+admin:
+  enabled: false
+`, port, standIn.DirectoryURL(), cacheDir, backend.URL)
+	}
+
+	port := freePort(t)
+	standIn.TLSPort = port
+	lb := startTLSLB(t, acmeConfig(port), port, ca)
+
+	state, err := handshake(t, port, &tls.Config{RootCAs: ca.pool(), ServerName: "www.a.example"})
+	if err != nil {
+		t.Fatalf("Handshake with the ACME certificate failed: %v", err)
+	}
+	if names := state.PeerCertificates[0].DNSNames; strings.Join(names, ",") != "a.example,www.a.example" {
+		t.Errorf("Unexpected certificate names %v", names)
+	}
+	for _, name := range []string{"account.key", "a.example.pem"} {
+		if _, err := os.Stat(filepath.Join(cacheDir, name)); err != nil {
+			t.Errorf("Expected %s in the cache directory: %v", name, err)
+		}
+	}
+	status := acmeStatus(t, lb)
+	// The stand-in's certificates live for 25 hours, shorter than
+	// renew_before, so they are renewed two thirds into their lifetime.
+	if status.NotAfter.IsZero() || status.LastRenewal.IsZero() || status.LastError != "" ||
+		!status.NextRenewal.Equal(status.NotAfter.Add(-25*time.Hour/3)) {
+		t.Errorf("Unexpected ACME status %+v", status)
+	}
+
+	// A restart uses the cached certificate instead of ordering again.
+	port = freePort(t)
+	standIn.TLSPort = port
+	lb = startTLSLB(t, acmeConfig(port), port, ca)
+	if orders := standIn.OrderCount(); orders != 1 {
+		t.Errorf("Expected the cached certificate to be reused, got %d orders", orders)
+	}
+	if status := acmeStatus(t, lb); status.NotAfter.IsZero() || !status.LastRenewal.IsZero() {
+		t.Errorf("Expected the cached certificate in the status, got %+v", status)
+	}
+}
+
+func TestACMEHTTP01(t *testing.T) {
+	backend := newTestBackend(t, "one")
+	ca := newTestCA(t)
+	standIn := newACMEStandIn(t, ca)
+	port := freePort(t)
+	standIn.HTTPPort = freePort(t)
+
+	startTLSLB(t, fmt.Sprintf(`
+server:
+  host: 127.0.0.1
+  port: %d
+  http_redirect:
+    port: %d
+    exempt_paths: []
+  tls:
+    acme:
+      domains: [a.example]
+      directory_url: %q
+      challenges: [http-01]
+      cache_dir: %q
+backends:
+  - url: %q
+admin:
+  enabled: false
+`, port, standIn.HTTPPort, standIn.DirectoryURL(), t.TempDir(), backend.URL), port, ca)
+
+	// Once the order is done, challenge paths are redirected like others.
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/.well-known/acme-challenge/old", standIn.HTTPPort))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("Expected a redirect for an unknown token, got %d", resp.StatusCode)
+	}
+}
+
+func TestACMEFailureReported(t *testing.T) {
+	backend := newTestBackend(t, "one")
+	ca := newTestCA(t)
+	standIn := newACMEStandIn(t, ca)
+	standIn.Reject = true
+	port := freePort(t)
+	standIn.TLSPort = port
+
+	lb := startLB(t, fmt.Sprintf(`
+server:
+  host: 127.0.0.1
+  port: %d
+  tls:
+    acme:
+      domains: [a.example]
+      directory_url: %q
+      cache_dir: %q
+backends:
+  - url: %q
+admin:
+  enabled: false
+`, port, standIn.DirectoryURL(), t.TempDir(), backend.URL))
+
+	var status *core.ACMEStatus
+	for i := 0; i < 100; i++ {
+		if status = acmeStatus(t, lb); status.Failures > 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if status.Failures != 1 || !strings.Contains(status.LastError, "rejected by the test") ||
+		status.NextRenewal.Before(time.Now()) || !status.NotAfter.IsZero() {
+		t.Errorf("Expected the failed order in the status, got %+v", status)
+	}
+
+	if _, err := handshake(t, port, &tls.Config{RootCAs: ca.pool(), ServerName: "a.example"}); err == nil {
+		t.Error("Expected handshakes to fail without a certificate")
+	}
+}
+
+func TestACMEValidation(t *testing.T) {
+	tests := []struct {
+		acme     string
+		expected string
+	}{
+		{"cache_dir: /tmp/acme", "acme needs at least one domain"},
+		{"domains: [a.example]", "acme needs a cache_dir"},
+		{"domains: [\"*.a.example\"]\n      cache_dir: /tmp/acme", `invalid domain "*.a.example"`},
+		{"domains: [a.example]\n      cache_dir: /tmp/acme\n      challenges: [dns-01]", `unknown challenge type "dns-01"`},
+		{"domains: [a.example]\n      cache_dir: /tmp/acme\n      challenges: [http-01]", "http-01 challenges are answered on server.http_redirect"},
+		{"domains: [a.example]\n      cache_dir: /tmp/acme\n      directory_url: ftp://ca", `invalid directory URL "ftp://ca"`},
+	}
+
+	for _, tc := range tests {
+		_, err := config.LoadFromBytes([]byte(fmt.Sprintf(`
+server:
+  tls:
+    acme:
+      %s
+backends:
+  - url: "http://127.0.0.1:9000"
+`, tc.acme)))
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("Expected error containing %q for:\n%s\ngot %v", tc.expected, tc.acme, err)
+		}
+	}
+
+	cfg, err := config.LoadFromBytes([]byte(`
+server:
+  http_redirect: {}
+  tls:
+    acme:
+      domains: [a.example]
+      cache_dir: /tmp/acme
+backends:
+  - url: "http://127.0.0.1:9000"
+`))
+	if err != nil {
+		t.Fatalf("Expected a valid ACME config, got %v", err)
+	}
+	acme := cfg.Server.TLS.ACME
+	if acme.DirectoryURL != config.DefaultACMEDirectory || strings.Join(acme.Challenges, ",") != "tls-alpn-01,http-01" ||
+		acme.RenewBefore != config.DefaultACMERenewBefore {
+		t.Errorf("Unexpected ACME defaults: %+v", acme)
+	}
+}
@@ -0,0 +1,535 @@
+package tests
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+	"github.com/farhapartex/bolt-load-balancer/internal/core"
+)
+
+func TestPublicEndpointsOptIn(t *testing.T) {
+	backend := newTestBackend(t, "one")
+
+	lb := newTestLB(t, fmt.Sprintf(`
+backends:
+  - url: %q
+`, backend.URL))
+
+	for _, path := range []string{"/status", "/metrics"} {
+		recorder := httptest.NewRecorder()
+		lb.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if got := recorder.Header().Get("X-Test-Path"); got != path {
+			t.Errorf("Expected %s to be proxied to the backend, got X-Test-Path %q", path, got)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	lb.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if recorder.Body.Len() != 0 {
+		t.Errorf("Expected /health to be answered by the backend, got %q", recorder.Body.String())
+	}
+
+	lb = newTestLB(t, fmt.Sprintf(`
+backends:
+  - url: %q
+public_endpoints:
+  health: /lb/health
+  status: /lb/status
+`, backend.URL))
+
+	recorder = httptest.NewRecorder()
+	lb.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/lb/health", nil))
+	if !strings.HasPrefix(recorder.Body.String(), "HEALTHY") {
+		t.Errorf("Expected /lb/health to be answered by bolt, got %q", recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	lb.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/lb/status", nil))
+	if recorder.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected /lb/status to be answered by bolt")
+	}
+
+	recorder = httptest.NewRecorder()
+	lb.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if got := recorder.Header().Get("X-Test-Path"); got != "/metrics" {
+		t.Errorf("Expected /metrics to be proxied, got X-Test-Path %q", got)
+	}
+}
+
+func TestAdminConfigValidation(t *testing.T) {
+	_, err := config.LoadFromBytes([]byte(`
+server:
+  port: 8190
+admin:
+  port: 0
+public_endpoints:
+  status: status
+`))
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, expected := range []string{"admin.port", "public_endpoints.status"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error for %s, got: %v", expected, err)
+		}
+	}
+}
+
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestAdminUnixSocket(t *testing.T) {
+	backend := newTestBackend(t, "one")
+	socket := filepath.Join(t.TempDir(), "admin.sock")
+
+	cfg, err := config.LoadFromBytes([]byte(fmt.Sprintf(`
+server:
+  host: 127.0.0.1
+  port: %d
+backends:
+  - url: %q
+admin:
+  port: 0
+  socket: %q
+logging:
+  level: error
+`, freePort(t), backend.URL, socket)))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	lb, err := core.NewLB(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create load balancer: %v", err)
+	}
+	go lb.Start()
+	t.Cleanup(func() { lb.Stop(context.Background()) })
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		resp, err = client.Get("http://admin/status")
+		if err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Failed to reach admin socket: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"schema_version"`) {
+		t.Errorf("Unexpected admin status response %d: %s", resp.StatusCode, body)
+	}
+}
+
+func adminRequest(t *testing.T, lb *core.LB, method, path, body string) (int, core.BackendStatus) {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	recorder := httptest.NewRecorder()
+	lb.AdminHandler().ServeHTTP(recorder, httptest.NewRequest(method, path, reader))
+
+	var status core.BackendStatus
+	if recorder.Code < 300 {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+			t.Fatalf("%s %s: invalid response: %v\n%s", method, path, err, recorder.Body.String())
+		}
+	}
+	return recorder.Code, status
+}
+
+func TestAdminBackendAPI(t *testing.T) {
+	first := newTestBackend(t, "first")
+	second := newTestBackend(t, "second")
+	third := newTestBackend(t, "third")
+
+	filename := filepath.Join(t.TempDir(), "bolt.yaml")
+	writeTestFiles(t, filepath.Dir(filename), map[string]string{
+		"bolt.yaml": fmt.Sprintf(`
+backends:
+  - url: %q
+  - url: %q
+admin:
+  persist: true
+logging:
+  level: error
+  access_log: false
+`, first.URL, second.URL),
+	})
+
+	if err := os.Chmod(filename, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.LoadFromFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	lb := startCheckedLB(t, cfg)
+	hashBefore := lb.ConfigHash()
+
+	code, added := adminRequest(t, lb, http.MethodPost, "/admin/backends", fmt.Sprintf(`{"url": %q, "weight": 2}`, third.URL))
+	if code != http.StatusCreated || added.URL != third.URL || added.Weight != 2 || added.Pool != "default" {
+		t.Fatalf("Unexpected add response %d: %+v", code, added)
+	}
+	if code, _ := adminRequest(t, lb, http.MethodPost, "/admin/backends", fmt.Sprintf(`{"url": %q}`, third.URL)); code != http.StatusConflict {
+		t.Errorf("Expected 409 for a duplicate backend, got %d", code)
+	}
+	if lb.ConfigHash() == hashBefore {
+		t.Error("Expected the config hash to change after adding a backend")
+	}
+
+	code, updated := adminRequest(t, lb, http.MethodPatch, "/admin/backends/"+added.ID, `{"weight": 5}`)
+	if code != http.StatusOK || updated.Weight != 5 {
+		t.Errorf("Unexpected weight update response %d: %+v", code, updated)
+	}
+	if code, _ := adminRequest(t, lb, http.MethodPatch, "/admin/backends/"+added.ID, `{"weight": 0}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for weight 0, got %d", code)
+	}
+
+	code, drained := adminRequest(t, lb, http.MethodPost, "/admin/backends/"+url.PathEscape(first.URL)+"/drain", "")
+	if code != http.StatusOK || drained.State != "draining" {
+		t.Fatalf("Unexpected drain response %d: %+v", code, drained)
+	}
+	for i := 0; i < 6; i++ {
+		recorder := httptest.NewRecorder()
+		lb.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		if recorder.Header().Get("X-Test-Backend") == "first" {
+			t.Fatal("Draining backend received a new request")
+		}
+	}
+
+	code, disabled := adminRequest(t, lb, http.MethodPost, "/admin/backends/"+drained.ID+"/disable", "")
+	if code != http.StatusOK || disabled.State != "disabled" {
+		t.Errorf("Unexpected disable response %d: %+v", code, disabled)
+	}
+
+	saved, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read persisted config: %v", err)
+	}
+	if !strings.Contains(string(saved), third.URL) || !strings.Contains(string(saved), "weight: 5") ||
+		!strings.Contains(string(saved), "disabled: true") {
+		t.Errorf("Expected changes to be persisted, got:\n%s", saved)
+	}
+	if strings.Contains(string(saved), "# from") {
+		t.Errorf("Expected the persisted config to carry no source comments, got:\n%s", saved)
+	}
+	if info, err := os.Stat(filename); err != nil {
+		t.Fatalf("Failed to stat persisted config: %v", err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the persisted config to keep mode 0600, got %v", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(filename)); len(entries) != 1 {
+		t.Errorf("Expected no temporary files next to the config, got %v", entries)
+	}
+
+	code, enabled := adminRequest(t, lb, http.MethodPost, "/admin/backends/"+drained.ID+"/enable", "")
+	if code != http.StatusOK || enabled.State != "active" {
+		t.Errorf("Unexpected enable response %d: %+v", code, enabled)
+	}
+
+	if code, _ := adminRequest(t, lb, http.MethodDelete, "/admin/backends/"+drained.ID, ""); code != http.StatusOK {
+		t.Errorf("Expected backend to be deleted, got %d", code)
+	}
+	if code, _ := adminRequest(t, lb, http.MethodDelete, "/admin/backends/"+drained.ID, ""); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a deleted backend, got %d", code)
+	}
+
+	reloaded, err := config.LoadFromFile(filename)
+	if err != nil {
+		t.Fatalf("Persisted config does not load: %v", err)
+	}
+	if len(reloaded.Backends) != 2 || reloaded.Backends[0].URL != second.URL || reloaded.Backends[1].URL != third.URL {
+		t.Errorf("Unexpected persisted backends: %+v", reloaded.Backends)
+	}
+}
+
+func TestAdminWeightChangesDistribution(t *testing.T) {
+	first := newTestBackend(t, "first")
+	second := newTestBackend(t, "second")
+	lb := newTestLB(t, fmt.Sprintf(`
+backends:
+  - url: %q
+  - url: %q
+`, first.URL, second.URL))
+
+	count := func() map[string]int {
+		counts := make(map[string]int)
+		for i := 0; i < 40; i++ {
+			recorder := httptest.NewRecorder()
+			lb.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+			counts[recorder.Header().Get("X-Test-Backend")]++
+		}
+		return counts
+	}
+
+	if counts := count(); counts["first"] != 20 || counts["second"] != 20 {
+		t.Errorf("Expected equal weights to split requests evenly, got %v", counts)
+	}
+
+	if code, _ := adminRequest(t, lb, http.MethodPatch, "/admin/backends/"+url.PathEscape(first.URL), `{"weight": 3}`); code != http.StatusOK {
+		t.Fatalf("Failed to set weight, got %d", code)
+	}
+	if counts := count(); counts["first"] != 30 || counts["second"] != 10 {
+		t.Errorf("Expected weight 3 to take three quarters of the requests, got %v", counts)
+	}
+}
+
+func TestAdminPersistRejectsIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"bolt.yaml": `
+include: backends.yaml
+admin:
+  persist: true
+`,
+		"backends.yaml": `
+backends:
+  - url: "http://localhost:9001"
+`,
+	})
+
+	cfg, err := config.LoadFromFile(filepath.Join(dir, "bolt.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if _, err := core.NewLB(cfg); err == nil || !strings.Contains(err.Error(), "admin.persist") {
+		t.Errorf("Expected admin.persist to be rejected with includes, got %v", err)
+	}
+}
+
+func TestAdminTokenAuth(t *testing.T) {
+	backend := newTestBackend(t, "one")
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"tokens": "# operators\nread-write:rw-secret\n\nread-only:ro-file-secret\n",
+	})
+	t.Setenv("BOLT_TEST_ADMIN_TOKENS", "read-only:ro-secret")
+
+	lb := newTestLB(t, fmt.Sprintf(`
+backends:
+  - url: %q
+admin:
+  host: 0.0.0.0
+  auth:
+    tokens_file: %q
+    tokens_env: BOLT_TEST_ADMIN_TOKENS
+`, backend.URL, filepath.Join(dir, "tokens")))
+
+	var logs strings.Builder
+	lb.Logger().SetOutput(&logs)
+
+	request := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		lb.AdminHandler().ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	drainPath := "/admin/backends/" + url.PathEscape(backend.URL) + "/drain"
+
+	tests := []struct {
+		method string
+		path   string
+		token  string
+		code   int
+	}{
+		{http.MethodGet, "/status", "", http.StatusUnauthorized},
+		{http.MethodGet, "/status", "wrong", http.StatusUnauthorized},
+		{http.MethodGet, "/status", "ro-secret", http.StatusOK},
+		{http.MethodGet, "/status", "ro-file-secret", http.StatusOK},
+		{http.MethodPost, drainPath, "", http.StatusUnauthorized},
+		{http.MethodPost, drainPath, "ro-secret", http.StatusForbidden},
+		{http.MethodPost, drainPath, "rw-secret", http.StatusOK},
+	}
+	for _, test := range tests {
+		recorder := request(test.method, test.path, test.token)
+		if recorder.Code != test.code {
+			t.Errorf("%s %s with token %q: expected %d, got %d", test.method, test.path, test.token, test.code, recorder.Code)
+		}
+	}
+
+	if got := request(http.MethodGet, "/status", "").Header().Get("WWW-Authenticate"); !strings.HasPrefix(got, "Bearer") {
+		t.Errorf("Expected a Bearer challenge, got %q", got)
+	}
+
+	auditLines := 0
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(line, "[AUDIT]") {
+			auditLines++
+			if strings.Contains(line, "secret") {
+				t.Errorf("Audit log leaks a token: %s", line)
+			}
+		}
+	}
+	if auditLines != 3 {
+		t.Errorf("Expected 3 audit events for mutating calls, got %d:\n%s", auditLines, logs.String())
+	}
+	if !strings.Contains(logs.String(), "status_code=200") || !strings.Contains(logs.String(), "role=read-write") {
+		t.Errorf("Expected the successful drain to be audited with its role:\n%s", logs.String())
+	}
+}
+
+func TestAdminRequiresAuthOffLoopback(t *testing.T) {
+	_, err := config.LoadFromBytes([]byte(`
+admin:
+  host: 0.0.0.0
+`))
+	if err == nil || !strings.Contains(err.Error(), "requires admin.auth") {
+		t.Errorf("Expected an error for an unauthenticated public admin listener, got %v", err)
+	}
+}
+
+func TestAdminRejectsCrossSite(t *testing.T) {
+	backend := newTestBackend(t, "one")
+	lb := newTestLB(t, fmt.Sprintf(`
+backends:
+  - url: %q
+`, backend.URL))
+
+	drainPath := "/admin/backends/" + url.PathEscape(backend.URL) + "/drain"
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		code    int
+	}{
+		{"cli", http.MethodPost, nil, http.StatusOK},
+		{"dashboard", http.MethodPost, map[string]string{"Sec-Fetch-Site": "same-origin", "Origin": "http://example.com"}, http.StatusOK},
+		{"cross-site fetch", http.MethodPost, map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"same-site fetch", http.MethodPost, map[string]string{"Sec-Fetch-Site": "same-site"}, http.StatusForbidden},
+		{"foreign origin", http.MethodPost, map[string]string{"Origin": "http://evil.example"}, http.StatusForbidden},
+		{"opaque origin", http.MethodPost, map[string]string{"Origin": "null"}, http.StatusForbidden},
+		{"matching origin", http.MethodPost, map[string]string{"Origin": "http://example.com"}, http.StatusOK},
+		{"cross-site read", http.MethodGet, map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusOK},
+	}
+	for _, tc := range tests {
+		path := drainPath
+		if tc.method == http.MethodGet {
+			path = "/status"
+		}
+		req := httptest.NewRequest(tc.method, path, nil)
+		for name, value := range tc.headers {
+			req.Header.Set(name, value)
+		}
+		recorder := httptest.NewRecorder()
+		lb.AdminHandler().ServeHTTP(recorder, req)
+		if recorder.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.code, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func TestAdminClientCertAuth(t *testing.T) {
+	backend := newTestBackend(t, "one")
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue("admin", "bolt-admin", "127.0.0.1")
+	opsCert, opsKey := ca.issue("ops", "ops-cli")
+	viewerCert, viewerKey := ca.issue("viewer", "dashboard")
+	adminPort := freePort(t)
+
+	cfg, err := config.LoadFromBytes([]byte(fmt.Sprintf(`
+server:
+  host: 127.0.0.1
+  port: %d
+backends:
+  - url: %q
+admin:
+  host: 127.0.0.1
+  port: %d
+  tls:
+    cert_file: %q
+    key_file: %q
+  auth:
+    client_ca_file: %q
+    client_cert_roles:
+      ops-cli: read-write
+logging:
+  level: error
+`, freePort(t), backend.URL, adminPort, serverCert, serverKey, ca.CertFile)))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	lb, err := core.NewLB(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create load balancer: %v", err)
+	}
+	lb.Logger().SetOutput(io.Discard)
+	go lb.Start()
+	t.Cleanup(func() { lb.Stop(context.Background()) })
+
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      ca.pool(),
+			Certificates: certs,
+		}}}
+	}
+	base := fmt.Sprintf("https://127.0.0.1:%d", adminPort)
+	drainURL := base + "/admin/backends/" + url.PathEscape(backend.URL) + "/drain"
+
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		resp, err = client().Get(base + "/status")
+		if err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Failed to reach admin listener: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a client certificate, got %d", resp.StatusCode)
+	}
+
+	resp, err = client(loadKeyPair(t, viewerCert, viewerKey)).Post(drainURL, "application/json", nil)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 for a read-only certificate, got %d", resp.StatusCode)
+	}
+
+	resp, err = client(loadKeyPair(t, opsCert, opsKey)).Post(drainURL, "application/json", nil)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 for a read-write certificate, got %d", resp.StatusCode)
+	}
+}
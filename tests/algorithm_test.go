@@ -91,6 +91,29 @@ func TestRoundRobinWithUnhealthyBackends(t *testing.T) {
 	}
 }
 
+func TestRoundRobinWeights(t *testing.T) {
+	algorithm := loadbalancer.NewRoundRobinAlgorithm()
+
+	backends := createTestBackends(t, []string{
+		"http://heavy:8080",
+		"http://light:8080",
+	})
+	backends[0].SetWeight(3)
+
+	var selected []string
+	for i := 0; i < 8; i++ {
+		selected = append(selected, algorithm.NextBackend(backends).URL.Host)
+	}
+
+	// Weighted picks are interleaved rather than sent in bursts.
+	expected := []string{"heavy:8080", "heavy:8080", "light:8080", "heavy:8080"}
+	for i, host := range append(expected, expected...) {
+		if selected[i] != host {
+			t.Fatalf("Expected the sequence %v twice, got %v", expected, selected)
+		}
+	}
+}
+
 func TestRoundRobinEmptyBackends(t *testing.T) {
 	algorithm := loadbalancer.NewRoundRobinAlgorithm()
 
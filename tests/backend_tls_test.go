@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+)
+
+// newTLSBackend starts an HTTPS backend with a certificate for
+// backend.internal that requires a client certificate signed by ca. It
+// reports the client certificate's common name in X-Client-CN.
+func newTLSBackend(t *testing.T, ca *testCA) *httptest.Server {
+	t.Helper()
+	certFile, keyFile := ca.issue("backend", "backend.internal", "backend.internal")
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			w.Header().Set("X-Client-CN", r.TLS.PeerCertificates[0].Subject.CommonName)
+		}
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{loadKeyPair(t, certFile, keyFile)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool(),
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestBackendMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	backend := newTLSBackend(t, ca)
+	clientCert, clientKey := ca.issue("client", "bolt")
+
+	lb := newTestLB(t, fmt.Sprintf(`
+backends:
+  - url: %q
+    tls:
+      ca_file: %q
+      cert_file: %q
+      key_file: %q
+      server_name: backend.internal
+`, backend.URL, ca.CertFile, clientCert, clientKey))
+
+	if status := lb.Status().Pools[0].Backends[0]; status.Status != "healthy" {
+		t.Errorf("Expected the health check to pass over mTLS, got %s (%s)", status.Status, status.LastCheckError)
+	}
+
+	recorder := httptest.NewRecorder()
+	lb.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if recorder.Code != http.StatusOK || recorder.Header().Get("X-Client-CN") != "bolt" {
+		t.Errorf("Expected the request to reach the backend with bolt's certificate, got %d %q",
+			recorder.Code, recorder.Header().Get("X-Client-CN"))
+	}
+}
+
+func TestBackendTLSFailures(t *testing.T) {
+	ca := newTestCA(t)
+	backend := newTLSBackend(t, ca)
+	clientCert, clientKey := ca.issue("client", "bolt")
+
+	tests := []struct {
+		name     string
+		tls      string
+		expected string
+	}{
+		{"no client certificate", fmt.Sprintf("ca_file: %q\n      server_name: backend.internal", ca.CertFile), "certificate required"},
+		{"wrong server name", fmt.Sprintf("ca_file: %q\n      cert_file: %q\n      key_file: %q", ca.CertFile, clientCert, clientKey), "doesn't contain any IP SANs"},
+		{"system roots", fmt.Sprintf("cert_file: %q\n      key_file: %q\n      server_name: backend.internal", clientCert, clientKey), "unknown authority"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			lb := newTestLB(t, fmt.Sprintf(`
+backends:
+  - url: %q
+    max_fails: 1
+    tls:
+      %s
+`, backend.URL, tc.tls))
+
+			status := lb.Status().Pools[0].Backends[0]
+			if status.Status != "unhealthy" || !strings.Contains(status.LastCheckError, tc.expected) {
+				t.Errorf("Expected the health check to fail with %q, got %s (%s)", tc.expected, status.Status, status.LastCheckError)
+			}
+		})
+	}
+
+	// insecure_skip_verify still presents the client certificate.
+	lb := newTestLB(t, fmt.Sprintf(`
+backends:
+  - url: %q
+    tls:
+      cert_file: %q
+      key_file: %q
+      insecure_skip_verify: true
+`, backend.URL, clientCert, clientKey))
+	recorder := httptest.NewRecorder()
+	lb.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected insecure_skip_verify to accept the backend, got %d", recorder.Code)
+	}
+}
+
+func TestBackendTLSValidation(t *testing.T) {
+	tests := []struct {
+		backend  string
+		expected string
+	}{
+		{"url: \"http://127.0.0.1:9000\"\n    tls:\n      insecure_skip_verify: true", "tls settings need an https:// backend URL"},
+		{"url: \"https://127.0.0.1:9000\"\n    tls:\n      cert_file: client.pem", "client certificate needs both cert_file and key_file"},
+	}
+	for _, tc := range tests {
+		_, err := config.LoadFromBytes([]byte(fmt.Sprintf("backends:\n  - %s\n", tc.backend)))
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("Expected error containing %q, got %v", tc.expected, err)
+		}
+	}
+}
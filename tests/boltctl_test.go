@@ -0,0 +1,272 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/adminclient"
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+)
+
+func TestReloadKeepsBackendState(t *testing.T) {
+	first := newTestBackend(t, "first")
+	second := newTestBackend(t, "second")
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "bolt.yaml")
+	writeConfig := func(backends ...string) {
+		var b strings.Builder
+		b.WriteString("logging:\n  level: error\n  access_log: false\ndefault_pool: web\npools:\n  - name: web\n    backends:\n")
+		for _, backend := range backends {
+			fmt.Fprintf(&b, "      - url: %q\n", backend)
+		}
+		writeTestFiles(t, dir, map[string]string{"bolt.yaml": b.String()})
+	}
+	writeConfig(first.URL)
+
+	cfg, err := config.LoadFromFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	lb := startCheckedLB(t, cfg)
+	if code, _ := adminRequest(t, lb, http.MethodPatch, "/admin/backends/"+lb.Status().Pools[0].Backends[0].ID, `{"weight": 3}`); code != http.StatusOK {
+		t.Fatalf("Failed to set weight, got %d", code)
+	}
+	if code, _ := adminRequest(t, lb, http.MethodPost, "/admin/backends/"+lb.Status().Pools[0].Backends[0].ID+"/drain", ""); code != http.StatusOK {
+		t.Fatalf("Failed to drain, got %d", code)
+	}
+	hashBefore := lb.ConfigHash()
+
+	writeConfig(first.URL, second.URL)
+	if err := lb.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if lb.ConfigHash() == hashBefore {
+		t.Error("Expected the config hash to change after a reload")
+	}
+
+	report := lb.Status()
+	if len(report.Pools) != 1 || len(report.Pools[0].Backends) != 2 {
+		t.Fatalf("Expected one pool with two backends after reload, got %+v", report.Pools)
+	}
+	kept := report.Pools[0].Backends[0]
+	if kept.URL != first.URL || kept.State != "draining" || !kept.Healthy {
+		t.Errorf("Expected the first backend to stay healthy and draining, got %+v", kept)
+	}
+	if kept.Weight != 1 {
+		t.Errorf("Expected the reloaded weight 1, got %d", kept.Weight)
+	}
+
+	// The new backend takes traffic once it passes its first check.
+	waitForHealthChecks(t, lb)
+	recorder := httptest.NewRecorder()
+	lb.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := recorder.Header().Get("X-Test-Backend"); got != "second" {
+		t.Errorf("Expected the new backend to take traffic, got %q", got)
+	}
+
+	writeTestFiles(t, dir, map[string]string{"bolt.yaml": "pools:\n  - name: web\n    backends: []\n"})
+	hashBefore = lb.ConfigHash()
+	if err := lb.Reload(); err == nil {
+		t.Fatal("Expected reload of an invalid configuration to fail")
+	}
+	if lb.ConfigHash() != hashBefore || len(lb.Status().Pools[0].Backends) != 2 {
+		t.Error("Expected a failed reload to keep the running configuration")
+	}
+
+	metrics := httptest.NewRecorder()
+	lb.AdminHandler().ServeHTTP(metrics, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, line := range []string{
+		`bolt_config_reloads_total{result="success"} 1`,
+		`bolt_config_reloads_total{result="failure"} 1`,
+	} {
+		if !strings.Contains(metrics.Body.String(), line+"\n") {
+			t.Errorf("Expected line %q in metrics", line)
+		}
+	}
+}
+
+func TestFailedReloadLeavesBackendsUntouched(t *testing.T) {
+	first := newTestBackend(t, "first")
+	second := newTestBackend(t, "second")
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "bolt.yaml")
+	writeTestFiles(t, dir, map[string]string{"bolt.yaml": fmt.Sprintf(`
+logging:
+  level: error
+  access_log: false
+backends:
+  - url: %q
+`, first.URL)})
+	cfg, err := config.LoadFromFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	lb := startCheckedLB(t, cfg)
+
+	// The second backend's CA cannot be read, which fails the reload only
+	// after the first backend has been looked at.
+	writeTestFiles(t, dir, map[string]string{"bolt.yaml": fmt.Sprintf(`
+backends:
+  - url: %q
+    weight: 5
+    disabled: true
+  - url: %q
+    tls:
+      ca_file: %q
+`, first.URL, strings.Replace(second.URL, "http:", "https:", 1), filepath.Join(dir, "missing.pem"))})
+	if err := lb.Reload(); err == nil {
+		t.Fatal("Expected the reload to fail")
+	}
+
+	backend := lb.Status().Pools[0].Backends[0]
+	if backend.Weight != 1 || backend.State != "active" {
+		t.Errorf("Expected a failed reload to leave the backend at weight 1 and active, got %d and %s", backend.Weight, backend.State)
+	}
+}
+
+func TestReloadClosesRemovedBackendConnections(t *testing.T) {
+	kept := newTestBackend(t, "kept")
+
+	var open atomic.Int32
+	dropped := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test-Backend", "dropped")
+	}))
+	dropped.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			open.Add(1)
+		case http.StateClosed, http.StateHijacked:
+			open.Add(-1)
+		}
+	}
+	dropped.Start()
+	t.Cleanup(dropped.Close)
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "bolt.yaml")
+	writeTestFiles(t, dir, map[string]string{"bolt.yaml": fmt.Sprintf(`
+logging:
+  level: error
+  access_log: false
+backends:
+  - url: %q
+  - url: %q
+    protocol: http1
+`, kept.URL, dropped.URL)})
+	cfg, err := config.LoadFromFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	lb := startCheckedLB(t, cfg)
+
+	for i := 0; i < 2; i++ {
+		lb.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	if open.Load() == 0 {
+		t.Fatal("Expected an open connection to the backend before the reload")
+	}
+
+	writeTestFiles(t, dir, map[string]string{"bolt.yaml": fmt.Sprintf(`
+backends:
+  - url: %q
+`, kept.URL)})
+	if err := lb.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for open.Load() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the removed backend's connections to be closed, %d still open", open.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAdminClient(t *testing.T) {
+	first := newTestBackend(t, "first")
+	second := newTestBackend(t, "second")
+
+	filename := filepath.Join(t.TempDir(), "bolt.yaml")
+	writeTestFiles(t, filepath.Dir(filename), map[string]string{
+		"bolt.yaml": fmt.Sprintf(`
+backends:
+  - url: %q
+  - url: %q
+logging:
+  level: error
+  access_log: false
+`, first.URL, second.URL),
+	})
+	cfg, err := config.LoadFromFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	lb := startCheckedLB(t, cfg)
+
+	server := httptest.NewServer(lb.AdminHandler())
+	t.Cleanup(server.Close)
+
+	client, err := adminclient.NewClient(adminclient.Options{Address: server.URL})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	ctx := context.Background()
+
+	report, err := client.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if report.Status != "ok" || report.TotalBackends != 2 {
+		t.Errorf("Unexpected status report: %+v", report)
+	}
+
+	drained, err := client.Drain(ctx, first.URL, "")
+	if err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+	if drained.URL != first.URL || drained.State != "draining" {
+		t.Errorf("Unexpected drain result: %+v", drained)
+	}
+
+	updated, err := client.SetWeight(ctx, report.Pools[0].Backends[1].ID, "", 4)
+	if err != nil {
+		t.Fatalf("SetWeight failed: %v", err)
+	}
+	if updated.URL != second.URL || updated.Weight != 4 {
+		t.Errorf("Unexpected weight result: %+v", updated)
+	}
+
+	_, err = client.SetWeight(ctx, second.URL, "", 0)
+	var apiErr *adminclient.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || !strings.Contains(apiErr.Message, "weight") {
+		t.Errorf("Expected a 400 error about the weight, got %v", err)
+	}
+
+	result, err := client.Reload(ctx)
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if result.ConfigHash != lb.ConfigHash() || len(result.Pools) != 1 || result.Pools[0] != "default" {
+		t.Errorf("Unexpected reload result: %+v", result)
+	}
+
+	if err := os.Remove(filename); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Reload(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected reload of a missing file to fail with 400, got %v", err)
+	}
+}
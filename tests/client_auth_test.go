@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+)
+
+func TestClientCertificateAuth(t *testing.T) {
+	backend := newTestBackend(t, "one")
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue("server", "a.example", "a.example")
+	clientCert, clientKey := ca.issue("client", "alice", "alice.example", "10.0.0.7")
+	port := freePort(t)
+
+	startTLSLB(t, fmt.Sprintf(`
+server:
+  host: 127.0.0.1
+  port: %d
+  tls:
+    cert_file: %q
+    key_file: %q
+    client_auth:
+      ca_file: %q
+      headers:
+        subject: X-Client-Subject
+        san: X-Client-SAN
+        fingerprint: X-Client-Fingerprint
+backends:
+  - url: %q
+routes:
+  - match:
+      path_prefix: /public
+    pool: default
+    client_cert: none
+  - match:
+      path_prefix: /maybe
+    pool: default
+    client_cert: optional
+admin:
+  enabled: false
+`, port, serverCert, serverKey, ca.CertFile, backend.URL), port, ca)
+
+	get := func(path string, cert *tls.Certificate) *http.Response {
+		t.Helper()
+		tlsConfig := &tls.Config{RootCAs: ca.pool(), ServerName: "a.example"}
+		if cert != nil {
+			tlsConfig.Certificates = []tls.Certificate{*cert}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("https://127.0.0.1:%d%s", port, path), nil)
+		req.Header.Set("X-Client-Subject", "CN=mallory")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request to %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	keyPair := loadKeyPair(t, clientCert, clientKey)
+	leaf, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		t.Fatalf("Failed to parse client certificate: %v", err)
+	}
+	sum := sha256.Sum256(leaf.Raw)
+
+	// The default policy is required.
+	if resp := get("/", nil); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 without a client certificate, got %d", resp.StatusCode)
+	}
+	resp := get("/", &keyPair)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 with a client certificate, got %d", resp.StatusCode)
+	}
+	for header, expected := range map[string]string{
+		"X-Seen-X-Client-Subject":     "CN=alice",
+		"X-Seen-X-Client-San":         "DNS:alice.example, IP:10.0.0.7",
+		"X-Seen-X-Client-Fingerprint": hex.EncodeToString(sum[:]),
+	} {
+		if got := resp.Header.Get(header); got != expected {
+			t.Errorf("Expected %s %q, got %q", header, expected, got)
+		}
+	}
+
+	resp = get("/maybe", nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Seen-X-Client-Subject") != "" {
+		t.Errorf("Expected an optional route to pass without a certificate and drop the spoofed subject, got %d %q",
+			resp.StatusCode, resp.Header.Get("X-Seen-X-Client-Subject"))
+	}
+	if resp = get("/maybe", &keyPair); resp.Header.Get("X-Seen-X-Client-Subject") != "CN=alice" {
+		t.Errorf("Expected an optional route to forward the subject, got %q", resp.Header.Get("X-Seen-X-Client-Subject"))
+	}
+
+	resp = get("/public", &keyPair)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Seen-X-Client-Subject") != "" {
+		t.Errorf("Expected a none route to pass without forwarding certificate details, got %d %q",
+			resp.StatusCode, resp.Header.Get("X-Seen-X-Client-Subject"))
+	}
+
+	// A certificate from another CA fails the handshake, even on a none route.
+	otherCert, otherKey := newTestCA(t).issue("other", "eve")
+	other := loadKeyPair(t, otherCert, otherKey)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs: ca.pool(), ServerName: "a.example", Certificates: []tls.Certificate{other},
+	}}}
+	if resp, err := client.Get(fmt.Sprintf("https://127.0.0.1:%d/public", port)); err == nil {
+		resp.Body.Close()
+		t.Error("Expected a certificate from an unknown CA to be rejected")
+	}
+}
+
+func TestClientCertificateValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		expected string
+	}{
+		{
+			"missing CA",
+			"server:\n  tls:\n    cert_file: a.pem\n    key_file: a-key.pem\n    client_auth:\n      policy: optional\n",
+			"client_auth needs a ca_file",
+		},
+		{
+			"unknown policy",
+			"server:\n  tls:\n    cert_file: a.pem\n    key_file: a-key.pem\n    client_auth:\n      ca_file: ca.pem\n      policy: sometimes\n",
+			`invalid client certificate policy "sometimes"`,
+		},
+		{
+			"bad header name",
+			"server:\n  tls:\n    cert_file: a.pem\n    key_file: a-key.pem\n    client_auth:\n      ca_file: ca.pem\n      headers:\n        subject: \"X Subject\"\n",
+			`invalid header name "X Subject"`,
+		},
+		{
+			"route without client_auth",
+			"routes:\n  - match:\n      path_prefix: /\n    pool: default\n    client_cert: required\n",
+			"client_cert needs server.tls.client_auth",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := config.LoadFromBytes([]byte(tc.yaml + "backends:\n  - url: \"http://127.0.0.1:9000\"\n"))
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
@@ -1,7 +1,11 @@
 package tests
 
 import (
+	"encoding/json"
+	"errors"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -233,6 +237,449 @@ func TestLoadFromFileNotFound(t *testing.T) {
 	}
 }
 
+func TestLoadFromBytesStrictUnknownKeys(t *testing.T) {
+	yamlWithTypo := `
+server:
+  port: 9090
+backends:
+  - url: "http://test:8081"
+    wieght: 2
+helth_check:
+  enabled: true
+`
+
+	_, err := config.LoadFromBytes([]byte(yamlWithTypo))
+	if err == nil {
+		t.Fatal("Expected error for unknown keys in strict mode, got nil")
+	}
+
+	var verr *config.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected ValidationError, got %T: %v", err, err)
+	}
+
+	if len(verr.Errors) != 2 {
+		t.Fatalf("Expected 2 errors, got %d: %v", len(verr.Errors), err)
+	}
+
+	expected := []config.FieldError{
+		{Path: "backends[0].wieght", Line: 6},
+		{Path: "helth_check", Line: 7},
+	}
+	for i, want := range expected {
+		got := verr.Errors[i]
+		if got.Path != want.Path || got.Line != want.Line {
+			t.Errorf("Error %d: expected %s at line %d, got %s at line %d", i, want.Path, want.Line, got.Path, got.Line)
+		}
+	}
+
+	cfg, err := config.LoadFromBytesWithOptions([]byte(yamlWithTypo), config.LoadOptions{Strict: false})
+	if err != nil {
+		t.Fatalf("Expected unknown keys to be ignored in non-strict mode, got %v", err)
+	}
+	if cfg.Server.Port != 9090 {
+		t.Errorf("Expected port 9090, got %d", cfg.Server.Port)
+	}
+}
+
+func TestLoadFromBytesStrictReportsAllErrors(t *testing.T) {
+	invalidValues := `
+server:
+  port: 70000
+backends:
+  - url: "http://test:8081"
+    weight: -2
+logging:
+  level: "verbose"
+  format: "xml"
+`
+
+	_, err := config.LoadFromBytes([]byte(invalidValues))
+	var verr *config.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+
+	expected := map[string]int{
+		"server.port":        3,
+		"backends[0].weight": 6,
+		"logging.level":      8,
+		"logging.format":     9,
+	}
+	if len(verr.Errors) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(expected), len(verr.Errors), err)
+	}
+	for _, fe := range verr.Errors {
+		line, ok := expected[fe.Path]
+		if !ok {
+			t.Errorf("Unexpected error for path %s: %v", fe.Path, fe)
+			continue
+		}
+		if fe.Line != line {
+			t.Errorf("Expected %s at line %d, got line %d", fe.Path, line, fe.Line)
+		}
+	}
+
+	cfg, err := config.LoadFromBytesWithOptions([]byte(strings.Replace(invalidValues, "70000", "9090", 1)),
+		config.LoadOptions{Strict: false})
+	if err != nil {
+		t.Fatalf("Expected invalid values to be replaced in non-strict mode, got %v", err)
+	}
+	if cfg.Logging.Level != "info" || cfg.Logging.Format != "text" {
+		t.Errorf("Expected logging to fall back to info/text, got %s/%s", cfg.Logging.Level, cfg.Logging.Format)
+	}
+}
+
+func TestStrictRejectsZeroWeightAndMaxFails(t *testing.T) {
+	zeroValues := `
+backends:
+  - url: "http://test:8081"
+    weight: 0
+    max_fails: 0
+  - url: "http://test:8082"
+`
+
+	_, err := config.LoadFromBytes([]byte(zeroValues))
+	for _, expected := range []string{"weight must be at least 1, got 0", "max_fails must be at least 1, got 0"} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error containing %q, got %v", expected, err)
+		}
+	}
+
+	cfg, err := config.LoadFromBytesWithOptions([]byte(zeroValues), config.LoadOptions{Strict: false})
+	if err != nil {
+		t.Fatalf("Expected zero values to be replaced in non-strict mode, got %v", err)
+	}
+	for _, backend := range cfg.Backends {
+		if backend.Weight != 1 || backend.MaxFails != 3 {
+			t.Errorf("Expected defaults for %s, got weight %d and max_fails %d", backend.URL, backend.Weight, backend.MaxFails)
+		}
+	}
+
+	// Configurations built in code are validated strictly too.
+	built := config.DefaultConfig()
+	built.Logging.Level = "verbose"
+	if err := built.Validate(); err == nil || !strings.Contains(err.Error(), `invalid log level "verbose"`) {
+		t.Errorf("Expected Validate to reject an invalid log level, got %v", err)
+	}
+}
+
+func TestStarterConfigIsValid(t *testing.T) {
+	cfg, err := config.LoadFromBytes([]byte(config.StarterConfig))
+	if err != nil {
+		t.Fatalf("Starter config should load in strict mode: %v", err)
+	}
+
+	if cfg.Server.Port != 8100 {
+		t.Errorf("Expected starter port 8100, got %d", cfg.Server.Port)
+	}
+}
+
+func TestEncodeJSON(t *testing.T) {
+	cfg := config.DefaultConfig()
+
+	data, err := cfg.Encode(config.FormatJSON)
+	if err != nil {
+		t.Fatalf("Failed to encode config as JSON: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Encoded config is not valid JSON: %v", err)
+	}
+
+	health, ok := decoded["health_check"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected health_check object, got %v", decoded["health_check"])
+	}
+
+	if health["interval"] != "30s" {
+		t.Errorf("Expected interval to be encoded as \"30s\", got %v", health["interval"])
+	}
+
+	if _, err := cfg.Encode("xml"); err == nil {
+		t.Error("Expected error for unsupported format")
+	}
+}
+
+func TestLoadFromBytesJSON(t *testing.T) {
+	jsonConfig := `{
+  "server": {"port": 9090, "read_timeout": "15s"},
+  "backends": [
+    {"url": "http:\/\/test:8081", "weight": 2, "fail_timeout": "1m"}
+  ],
+  "health_check": {"interval": "10s"}
+}`
+
+	cfg, err := config.LoadFromBytesWithOptions([]byte(jsonConfig), config.LoadOptions{Strict: true, Format: config.FormatJSON})
+	if err != nil {
+		t.Fatalf("Failed to load valid JSON: %v", err)
+	}
+
+	if cfg.Server.Port != 9090 {
+		t.Errorf("Expected port 9090, got %d", cfg.Server.Port)
+	}
+
+	if cfg.Server.ReadTimeout != 15*time.Second {
+		t.Errorf("Expected read timeout 15s, got %v", cfg.Server.ReadTimeout)
+	}
+
+	if cfg.Backends[0].URL != "http://test:8081" || cfg.Backends[0].FailTimeout != time.Minute {
+		t.Errorf("Unexpected backend: %+v", cfg.Backends[0])
+	}
+
+	if cfg.HealthCheck.Interval != 10*time.Second {
+		t.Errorf("Expected health check interval 10s, got %v", cfg.HealthCheck.Interval)
+	}
+
+	_, err = config.LoadFromBytesWithOptions([]byte("{\n  \"helth_check\": {}\n}"), config.LoadOptions{Strict: true, Format: config.FormatJSON})
+	if err == nil || !contains(err.Error(), "line 2: helth_check") {
+		t.Errorf("Expected unknown key error on line 2, got %v", err)
+	}
+}
+
+func TestLoadFromBytesTOML(t *testing.T) {
+	tomlConfig := `
+strategy = "round_robin"
+
+[server]
+port = 9090
+idle_timeout = "2m"
+
+[[backends]]
+url = "http://test:8081"
+fail_timeout = "45s"
+
+[[backends]]
+url = "http://test:8082"
+`
+
+	cfg, err := config.LoadFromBytesWithOptions([]byte(tomlConfig), config.LoadOptions{Strict: true, Format: config.FormatTOML})
+	if err != nil {
+		t.Fatalf("Failed to load valid TOML: %v", err)
+	}
+
+	if cfg.Server.IdleTimeout != 2*time.Minute {
+		t.Errorf("Expected idle timeout 2m, got %v", cfg.Server.IdleTimeout)
+	}
+
+	if len(cfg.Backends) != 2 {
+		t.Fatalf("Expected 2 backends, got %d", len(cfg.Backends))
+	}
+
+	if cfg.Backends[0].FailTimeout != 45*time.Second {
+		t.Errorf("Expected fail timeout 45s, got %v", cfg.Backends[0].FailTimeout)
+	}
+}
+
+func TestSaveToFileFormats(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Server.Port = 9191
+
+	for _, name := range []string{"test_config_output.json", "test_config_output.toml", "test_config_output.yml"} {
+		t.Run(name, func(t *testing.T) {
+			defer os.Remove(name)
+
+			if err := cfg.SaveConfToFile(name); err != nil {
+				t.Fatalf("Failed to save config: %v", err)
+			}
+
+			loaded, err := config.LoadFromFile(name)
+			if err != nil {
+				t.Fatalf("Failed to load saved config: %v", err)
+			}
+
+			if loaded.Server.Port != 9191 {
+				t.Errorf("Expected port 9191, got %d", loaded.Server.Port)
+			}
+
+			if loaded.HealthCheck.Timeout != cfg.HealthCheck.Timeout {
+				t.Errorf("Expected health check timeout %v, got %v", cfg.HealthCheck.Timeout, loaded.HealthCheck.Timeout)
+			}
+		})
+	}
+}
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestLoadFromFileIncludesAndDropIns(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"config.yaml": `
+include:
+  - teams/*.yaml
+server:
+  port: 8100
+backends:
+  - url: "http://root:8081"
+`,
+		"teams/payments.yaml": `
+backends:
+  - url: "http://payments:8081"
+logging:
+  level: "debug"
+`,
+		"conf.d/10-override.json": `{"server": {"port": 9000}}`,
+	})
+
+	cfg, err := config.LoadFromFile(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to load config with includes: %v", err)
+	}
+
+	if cfg.Server.Port != 9000 {
+		t.Errorf("Expected drop-in to override port to 9000, got %d", cfg.Server.Port)
+	}
+
+	if cfg.Logging.Level != "debug" {
+		t.Errorf("Expected included log level 'debug', got %s", cfg.Logging.Level)
+	}
+
+	expected := []struct{ url, source string }{
+		{"http://root:8081", "config.yaml"},
+		{"http://payments:8081", filepath.Join("teams", "payments.yaml")},
+	}
+	if len(cfg.Backends) != len(expected) {
+		t.Fatalf("Expected %d backends, got %d", len(expected), len(cfg.Backends))
+	}
+	for i, want := range expected {
+		if cfg.Backends[i].URL != want.url || cfg.Backends[i].Source != want.source {
+			t.Errorf("Backend %d: expected %s from %s, got %s from %s",
+				i, want.url, want.source, cfg.Backends[i].URL, cfg.Backends[i].Source)
+		}
+	}
+
+	if out := cfg.DataReprensation(); !contains(out, "# from teams/payments.yaml") {
+		t.Errorf("Expected printed config to show backend source, got:\n%s", out)
+	}
+}
+
+func TestIncludedFilesAreReadOnce(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"config.yaml": `
+include:
+  - conf.d/*.yaml
+  - conf.d/a.yaml
+`,
+		"conf.d/a.yaml": `
+backends:
+  - url: "http://127.0.0.1:9002"
+`,
+	})
+
+	cfg, err := config.LoadFromFile(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Expected a file matched by an include and as a drop-in to load once, got %v", err)
+	}
+	if len(cfg.Backends) != 1 {
+		t.Errorf("Expected 1 backend, got %d", len(cfg.Backends))
+	}
+}
+
+func TestEncodeWithSources(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"config.yaml": `
+backends:
+  - url: "http://root:8081"
+`,
+		"conf.d/payments.yaml": `
+backends:
+  - url: "http://payments:8081"
+`,
+	})
+	cfg, err := config.LoadFromFile(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	for _, format := range []string{config.FormatJSON, config.FormatTOML} {
+		data, err := cfg.EncodeWithSources(format)
+		if err != nil {
+			t.Fatalf("Failed to encode %s: %v", format, err)
+		}
+		source := filepath.Join("conf.d", "payments.yaml")
+		if !strings.Contains(string(data), source) {
+			t.Errorf("Expected %s output to name %s, got:\n%s", format, source, data)
+		}
+
+		// The source fields are accepted, and ignored, on load.
+		reloaded, err := config.LoadFromBytesWithOptions(data, config.LoadOptions{Strict: true, Format: format})
+		if err != nil {
+			t.Errorf("Expected %s output to load back, got %v", format, err)
+		} else if reloaded.Backends[1].Source != "" {
+			t.Errorf("Expected the source field to be ignored, got %q", reloaded.Backends[1].Source)
+		}
+
+		plain, _ := cfg.Encode(format)
+		if strings.Contains(string(plain), "source") {
+			t.Errorf("Expected Encode to leave sources out of %s, got:\n%s", format, plain)
+		}
+	}
+}
+
+func TestLoadFromFileIncludeConflicts(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"config.yaml": `
+backends:
+  - url: "http://root:8081"
+`,
+		"conf.d/a.yaml": `
+logging:
+  level: "debug"
+`,
+		"conf.d/b.yaml": `
+logging:
+  level: "warn"
+backends:
+  - url: "http://root:8081"
+`,
+	})
+
+	_, err := config.LoadFromFile(filepath.Join(dir, "config.yaml"))
+	var verr *config.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected ValidationError for conflicting drop-ins, got %v", err)
+	}
+
+	if len(verr.Errors) != 2 {
+		t.Fatalf("Expected 2 conflicts, got %d: %v", len(verr.Errors), err)
+	}
+
+	for _, fe := range verr.Errors {
+		if fe.File != filepath.Join("conf.d", "b.yaml") {
+			t.Errorf("Expected conflict to be reported in conf.d/b.yaml, got %s", fe.File)
+		}
+	}
+}
+
+func TestLoadFromFileIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"config.yaml": "include: a.yaml\nbackends:\n  - url: \"http://root:8081\"\n",
+		"a.yaml":      "include: b.yaml\n",
+		"b.yaml":      "include: a.yaml\n",
+	})
+
+	_, err := config.LoadFromFile(filepath.Join(dir, "config.yaml"))
+	if err == nil || !contains(err.Error(), "include cycle") {
+		t.Errorf("Expected include cycle error, got %v", err)
+	}
+}
+
 func contains(str, substr string) bool {
 	return len(str) >= len(substr) &&
 		(len(substr) == 0 || str[:len(str)-len(substr)+1] != str[:len(str)-len(substr)+1] ||
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/core"
+)
+
+func TestDashboard(t *testing.T) {
+	backend := newTestBackend(t, "one")
+	t.Setenv("BOLT_TEST_ADMIN_TOKENS", "read-only:ro-secret")
+	lb := newTestLB(t, fmt.Sprintf(`
+backends:
+  - url: %q
+admin:
+  auth:
+    tokens_env: BOLT_TEST_ADMIN_TOKENS
+`, backend.URL))
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		lb.AdminHandler().ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	page := get("/dashboard/", "")
+	if page.Code != http.StatusOK || !strings.Contains(page.Body.String(), `<script src="dashboard.js">`) {
+		t.Fatalf("Expected the dashboard page without a token, got %d:\n%s", page.Code, page.Body.String())
+	}
+	for _, asset := range []string{"/dashboard/dashboard.js", "/dashboard/dashboard.css"} {
+		if code := get(asset, "").Code; code != http.StatusOK {
+			t.Errorf("Expected 200 for %s, got %d", asset, code)
+		}
+	}
+	if redirect := get("/", ""); redirect.Code != http.StatusFound || redirect.Header().Get("Location") != "/dashboard/" {
+		t.Errorf("Expected / to redirect to the dashboard, got %d %q", redirect.Code, redirect.Header().Get("Location"))
+	}
+	if code := get("/status", "").Code; code != http.StatusUnauthorized {
+		t.Errorf("Expected the status API to still require a token, got %d", code)
+	}
+
+	lb.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	recorder := get("/status?history=true", "ro-secret")
+	var report core.StatusReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Status is not valid JSON: %v", err)
+	}
+	status := report.Pools[0].Backends[0]
+	if status.Requests != 1 || status.FailedRequests != 0 {
+		t.Errorf("Expected 1 request and no failures, got %d and %d", status.Requests, status.FailedRequests)
+	}
+	if len(status.RecentChecks) != 1 || !status.RecentChecks[0].Healthy {
+		t.Errorf("Expected one passed check in the history, got %+v", status.RecentChecks)
+	}
+
+	recorder = get("/status", "ro-secret")
+	if strings.Contains(recorder.Body.String(), "recent_checks") {
+		t.Error("Expected the check history only when requested")
+	}
+}
+
+func TestDashboardDisabled(t *testing.T) {
+	backend := newTestBackend(t, "one")
+	lb := newTestLB(t, fmt.Sprintf(`
+backends:
+  - url: %q
+admin:
+  dashboard: false
+`, backend.URL))
+
+	recorder := httptest.NewRecorder()
+	lb.AdminHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/dashboard/", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 with the dashboard disabled, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/core"
+)
+
+// readEvents decodes the server-sent events of body onto a channel.
+func readEvents(t *testing.T, resp *http.Response) <-chan core.Event {
+	events := make(chan core.Event, 16)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var event core.Event
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				t.Errorf("Invalid event %q: %v", data, err)
+				return
+			}
+			events <- event
+		}
+	}()
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan core.Event) core.Event {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("Event stream closed")
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for an event")
+	}
+	return core.Event{}
+}
+
+func TestEventStream(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/health" && !healthy.Load():
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/api/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(backend.Close)
+
+	lb := newTestLB(t, fmt.Sprintf(`
+backends:
+  - url: %q
+    max_fails: 2
+health_check:
+  interval: 50ms
+`, backend.URL))
+	admin := httptest.NewServer(lb.AdminHandler())
+	t.Cleanup(admin.Close)
+
+	resp, err := http.Get(admin.URL + "/events?types=health,reload,request&status=5xx&path_prefix=/api")
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Unexpected response %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	events := readEvents(t, resp)
+
+	for _, path := range []string{"/other", "/api/ok", "/api/fail"} {
+		lb.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	event := nextEvent(t, events)
+	if event.Type != core.EventRequest || event.Path != "/api/fail" || event.StatusCode != http.StatusInternalServerError ||
+		event.Backend != backend.URL || event.BackendID == "" {
+		t.Errorf("Expected only the failed /api request, got %+v", event)
+	}
+
+	healthy.Store(false)
+	event = nextEvent(t, events)
+	if event.Type != core.EventHealth || event.Previous != "healthy" || event.Current != "unhealthy" || event.Error == "" {
+		t.Errorf("Expected a healthy to unhealthy transition, got %+v", event)
+	}
+
+	if err := lb.Reload(); err == nil {
+		t.Fatal("Expected reload without a configuration file to fail")
+	}
+	event = nextEvent(t, events)
+	if event.Type != core.EventReload || event.Result != "failure" || event.Error == "" {
+		t.Errorf("Expected a failed reload event, got %+v", event)
+	}
+}
+
+func TestEventStreamFilters(t *testing.T) {
+	backend := newTestBackend(t, "one")
+	lb := newTestLB(t, fmt.Sprintf(`
+backends:
+  - url: %q
+`, backend.URL))
+
+	for _, query := range []string{"types=traffic", "status=6xx", "status=abc", "sample=0", "sample=2"} {
+		recorder := httptest.NewRecorder()
+		lb.AdminHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/events?"+query, nil))
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", query, recorder.Code)
+		}
+	}
+
+	admin := httptest.NewServer(lb.AdminHandler())
+	t.Cleanup(admin.Close)
+	resp, err := http.Get(admin.URL + "/events?types=request&backend=" + backend.URL + "/")
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	events := readEvents(t, resp)
+
+	lb.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/first", nil))
+	if event := nextEvent(t, events); event.Path != "/first" || event.StatusCode != http.StatusOK {
+		t.Errorf("Expected the request to the filtered backend, got %+v", event)
+	}
+}
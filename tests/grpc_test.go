@@ -0,0 +1,353 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+	"github.com/farhapartex/bolt-load-balancer/internal/core"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// newGRPCBackend starts an in-process gRPC server with the standard health
+// service. Unary calls get an x-backend header and trailer naming the
+// backend, and wait for the duration in x-sleep when one is sent.
+func newGRPCBackend(t *testing.T, name string) (string, *health.Server) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	healthServer := health.NewServer()
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		grpc.SetHeader(ctx, metadata.Pairs("x-backend", name))
+		grpc.SetTrailer(ctx, metadata.Pairs("x-backend-trailer", name))
+		md, _ := metadata.FromIncomingContext(ctx)
+		if sleep := md.Get("x-sleep"); len(sleep) > 0 {
+			duration, _ := time.ParseDuration(sleep[0])
+			time.Sleep(duration)
+		}
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return "http://" + listener.Addr().String(), healthServer
+}
+
+// startGRPCLB starts bolt with an h2c listener, settles backend health and
+// returns a gRPC client connected to it.
+func startGRPCLB(t *testing.T, yamlConfig string) (*core.LB, int, *grpc.ClientConn) {
+	t.Helper()
+	port := freePort(t)
+	lb := startLB(t, fmt.Sprintf("server:\n  host: 127.0.0.1\n  port: %d\n  h2c: true\nadmin:\n  enabled: false\n%s", port, yamlConfig))
+	waitForListener(t, port)
+	waitForHealthChecks(t, lb)
+
+	conn, err := grpc.NewClient(fmt.Sprintf("127.0.0.1:%d", port), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to create gRPC client: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return lb, port, conn
+}
+
+func TestGRPCPerCallBalancing(t *testing.T) {
+	urlA, healthA := newGRPCBackend(t, "a")
+	urlB, healthB := newGRPCBackend(t, "b")
+
+	_, _, conn := startGRPCLB(t, fmt.Sprintf(`
+backends:
+  - url: %q
+    protocol: h2c
+  - url: %q
+    protocol: h2c
+health_check:
+  type: grpc
+`, urlA, urlB))
+	client := healthpb.NewHealthClient(conn)
+
+	// All calls share one client connection, yet are spread per call.
+	seen := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		var header, trailer metadata.MD
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}, grpc.Header(&header), grpc.Trailer(&trailer))
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		if resp.Status != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("Expected SERVING, got %s", resp.Status)
+		}
+		backend := strings.Join(header.Get("x-backend"), ",")
+		if got := strings.Join(trailer.Get("x-backend-trailer"), ","); got != backend {
+			t.Errorf("Expected trailer x-backend-trailer %q, got %q", backend, got)
+		}
+		seen[backend]++
+	}
+	if seen["a"] != 3 || seen["b"] != 3 {
+		t.Errorf("Expected calls to alternate between backends, got %v", seen)
+	}
+
+	// grpc-status and grpc-message from the backend reach the client.
+	_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "missing"})
+	if status.Code(err) != codes.NotFound || status.Convert(err).Message() != "unknown service" {
+		t.Errorf("Expected NotFound: unknown service, got %v", err)
+	}
+
+	// Server streams pass through as the backend sends.
+	healthA.SetServingStatus("bolt.Watch", healthpb.HealthCheckResponse_SERVING)
+	healthB.SetServingStatus("bolt.Watch", healthpb.HealthCheckResponse_SERVING)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: "bolt.Watch"})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	if resp, err := stream.Recv(); err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("Expected SERVING first, got %v (%v)", resp, err)
+	}
+	healthA.SetServingStatus("bolt.Watch", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthB.SetServingStatus("bolt.Watch", healthpb.HealthCheckResponse_NOT_SERVING)
+	if resp, err := stream.Recv(); err != nil || resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Expected NOT_SERVING to be streamed, got %v (%v)", resp, err)
+	}
+}
+
+func TestGRPCErrorMapping(t *testing.T) {
+	grpcURL, _ := newGRPCBackend(t, "a")
+
+	dead, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	deadURL := "http://" + dead.Addr().String()
+	dead.Close()
+
+	plain := newH2CBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/health":
+		case strings.HasSuffix(r.URL.Path, "/Watch"):
+			panic(http.ErrAbortHandler)
+		case r.Header.Get("X-Status") == "429":
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		default:
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+		}
+	})
+
+	lb, port, conn := startGRPCLB(t, fmt.Sprintf(`
+pools:
+  - name: grpc
+    backends:
+      - url: %q
+        protocol: h2c
+    health_check:
+      enabled: true
+      type: grpc
+  - name: down
+    backends:
+      - url: %q
+        protocol: h2c
+        max_fails: 1
+  - name: plain
+    backends:
+      - url: %q
+        protocol: h2c
+routes:
+  - match:
+      path_prefix: /grpc.health.v1.Health/
+      headers:
+        x-pool: grpc
+    pool: grpc
+  - match:
+      path_prefix: /grpc.health.v1.Health/
+      headers:
+        x-pool: down
+    pool: down
+  - match:
+      path_prefix: /grpc.health.v1.Health/
+      headers:
+        x-pool: plain
+    pool: plain
+`, grpcURL, deadURL, plain.URL))
+	client := healthpb.NewHealthClient(conn)
+
+	call := func(ctx context.Context, pool string, kv ...string) error {
+		ctx = metadata.AppendToOutgoingContext(ctx, append([]string{"x-pool", pool}, kv...)...)
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		return err
+	}
+
+	tests := []struct {
+		pool     string
+		metadata []string
+		code     codes.Code
+		message  string
+	}{
+		{"none", nil, codes.Unimplemented, "Not Found"},
+		{"down", nil, codes.Unavailable, "Service Unavailable"},
+		{"plain", nil, codes.Unavailable, "backend returned HTTP 503"},
+		{"plain", []string{"x-status", "429"}, codes.Unavailable, "backend returned HTTP 429"},
+	}
+	for _, tc := range tests {
+		err := call(context.Background(), tc.pool, tc.metadata...)
+		if status.Code(err) != tc.code || status.Convert(err).Message() != tc.message {
+			t.Errorf("Pool %s %v: expected %s: %s, got %v", tc.pool, tc.metadata, tc.code, tc.message, err)
+		}
+	}
+
+	// A stream reset by the backend is reported as unavailable.
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-pool", "plain")
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unavailable || status.Convert(err).Message() != "Bad Gateway" {
+		t.Errorf("Expected Unavailable: Bad Gateway, got %v", err)
+	}
+
+	// bolt enforces grpc-timeout itself and reports DEADLINE_EXCEEDED.
+	transport := h2cClient()
+	req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/grpc.health.v1.Health/Check", port),
+		bytes.NewReader([]byte{0, 0, 0, 0, 0}))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("Grpc-Timeout", "50m")
+	req.Header.Set("X-Pool", "grpc")
+	req.Header.Set("X-Sleep", "1s")
+	start := time.Now()
+	resp, err := transport.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Grpc-Status") != "4" {
+		t.Errorf("Expected a trailers-only response with grpc-status 4, got %d %q", resp.StatusCode, resp.Header.Get("Grpc-Status"))
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the call to end at its deadline, took %s", elapsed)
+	}
+
+	// The caller's deadline does not count against the backend.
+	if err := call(context.Background(), "grpc"); err != nil {
+		t.Errorf("Expected the backend to stay in rotation after a deadline, got %v", err)
+	}
+
+	// Neither does a call the caller cancels.
+	before := lb.Status().Pools[0].Backends[0]
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err := call(ctx, "grpc", "x-sleep", "1s"); status.Code(err) != codes.Canceled {
+		t.Errorf("Expected Canceled, got %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	after := lb.Status().Pools[0].Backends[0]
+	for after.Requests == before.Requests && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		after = lb.Status().Pools[0].Backends[0]
+	}
+	if after.Requests != before.Requests+1 {
+		t.Fatalf("Expected the canceled call to be recorded, got %d requests after %d", after.Requests, before.Requests)
+	}
+	if after.FailCount != before.FailCount || after.FailedRequests != before.FailedRequests {
+		t.Errorf("Expected a canceled call to leave the backend's failures at %d and %d, got %d and %d",
+			before.FailCount, before.FailedRequests, after.FailCount, after.FailedRequests)
+	}
+
+	// Failed calls are recorded with the HTTP status they were mapped from,
+	// not the 200 that carries the gRPC status: the backend's 503 and the
+	// reset stream's 502 for the plain pool, 504 for the deadline.
+	for _, pool := range lb.Status().Pools {
+		expected := map[string]int64{"grpc": 1, "plain": 2}[pool.Name]
+		if got := pool.Backends[0].FailedRequests; pool.Name != "down" && got != expected {
+			t.Errorf("Pool %s: expected %d failed requests, got %d", pool.Name, expected, got)
+		}
+	}
+	metrics := httptest.NewRecorder()
+	lb.AdminHandler().ServeHTTP(metrics, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, line := range []string{
+		fmt.Sprintf(`bolt_requests_total{pool="plain",backend=%q,method="POST",code="5xx"} 2`, plain.URL),
+		fmt.Sprintf(`bolt_requests_total{pool="grpc",backend=%q,method="POST",code="5xx"} 1`, grpcURL),
+	} {
+		if !strings.Contains(metrics.Body.String(), line+"\n") {
+			t.Errorf("Expected line %q in metrics", line)
+		}
+	}
+}
+
+func TestGRPCHealthCheck(t *testing.T) {
+	servingURL, serving := newGRPCBackend(t, "serving")
+	notServingURL, notServing := newGRPCBackend(t, "not-serving")
+	notServing.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	serving.SetServingStatus("bolt.Test", healthpb.HealthCheckResponse_SERVING)
+
+	tests := []struct {
+		name     string
+		service  string
+		expected []string
+		errors   []string
+	}{
+		{"server", "", []string{"healthy", "unhealthy"}, []string{"", "reports NOT_SERVING"}},
+		{"service", "bolt.Test", []string{"healthy", "unhealthy"}, []string{"", "grpc-status 5: unknown service"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			lb := newTestLB(t, fmt.Sprintf(`
+backends:
+  - url: %q
+    protocol: h2c
+    max_fails: 1
+  - url: %q
+    protocol: h2c
+    max_fails: 1
+health_check:
+  type: grpc
+  grpc_service: %q
+`, servingURL, notServingURL, tc.service))
+
+			if got := lb.Status().Pools[0].HealthCheck.Type; got != "grpc" {
+				t.Errorf("Expected the status report to show health check type grpc, got %q", got)
+			}
+			for i, backend := range lb.Status().Pools[0].Backends {
+				if backend.Status != tc.expected[i] || !strings.Contains(backend.LastCheckError, tc.errors[i]) {
+					t.Errorf("Expected backend %d to be %s (%q), got %s (%s)",
+						i, tc.expected[i], tc.errors[i], backend.Status, backend.LastCheckError)
+				}
+			}
+		})
+	}
+}
+
+func TestGRPCValidation(t *testing.T) {
+	tests := []struct {
+		yaml     string
+		expected string
+	}{
+		{"backends:\n  - url: \"http://127.0.0.1:9000\"\nhealth_check:\n  type: grpc\n", "gRPC health checks need HTTP/2"},
+		{"backends:\n  - url: \"http://127.0.0.1:9000\"\nhealth_check:\n  type: tcp\n", `invalid health check type "tcp"`},
+		{"backends:\n  - url: \"http://127.0.0.1:9000\"\nhealth_check:\n  grpc_service: bolt\n", "grpc_service needs type grpc"},
+		{"pools:\n  - name: api\n    backends:\n      - url: \"https://127.0.0.1:9000\"\n        protocol: http1\n    health_check:\n      type: grpc\n", "gRPC health checks need HTTP/2"},
+	}
+	for _, tc := range tests {
+		_, err := config.LoadFromBytes([]byte(tc.yaml))
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("Expected error containing %q, got %v", tc.expected, err)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package tests
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+)
+
+// newH2CBackend starts a backend that accepts cleartext HTTP/2 with prior
+// knowledge as well as HTTP/1.1.
+func newH2CBackend(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetHTTP1(true)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// protoBackend reports the protocol each request arrived with in X-Proto.
+func protoBackend(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Proto", r.Proto)
+}
+
+// h2cClient speaks cleartext HTTP/2 with prior knowledge.
+func h2cClient() *http.Client {
+	transport := &http.Transport{Protocols: new(http.Protocols)}
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	return &http.Client{Transport: transport}
+}
+
+func waitForListener(t *testing.T, port int) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("Load balancer did not start listening")
+}
+
+func TestFrontendHTTP2(t *testing.T) {
+	backend := newTestBackend(t, "one")
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue("server", "a.example", "a.example")
+	tlsPort := freePort(t)
+
+	startTLSLB(t, fmt.Sprintf(`
+server:
+  host: 127.0.0.1
+  port: %d
+  tls:
+    cert_file: %q
+    key_file: %q
+  http2:
+    max_concurrent_streams: 50
+backends:
+  - url: %q
+admin:
+  enabled: false
+`, tlsPort, serverCert, serverKey, backend.URL), tlsPort, ca)
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: ca.pool(), ServerName: "a.example"},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get(fmt.Sprintf("https://127.0.0.1:%d/", tlsPort))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("Expected HTTP/2 over TLS, got %s", resp.Proto)
+	}
+
+	plainPort := freePort(t)
+	startLB(t, fmt.Sprintf(`
+server:
+  host: 127.0.0.1
+  port: %d
+  h2c: true
+backends:
+  - url: %q
+admin:
+  enabled: false
+`, plainPort, backend.URL))
+	waitForListener(t, plainPort)
+
+	resp, err = h2cClient().Get(fmt.Sprintf("http://127.0.0.1:%d/", plainPort))
+	if err != nil {
+		t.Fatalf("h2c request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 || resp.Header.Get("X-Test-Backend") != "one" {
+		t.Errorf("Expected an h2c response from the backend, got %s %q", resp.Proto, resp.Header.Get("X-Test-Backend"))
+	}
+
+	resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%d/", plainPort))
+	if err != nil {
+		t.Fatalf("HTTP/1.1 request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 1 {
+		t.Errorf("Expected HTTP/1.1 to keep working with h2c, got %s", resp.Proto)
+	}
+}
+
+func TestBackendProtocols(t *testing.T) {
+	h2c := newH2CBackend(t, protoBackend)
+	h2 := httptest.NewUnstartedServer(http.HandlerFunc(protoBackend))
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	t.Cleanup(h2.Close)
+
+	tests := []struct {
+		name     string
+		backend  string
+		expected string
+	}{
+		{"cleartext defaults to HTTP/1.1", fmt.Sprintf("url: %q", h2c.URL), "HTTP/1.1"},
+		{"h2c", fmt.Sprintf("url: %q\n    protocol: h2c", h2c.URL), "HTTP/2.0"},
+		{"TLS negotiates h2", fmt.Sprintf("url: %q\n    tls:\n      insecure_skip_verify: true", h2.URL), "HTTP/2.0"},
+		{"h2", fmt.Sprintf("url: %q\n    protocol: h2\n    tls:\n      insecure_skip_verify: true", h2.URL), "HTTP/2.0"},
+		{"http1 over TLS", fmt.Sprintf("url: %q\n    protocol: http1\n    tls:\n      insecure_skip_verify: true", h2.URL), "HTTP/1.1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			lb := newTestLB(t, fmt.Sprintf("backends:\n  - %s\n", tc.backend))
+			if status := lb.Status().Pools[0].Backends[0]; status.Status != "healthy" {
+				t.Errorf("Expected the health check to pass, got %s (%s)", status.Status, status.LastCheckError)
+			}
+
+			recorder := httptest.NewRecorder()
+			lb.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+			if got := recorder.Header().Get("X-Proto"); recorder.Code != http.StatusOK || got != tc.expected {
+				t.Errorf("Expected the backend to see %s, got %d %q", tc.expected, recorder.Code, got)
+			}
+		})
+	}
+}
+
+func TestBackendHTTP2Multiplexing(t *testing.T) {
+	var mutex sync.Mutex
+	conns := make(map[string]bool)
+	release := make(chan struct{})
+	backend := newH2CBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			return
+		}
+		mutex.Lock()
+		conns[r.RemoteAddr] = true
+		mutex.Unlock()
+		<-release
+	})
+
+	lb := newTestLB(t, fmt.Sprintf(`
+backends:
+  - url: %q
+    protocol: h2c
+    http2:
+      max_connections: 1
+      ping_interval: 10s
+      ping_timeout: 2s
+`, backend.URL))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lb.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(conns) != 1 {
+		t.Errorf("Expected 10 concurrent requests to share one HTTP/2 connection, got %d connections", len(conns))
+	}
+}
+
+func TestHTTP2StreamingAndTrailers(t *testing.T) {
+	release := make(chan struct{})
+	backend := newH2CBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			return
+		}
+		w.Header().Set("Trailer", "X-Checksum")
+		io.WriteString(w, "first\n")
+		http.NewResponseController(w).Flush()
+		<-release
+		io.WriteString(w, "second\n")
+		w.Header().Set("X-Checksum", "abc123")
+		w.Header().Set(http.TrailerPrefix+"X-Late", "undeclared")
+	})
+
+	port := freePort(t)
+	startLB(t, fmt.Sprintf(`
+server:
+  host: 127.0.0.1
+  port: %d
+  h2c: true
+backends:
+  - url: %q
+    protocol: h2c
+admin:
+  enabled: false
+`, port, backend.URL))
+	waitForListener(t, port)
+
+	resp, err := h2cClient().Get(fmt.Sprintf("http://127.0.0.1:%d/stream", port))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	if err != nil || line != "first\n" {
+		t.Fatalf("Expected the first chunk before the backend finished, got %q (%v)", line, err)
+	}
+	close(release)
+	rest, err := io.ReadAll(reader)
+	if err != nil || string(rest) != "second\n" {
+		t.Fatalf("Expected the rest of the stream, got %q (%v)", rest, err)
+	}
+	if got := resp.Trailer.Get("X-Checksum"); got != "abc123" {
+		t.Errorf("Expected trailer X-Checksum abc123, got %q", got)
+	}
+	if got := resp.Trailer.Get("X-Late"); got != "undeclared" {
+		t.Errorf("Expected undeclared trailer X-Late, got %q", got)
+	}
+}
+
+func TestStreamsOutliveServerTimeouts(t *testing.T) {
+	backend := newH2CBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			return
+		}
+		if r.URL.Path == "/events" {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			w.Header().Set("Content-Type", "text/plain")
+		}
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			http.NewResponseController(w).Flush()
+			time.Sleep(200 * time.Millisecond)
+		}
+	})
+
+	port := freePort(t)
+	lb := startLB(t, fmt.Sprintf(`
+server:
+  host: 127.0.0.1
+  port: %d
+  h2c: true
+  read_timeout: 250ms
+  write_timeout: 250ms
+backends:
+  - url: %q
+admin:
+  enabled: false
+`, port, backend.URL))
+	waitForListener(t, port)
+	waitForHealthChecks(t, lb)
+
+	clients := map[string]*http.Client{"HTTP/2": h2cClient(), "HTTP/1.1": http.DefaultClient}
+	for name, client := range clients {
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/events", port), nil)
+		req.Header.Set("Accept", "text/event-stream")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", name, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || strings.Count(string(body), "data:") != 3 {
+			t.Errorf("%s: expected the stream to outlive write_timeout, got %q (%v)", name, body, err)
+		}
+
+		// Asking for an event stream does not lift the timeouts when the
+		// backend answers with anything else.
+		req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/report", port), nil)
+		req.Header.Set("Accept", "text/event-stream")
+		resp, err = client.Do(req)
+		if err == nil {
+			body, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		if err == nil && strings.Count(string(body), "data:") == 3 {
+			t.Errorf("%s: expected write_timeout to cut off a plain response, got %q", name, body)
+		}
+	}
+}
+
+func TestHTTP2Validation(t *testing.T) {
+	tests := []struct {
+		yaml     string
+		expected string
+	}{
+		{"backends:\n  - url: \"http://127.0.0.1:9000\"\n    protocol: h2\n", "protocol h2 needs an https:// backend URL"},
+		{"backends:\n  - url: \"https://127.0.0.1:9000\"\n    protocol: h2c\n", "protocol h2c needs an http:// backend URL"},
+		{"backends:\n  - url: \"http://127.0.0.1:9000\"\n    protocol: spdy\n", `invalid protocol "spdy"`},
+		{"backends:\n  - url: \"http://127.0.0.1:9000\"\n    http2:\n      max_connections: -1\n", "max_connections must not be negative"},
+		{"backends:\n  - url: \"http://127.0.0.1:9000\"\n    http2:\n      ping_timeout: 5s\n", "ping_timeout needs ping_interval"},
+		{"server:\n  h2c: true\n  tls:\n    cert_file: a.pem\n    key_file: a-key.pem\nbackends:\n  - url: \"http://127.0.0.1:9000\"\n", "h2c needs a plain HTTP listener"},
+		{"server:\n  http2:\n    max_concurrent_streams: -5\nbackends:\n  - url: \"http://127.0.0.1:9000\"\n", "max_concurrent_streams must not be negative"},
+	}
+	for _, tc := range tests {
+		_, err := config.LoadFromBytes([]byte(tc.yaml))
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("Expected error containing %q, got %v", tc.expected, err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+	"github.com/farhapartex/bolt-load-balancer/internal/logger"
+)
+
+func TestLoggerWithFields(t *testing.T) {
+	var buf bytes.Buffer
+	lgr := logger.NewLogger(config.LoggingConfig{Level: "debug", Format: "json", AccessLog: true})
+	lgr.SetOutput(&buf)
+
+	reqLogger := lgr.With(map[string]interface{}{"request_id": "req-1"})
+	reqLogger.LogRequest("GET", "/", "127.0.0.1:1234", "-", 200, time.Millisecond)
+	reqLogger.LogBackendRequest("http://backend:8080", "GET", "/", 0, time.Millisecond, errors.New("connection refused"))
+	reqLogger.Warn("No healthy backends available")
+	lgr.Info("unrelated line")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 log lines, got %d: %s", len(lines), buf.String())
+	}
+
+	for i, line := range lines {
+		var entry logger.LogEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Line %d is not valid JSON: %v", i, err)
+		}
+
+		requestID, ok := entry.Fields["request_id"]
+		if i < 3 && requestID != "req-1" {
+			t.Errorf("Line %d: expected request_id req-1, got %v", i, requestID)
+		}
+		if i == 3 && ok {
+			t.Errorf("Parent logger should not carry request_id, got %v", requestID)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/metrics"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	registry := metrics.NewRegistry()
+	requests := registry.NewCounterVec("test_requests_total", "Requests seen.", "method", "code")
+	inFlight := registry.NewGaugeVec("test_in_flight", "Requests in flight.")
+	latency := registry.NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+
+	requests.Inc("GET", "2xx")
+	requests.Inc("GET", "2xx")
+	requests.Inc("POST", "5xx")
+	inFlight.Add(3)
+	inFlight.Add(-1)
+	latency.Observe(0.05, `a"b`)
+	latency.Observe(0.5, `a"b`)
+
+	var buf bytes.Buffer
+	registry.WriteText(&buf)
+	output := buf.String()
+
+	expected := []string{
+		"# HELP test_requests_total Requests seen.",
+		"# TYPE test_requests_total counter",
+		`test_requests_total{method="GET",code="2xx"} 2`,
+		`test_requests_total{method="POST",code="5xx"} 1`,
+		"# TYPE test_in_flight gauge",
+		"test_in_flight 2",
+		"# TYPE test_latency_seconds histogram",
+		`test_latency_seconds_bucket{route="a\"b",le="0.1"} 1`,
+		`test_latency_seconds_bucket{route="a\"b",le="1"} 2`,
+		`test_latency_seconds_bucket{route="a\"b",le="+Inf"} 2`,
+		`test_latency_seconds_sum{route="a\"b"} 0.55`,
+		`test_latency_seconds_count{route="a\"b"} 2`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected line %q in output:\n%s", line, output)
+		}
+	}
+}
+
+func TestProxyMetrics(t *testing.T) {
+	backend := newTestBackend(t, "one")
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(failing.Close)
+
+	lb := newTestLB(t, fmt.Sprintf(`
+pools:
+  - name: web
+    backends:
+      - url: %q
+  - name: broken
+    backends:
+      - url: %q
+routes:
+  - match:
+      path_prefix: /broken
+    pool: broken
+  - match:
+      path_prefix: /
+    pool: web
+`, backend.URL, failing.URL))
+
+	for _, path := range []string{"/", "/a", "/broken"} {
+		lb.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	recorder := httptest.NewRecorder()
+	lb.AdminHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Expected text/plain content type, got %q", recorder.Header().Get("Content-Type"))
+	}
+	output := recorder.Body.String()
+
+	expected := []string{
+		fmt.Sprintf(`bolt_requests_total{pool="web",backend=%q,method="GET",code="2xx"} 2`, backend.URL),
+		`bolt_requests_total{pool="broken",backend="none",method="GET",code="5xx"} 1`,
+		`bolt_request_duration_seconds_count{pool="web",method="GET"} 2`,
+		fmt.Sprintf(`bolt_upstream_latency_seconds_count{pool="web",backend=%q} 2`, backend.URL),
+		"bolt_in_flight_requests 0",
+		fmt.Sprintf(`bolt_backend_up{pool="web",backend=%q} 1`, backend.URL),
+		fmt.Sprintf(`bolt_backend_up{pool="broken",backend=%q} 0`, failing.URL),
+		`bolt_pool_backends{pool="web"} 1`,
+		`bolt_pool_healthy_backends{pool="broken"} 0`,
+		fmt.Sprintf(`bolt_health_checks_total{pool="web",backend=%q,result="success"} 1`, backend.URL),
+		fmt.Sprintf(`bolt_health_checks_total{pool="broken",backend=%q,result="failure"} 1`, failing.URL),
+		`bolt_config_reloads_total{result="success"} 0`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected line %q in metrics:\n%s", line, output)
+		}
+	}
+}
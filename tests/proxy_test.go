@@ -0,0 +1,444 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+	"github.com/farhapartex/bolt-load-balancer/internal/core"
+)
+
+// newTestBackend starts a backend that echoes the request it received in
+// response headers: the upstream URI as X-Test-Path and every request header
+// prefixed with X-Seen-.
+func newTestBackend(t *testing.T, name string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		for header, values := range r.Header {
+			w.Header()["X-Seen-"+header] = values
+		}
+		w.Header().Set("Server", "test-backend")
+		w.Header().Set("X-Test-Backend", name)
+		w.Header().Set("X-Test-Path", r.URL.RequestURI())
+		fmt.Fprintf(w, "response from %s", name)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestLB builds a load balancer from a YAML config and starts it once
+// every backend has been health checked.
+func newTestLB(t *testing.T, yamlConfig string) *core.LB {
+	cfg, err := config.LoadFromBytes([]byte(yamlConfig))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	cfg.Logging.AccessLog = false
+	cfg.Logging.Level = "error"
+	return startCheckedLB(t, cfg)
+}
+
+// startCheckedLB starts a load balancer for cfg on free loopback ports and
+// waits for the first health check of every backend.
+func startCheckedLB(t *testing.T, cfg *config.Config) *core.LB {
+	t.Helper()
+	cfg.Server.Host = "127.0.0.1"
+	cfg.Server.Port = freePort(t)
+	if cfg.Admin.Enabled && cfg.Admin.Port != 0 {
+		cfg.Admin.Host = "127.0.0.1"
+		cfg.Admin.Port = freePort(t)
+	}
+
+	lb, err := core.NewLB(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create load balancer: %v", err)
+	}
+	lb.Logger().SetOutput(io.Discard)
+	go lb.Start()
+	t.Cleanup(func() { lb.Stop(context.Background()) })
+	waitForHealthChecks(t, lb)
+	return lb
+}
+
+// waitForHealthChecks waits until every backend of lb has been checked.
+func waitForHealthChecks(t *testing.T, lb *core.LB) {
+	t.Helper()
+	for i := 0; i < 250; i++ {
+		checked := true
+		for _, pool := range lb.Status().Pools {
+			for _, backend := range pool.Backends {
+				checked = checked && backend.LastCheck != nil
+			}
+		}
+		if checked {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("Backends were not health checked")
+}
+
+func TestProxyPathRewriting(t *testing.T) {
+	users := newTestBackend(t, "users")
+	legacy := newTestBackend(t, "legacy")
+
+	lb := newTestLB(t, fmt.Sprintf(`
+pools:
+  - name: users
+    backends:
+      - url: %q
+  - name: legacy
+    backends:
+      - url: %q
+routes:
+  - match:
+      path_prefix: /api/users/
+    strip_prefix: /api
+    pool: users
+  - match:
+      path_prefix: /v1/
+    rewrite:
+      pattern: "^/v1/items/([0-9]+)$"
+      replacement: "/item.php?id=$1"
+    add_prefix: /legacy
+    pool: legacy
+  - match:
+      path_prefix: /
+    pool: users
+`, users.URL, legacy.URL))
+
+	tests := []struct {
+		target       string
+		backend      string
+		upstreamPath string
+		originalURI  string
+	}{
+		{"/api/users/42?full=1", "users", "/users/42?full=1", "/api/users/42?full=1"},
+		{"/v1/items/7", "legacy", "/legacy/item.php?id=7", "/v1/items/7"},
+		{"/v1/items/8?lang=en", "legacy", "/legacy/item.php?id=8&lang=en", "/v1/items/8?lang=en"},
+		{"/plain", "users", "/plain", ""},
+	}
+
+	for _, tt := range tests {
+		// A client's X-Original-URI is replaced, or dropped when the path is
+		// not rewritten.
+		req := httptest.NewRequest("GET", tt.target, nil)
+		req.Header.Set("X-Original-URI", "/spoofed")
+		rec := httptest.NewRecorder()
+		lb.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tt.target, rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("X-Test-Backend"); got != tt.backend {
+			t.Errorf("%s: expected backend %s, got %s", tt.target, tt.backend, got)
+		}
+		if got := rec.Header().Get("X-Test-Path"); got != tt.upstreamPath {
+			t.Errorf("%s: expected upstream path %s, got %s", tt.target, tt.upstreamPath, got)
+		}
+		if got := rec.Header().Get("X-Seen-X-Original-Uri"); got != tt.originalURI {
+			t.Errorf("%s: expected X-Original-URI %q, got %q", tt.target, tt.originalURI, got)
+		}
+	}
+}
+
+func TestRoutePathRewrite(t *testing.T) {
+	pools := createTestPools(t, "svc")
+
+	router, err := core.NewRouter([]config.RouteConfig{
+		{Match: config.RouteMatch{PathPrefix: "/api/"}, StripPrefix: "/api", AddPrefix: "/v2/", Pool: "svc"},
+		{Match: config.RouteMatch{PathPrefix: "/exact"}, StripPrefix: "/exact", Pool: "svc"},
+	}, pools, "")
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+
+	tests := map[string]string{
+		"/api/users/1": "/v2/users/1",
+		"/exact":       "/",
+	}
+	for path, expected := range tests {
+		route := router.Match(httptest.NewRequest("GET", path, nil))
+		if got := route.RewritePath(path); got != expected {
+			t.Errorf("RewritePath(%s): expected %s, got %s", path, expected, got)
+		}
+	}
+}
+
+func TestProxyHeaderRules(t *testing.T) {
+	backend := newTestBackend(t, "app")
+
+	lb := newTestLB(t, fmt.Sprintf(`
+request_headers:
+  remove: ["X-Internal-Token"]
+  set:
+    X-Client: "$remote_addr"
+response_headers:
+  remove: ["Server"]
+  set:
+    X-Backend: "$backend_url"
+pools:
+  - name: app
+    backends:
+      - url: %q
+        request_headers:
+          add:
+            X-Backend-Hint: "primary"
+routes:
+  - match:
+      path_prefix: /
+    pool: app
+    request_headers:
+      set:
+        X-Route: "$route/$pool"
+        X-Unknown: "$not_a_variable"
+        X-Braced: "${not_a_variable} ${pool}"
+    response_headers:
+      add:
+        X-Request-Id-Echo: "$request_id"
+`, backend.URL))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.9:51234"
+	req.Header.Set("X-Internal-Token", "secret")
+	req.Header.Set("X-Request-ID", "abc123")
+
+	rec := httptest.NewRecorder()
+	lb.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	expected := map[string]string{
+		"X-Seen-X-Internal-Token": "",
+		"X-Seen-X-Client":         "203.0.113.9",
+		"X-Seen-X-Backend-Hint":   "primary",
+		"X-Seen-X-Route":          "route-0/app",
+		"X-Seen-X-Unknown":        "$not_a_variable",
+		"X-Seen-X-Braced":         "${not_a_variable} app",
+		"Server":                  "",
+		"X-Backend":               backend.URL,
+		"X-Request-Id-Echo":       "abc123",
+	}
+	for header, value := range expected {
+		if got := rec.Header().Get(header); got != value {
+			t.Errorf("Header %s: expected %q, got %q", header, value, got)
+		}
+	}
+}
+
+func TestProxyHeaderRulesOnErrors(t *testing.T) {
+	// Healthy, but drops every proxied request.
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			panic(http.ErrAbortHandler)
+		}
+	}))
+	t.Cleanup(broken.Close)
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	lb := newTestLB(t, fmt.Sprintf(`
+response_headers:
+  set:
+    X-Served-By: bolt
+    X-Pool: "$pool"
+pools:
+  - name: broken
+    backends:
+      - url: %q
+        response_headers:
+          set:
+            X-Backend: "$backend_url"
+  - name: dead
+    backends:
+      - url: %q
+routes:
+  - match:
+      path_prefix: /broken
+    pool: broken
+    response_headers:
+      set:
+        X-Route: "$route"
+  - match:
+      path_prefix: /dead
+    pool: dead
+    response_headers:
+      set:
+        X-Route: "$route"
+`, broken.URL, dead.URL))
+
+	// bolt's own error responses get the rules known at that point.
+	tests := []struct {
+		path     string
+		status   int
+		expected map[string]string
+	}{
+		{"/none", http.StatusNotFound, map[string]string{"X-Served-By": "bolt", "X-Pool": "", "X-Route": "", "X-Backend": ""}},
+		{"/dead", http.StatusServiceUnavailable, map[string]string{"X-Served-By": "bolt", "X-Pool": "dead", "X-Route": "route-1", "X-Backend": ""}},
+		{"/broken", http.StatusBadGateway, map[string]string{"X-Served-By": "bolt", "X-Route": "route-0", "X-Backend": broken.URL}},
+	}
+	for _, tc := range tests {
+		rec := httptest.NewRecorder()
+		lb.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if rec.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d", tc.path, tc.status, rec.Code)
+		}
+		for header, value := range tc.expected {
+			if got := rec.Header().Get(header); got != value {
+				t.Errorf("%s: header %s: expected %q, got %q", tc.path, header, value, got)
+			}
+		}
+	}
+}
+
+func TestProxyForwardedHeaders(t *testing.T) {
+	backend := newTestBackend(t, "app")
+
+	lb := newTestLB(t, fmt.Sprintf(`
+server:
+  trusted_proxies: ["10.0.0.0/8", "192.0.2.10"]
+  forwarded_header: true
+backends:
+  - url: %q
+`, backend.URL))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   map[string]string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "198.51.100.7:40000",
+			headers: map[string]string{
+				"X-Forwarded-For":   "1.2.3.4",
+				"X-Forwarded-Proto": "https",
+				"Forwarded":         "for=1.2.3.4",
+			},
+			expected: map[string]string{
+				"X-Seen-X-Forwarded-For":   "198.51.100.7",
+				"X-Seen-X-Real-Ip":         "198.51.100.7",
+				"X-Seen-X-Forwarded-Proto": "http",
+				"X-Seen-X-Forwarded-Host":  "shop.example.com",
+				"X-Seen-X-Forwarded-Port":  "80",
+				"X-Seen-Forwarded":         "for=198.51.100.7;host=shop.example.com;proto=http",
+			},
+		},
+		{
+			name:       "behind trusted proxies",
+			remoteAddr: "10.1.2.3:40000",
+			headers: map[string]string{
+				"X-Forwarded-For":   "203.0.113.5, 192.0.2.10",
+				"X-Forwarded-Proto": "https",
+				"Forwarded":         "for=203.0.113.5",
+			},
+			expected: map[string]string{
+				"X-Seen-X-Forwarded-For":   "203.0.113.5, 192.0.2.10, 10.1.2.3",
+				"X-Seen-X-Real-Ip":         "203.0.113.5",
+				"X-Seen-X-Forwarded-Proto": "https",
+				"X-Seen-X-Forwarded-Port":  "443",
+				"X-Seen-Forwarded":         "for=203.0.113.5, for=10.1.2.3;host=shop.example.com;proto=https",
+			},
+		},
+		{
+			name:       "spoofed chain through trusted proxy",
+			remoteAddr: "10.1.2.3:40000",
+			headers: map[string]string{
+				"X-Forwarded-For": "9.9.9.9, 198.51.100.7",
+			},
+			expected: map[string]string{
+				"X-Seen-X-Real-Ip": "198.51.100.7",
+			},
+		},
+		{
+			name:       "ipv6 client",
+			remoteAddr: "[2001:db8::1]:40000",
+			expected: map[string]string{
+				"X-Seen-X-Forwarded-For": "2001:db8::1",
+				"X-Seen-Forwarded":       `for="[2001:db8::1]";host=shop.example.com;proto=http`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://shop.example.com/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			rec := httptest.NewRecorder()
+			lb.ServeHTTP(rec, req)
+
+			for header, value := range tt.expected {
+				if got := strings.Join(rec.Header().Values(header), ", "); got != value {
+					t.Errorf("Header %s: expected %q, got %q", header, value, got)
+				}
+			}
+		})
+	}
+}
+
+func TestProxyRequestID(t *testing.T) {
+	backend := newTestBackend(t, "app")
+	lb := newTestLB(t, fmt.Sprintf(`
+backends:
+  - url: %q
+`, backend.URL))
+
+	rec := httptest.NewRecorder()
+	lb.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	generated := rec.Header().Values("X-Request-Id")
+	if len(generated) != 1 {
+		t.Fatalf("Expected exactly one X-Request-ID in response, got %v", generated)
+	}
+	if !uuidV7Pattern.MatchString(generated[0]) {
+		t.Errorf("Expected a UUIDv7 request ID, got %q", generated[0])
+	}
+	if got := rec.Header().Get("X-Seen-X-Request-Id"); got != generated[0] {
+		t.Errorf("Expected backend to receive %q, got %q", generated[0], got)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "client-supplied-42")
+	rec = httptest.NewRecorder()
+	lb.ServeHTTP(rec, req)
+
+	if got := rec.Header().Values("X-Request-Id"); len(got) != 1 || got[0] != "client-supplied-42" {
+		t.Errorf("Expected incoming request ID to be reused, got %v", got)
+	}
+
+	ulidLB := newTestLB(t, fmt.Sprintf(`
+request_id:
+  header: X-Correlation-ID
+  format: ulid
+backends:
+  - url: %q
+`, backend.URL))
+
+	rec = httptest.NewRecorder()
+	ulidLB.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if got := rec.Header().Get("X-Correlation-ID"); !ulidPattern.MatchString(got) {
+		t.Errorf("Expected a ULID in X-Correlation-ID, got %q", got)
+	}
+}
+
+var (
+	uuidV7Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	ulidPattern   = regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+)
@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+	"github.com/farhapartex/bolt-load-balancer/internal/core"
+)
+
+func createTestPools(t *testing.T, names ...string) map[string]*core.Pool {
+	pools := make(map[string]*core.Pool)
+	for _, name := range names {
+		healthCheck := config.DefaultConfig().HealthCheck
+		pool, err := core.NewPool(config.PoolConfig{
+			Name:        name,
+			Backends:    []config.BackendConfig{{URL: "http://" + name + ":8080", Weight: 1, MaxFails: 3}},
+			Strategy:    "round_robin",
+			HealthCheck: &healthCheck,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create pool %s: %v", name, err)
+		}
+		pools[name] = pool
+	}
+	return pools
+}
+
+func TestRouterMatching(t *testing.T) {
+	pools := createTestPools(t, "default", "api", "admin", "static", "canary")
+
+	router, err := core.NewRouter([]config.RouteConfig{
+		{Match: config.RouteMatch{Headers: map[string]string{"X-Canary": "1"}}, Pool: "canary"},
+		{Match: config.RouteMatch{Host: "admin.example.com"}, Pool: "admin"},
+		{Match: config.RouteMatch{Host: "*.example.com", PathPrefix: "/api/", Methods: []string{"GET", "POST"}}, Pool: "api"},
+		{Match: config.RouteMatch{PathRegex: `\.(css|js)$`}, Pool: "static"},
+	}, pools, "default")
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+
+	tests := []struct {
+		method   string
+		target   string
+		host     string
+		headers  map[string]string
+		expected string
+	}{
+		{"GET", "/api/users", "www.example.com", nil, "api"},
+		{"DELETE", "/api/users", "www.example.com", nil, "default"},
+		{"GET", "/api/users", "admin.example.com:8443", nil, "admin"},
+		{"GET", "/api/users", "other.org", nil, "default"},
+		{"GET", "/assets/app.js", "other.org", nil, "static"},
+		{"GET", "/api/users", "www.example.com", map[string]string{"X-Canary": "1"}, "canary"},
+		{"GET", "/api/users", "www.example.com", map[string]string{"X-Canary": "0"}, "api"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		req.Host = tt.host
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
+
+		route := router.Match(req)
+		if route == nil {
+			t.Errorf("%s %s%s: expected pool %s, got nil", tt.method, tt.host, tt.target, tt.expected)
+			continue
+		}
+		if route.Pool().Name() != tt.expected {
+			t.Errorf("%s %s%s: expected pool %s, got %s", tt.method, tt.host, tt.target, tt.expected, route.Pool().Name())
+		}
+	}
+}
+
+func TestRouterWithoutDefaultPool(t *testing.T) {
+	pools := createTestPools(t, "api")
+
+	router, err := core.NewRouter([]config.RouteConfig{
+		{Match: config.RouteMatch{PathPrefix: "/api/"}, Pool: "api"},
+	}, pools, "")
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+
+	if route := router.Match(httptest.NewRequest("GET", "/other", nil)); route != nil {
+		t.Errorf("Expected no route for unmatched request, got %s", route.Name())
+	}
+
+	if _, err := core.NewRouter([]config.RouteConfig{{Pool: "missing"}}, pools, ""); err == nil {
+		t.Error("Expected error for route to unknown pool")
+	}
+}
+
+func TestConfigPoolsAndRoutes(t *testing.T) {
+	yamlConfig := `
+pools:
+  - name: users
+    strategy: round_robin
+    backends:
+      - url: "http://users:8080"
+  - name: orders
+    backends:
+      - url: "http://orders:8080"
+routes:
+  - match:
+      path_prefix: /users/
+      methods: [get]
+    pool: users
+  - match:
+      path_prefix: /orders/
+    pool: orders
+default_pool: users
+`
+
+	cfg, err := config.LoadFromBytes([]byte(yamlConfig))
+	if err != nil {
+		t.Fatalf("Failed to load pools config: %v", err)
+	}
+
+	if len(cfg.Backends) != 0 {
+		t.Errorf("Expected built-in default backend to be dropped when pools are configured, got %d", len(cfg.Backends))
+	}
+
+	pools := cfg.EffectivePools()
+	if len(pools) != 2 {
+		t.Fatalf("Expected 2 pools, got %d", len(pools))
+	}
+
+	if pools[1].Strategy != "round_robin" || pools[1].HealthCheck == nil {
+		t.Errorf("Expected orders pool to inherit strategy and health check, got %+v", pools[1])
+	}
+
+	if cfg.Routes[0].Match.Methods[0] != "GET" {
+		t.Errorf("Expected method to be normalized to GET, got %s", cfg.Routes[0].Match.Methods[0])
+	}
+
+	if _, err := core.NewLB(cfg); err != nil {
+		t.Fatalf("Failed to create load balancer with pools: %v", err)
+	}
+
+	invalid := `
+pools:
+  - name: users
+    backends:
+      - url: "http://users:8080"
+routes:
+  - match:
+      path_regex: "("
+    pool: missing
+`
+	_, err = config.LoadFromBytes([]byte(invalid))
+	var verr *config.ValidationError
+	if !errors.As(err, &verr) || len(verr.Errors) != 2 {
+		t.Errorf("Expected 2 route errors, got %v", err)
+	}
+}
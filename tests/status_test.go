@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/core"
+)
+
+func TestStatusEndpoint(t *testing.T) {
+	backend := newTestBackend(t, "one")
+	lb := newTestLB(t, fmt.Sprintf(`
+backends:
+  - url: %q
+    weight: 3
+  - url: "http://127.0.0.1:1"
+`, backend.URL))
+
+	for i := 0; i < 2; i++ {
+		lb.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	recorder := httptest.NewRecorder()
+	lb.AdminHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", recorder.Code)
+	}
+	if got := recorder.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected application/json, got %q", got)
+	}
+
+	var report core.StatusReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Status is not valid JSON: %v\n%s", err, recorder.Body.String())
+	}
+
+	if report.SchemaVersion != core.StatusSchemaVersion {
+		t.Errorf("Expected schema version %d, got %d", core.StatusSchemaVersion, report.SchemaVersion)
+	}
+	if report.Version != core.Version {
+		t.Errorf("Expected version %q, got %q", core.Version, report.Version)
+	}
+	if report.UptimeSeconds < 0.005 {
+		t.Errorf("Expected uptime to reflect time since start, got %f", report.UptimeSeconds)
+	}
+	if report.StartTime.IsZero() || report.StartTime.After(time.Now()) {
+		t.Errorf("Unexpected start time %v", report.StartTime)
+	}
+	if len(report.ConfigHash) != len("sha256:")+64 {
+		t.Errorf("Unexpected config hash %q", report.ConfigHash)
+	}
+	if report.Status != "degraded" || report.HealthyBackends != 1 || report.TotalBackends != 2 {
+		t.Errorf("Expected degraded with 1/2 healthy backends, got %s with %d/%d",
+			report.Status, report.HealthyBackends, report.TotalBackends)
+	}
+
+	if len(report.Pools) != 1 || len(report.Pools[0].Backends) != 2 {
+		t.Fatalf("Expected one pool with two backends, got %+v", report.Pools)
+	}
+	pool := report.Pools[0]
+	if pool.Name != "default" || pool.Algorithm != "round_robin" || !pool.HealthCheck.Enabled {
+		t.Errorf("Unexpected pool status %+v", pool)
+	}
+
+	healthy, down := pool.Backends[0], pool.Backends[1]
+	if healthy.URL != backend.URL || healthy.Status != "healthy" || healthy.Weight != 3 || healthy.LastCheck == nil {
+		t.Errorf("Unexpected healthy backend status %+v", healthy)
+	}
+	if healthy.LatencyMs <= 0 || healthy.InFlightRequests != 0 {
+		t.Errorf("Expected recorded latency and no in-flight requests, got %+v", healthy)
+	}
+	if down.FailCount != 1 || down.MaxFails != 3 || down.LastCheckError == "" {
+		t.Errorf("Unexpected failing backend status %+v", down)
+	}
+}
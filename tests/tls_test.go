@@ -0,0 +1,350 @@
+package tests
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/config"
+	"github.com/farhapartex/bolt-load-balancer/internal/core"
+)
+
+// startLB starts a load balancer from yamlConfig and stops it when the
+// test ends.
+func startLB(t *testing.T, yamlConfig string) *core.LB {
+	t.Helper()
+	cfg, err := config.LoadFromBytes([]byte(yamlConfig))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	lb, err := core.NewLB(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create load balancer: %v", err)
+	}
+	lb.Logger().SetOutput(io.Discard)
+	go lb.Start()
+	t.Cleanup(func() { lb.Stop(context.Background()) })
+	return lb
+}
+
+// waitForTLS waits until the listener on port completes a handshake for
+// a.example with a certificate signed by ca.
+func waitForTLS(t *testing.T, port int, ca *testCA) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		conn, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port), &tls.Config{RootCAs: ca.pool(), ServerName: "a.example"})
+		if err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("Load balancer did not start serving TLS")
+}
+
+// startTLSLB starts a load balancer from yamlConfig, which must use the
+// given port, and waits until it accepts TLS connections.
+func startTLSLB(t *testing.T, yamlConfig string, port int, ca *testCA) *core.LB {
+	t.Helper()
+	lb := startLB(t, yamlConfig)
+	waitForTLS(t, port, ca)
+	return lb
+}
+
+// handshake connects with the given server name and returns the connection
+// state.
+func handshake(t *testing.T, port int, conf *tls.Config) (tls.ConnectionState, error) {
+	t.Helper()
+	conn, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port), conf)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+	return conn.ConnectionState(), nil
+}
+
+func TestServerTLS(t *testing.T) {
+	backend := newTestBackend(t, "one")
+	ca := newTestCA(t)
+	aCert, aKey := ca.issue("a", "a.example", "a.example")
+	bCert, bKey := ca.issue("b", "b.example", "b.example", "*.b.example")
+	port := freePort(t)
+
+	startTLSLB(t, fmt.Sprintf(`
+server:
+  host: 127.0.0.1
+  port: %d
+  tls:
+    cert_file: %q
+    key_file: %q
+    certificates:
+      - cert_file: %q
+        key_file: %q
+    min_version: "1.3"
+    alpn: ["http/1.1"]
+backends:
+  - url: %q
+admin:
+  enabled: false
+`, port, aCert, aKey, bCert, bKey, backend.URL), port, ca)
+
+	for _, tc := range []struct {
+		serverName string
+		expected   string
+	}{
+		{"a.example", "a.example"},
+		{"b.example", "b.example"},
+		{"www.b.example", "b.example"},
+		{"other.example", "a.example"},
+	} {
+		state, err := handshake(t, port, &tls.Config{RootCAs: ca.pool(), ServerName: tc.serverName, InsecureSkipVerify: tc.serverName == "other.example"})
+		if err != nil {
+			t.Errorf("Handshake for %s failed: %v", tc.serverName, err)
+			continue
+		}
+		if got := state.PeerCertificates[0].Subject.CommonName; got != tc.expected {
+			t.Errorf("Expected certificate %s for %s, got %s", tc.expected, tc.serverName, got)
+		}
+		if state.Version != tls.VersionTLS13 {
+			t.Errorf("Expected TLS 1.3, got %x", state.Version)
+		}
+	}
+
+	if _, err := handshake(t, port, &tls.Config{RootCAs: ca.pool(), ServerName: "a.example", MaxVersion: tls.VersionTLS12}); err == nil {
+		t.Error("Expected a TLS 1.2 client to be rejected with min_version 1.3")
+	}
+
+	state, err := handshake(t, port, &tls.Config{RootCAs: ca.pool(), ServerName: "a.example", NextProtos: []string{"h2", "http/1.1"}})
+	if err != nil || state.NegotiatedProtocol != "http/1.1" {
+		t.Errorf("Expected http/1.1 to be negotiated, got %q (%v)", state.NegotiatedProtocol, err)
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: ca.pool(), ServerName: "a.example"}}}
+	resp, err := client.Get(fmt.Sprintf("https://127.0.0.1:%d/", port))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Seen-X-Forwarded-Proto"); got != "https" {
+		t.Errorf("Expected X-Forwarded-Proto https, got %q", got)
+	}
+}
+
+func TestServerTLSCertificateReload(t *testing.T) {
+	backend := newTestBackend(t, "one")
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue("a", "a.example", "a.example")
+	port := freePort(t)
+
+	lb := startTLSLB(t, fmt.Sprintf(`
+server:
+  host: 127.0.0.1
+  port: %d
+  tls:
+    cert_file: %q
+    key_file: %q
+    reload_interval: 20ms
+backends:
+  - url: %q
+admin:
+  enabled: false
+`, port, certFile, keyFile, backend.URL), port, ca)
+
+	serial := func() string {
+		state, err := handshake(t, port, &tls.Config{RootCAs: ca.pool(), ServerName: "a.example"})
+		if err != nil {
+			t.Fatalf("Handshake failed: %v", err)
+		}
+		return state.PeerCertificates[0].SerialNumber.String()
+	}
+	original := serial()
+
+	// A broken file must not replace the working certificate.
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if got := serial(); got != original {
+		t.Fatalf("Expected the old certificate to stay in use, got serial %s", got)
+	}
+
+	ca.issue("a", "a.example", "a.example")
+	renewed := original
+	for i := 0; i < 50 && renewed == original; i++ {
+		time.Sleep(20 * time.Millisecond)
+		renewed = serial()
+	}
+	if renewed == original {
+		t.Fatal("Expected the renewed certificate to be served after the files changed")
+	}
+
+	// Reload also picks up certificates, even when the configuration can't
+	// be reloaded.
+	ca.issue("a", "a.example", "a.example")
+	lb.Reload()
+	if got := serial(); got == renewed {
+		t.Error("Expected Reload to load the new certificate")
+	}
+}
+
+func TestServerTLSValidation(t *testing.T) {
+	tests := []struct {
+		tls      string
+		expected string
+	}{
+		{"min_version: \"1.3\"", "server TLS needs cert_file and key_file, certificates or acme"},
+		{"cert_file: a.pem", "server TLS needs both cert_file and key_file"},
+		{"certificates:\n      - cert_file: a.pem", "certificate needs both cert_file and key_file"},
+		{"cert_file: a.pem\n    key_file: a.key\n    min_version: \"1.1\"", `invalid TLS version "1.1"`},
+		{"cert_file: a.pem\n    key_file: a.key\n    cipher_suites: [TLS_RSA_WITH_RC4_128_SHA]", "unknown or insecure cipher suite"},
+		{"cert_file: a.pem\n    key_file: a.key\n    cipher_suites: [TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384]", "HTTP/2 (h2 in alpn) requires"},
+	}
+
+	for _, tc := range tests {
+		_, err := config.LoadFromBytes([]byte(fmt.Sprintf(`
+server:
+  tls:
+    %s
+backends:
+  - url: "http://127.0.0.1:9000"
+`, tc.tls)))
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("Expected error containing %q for:\n%s\ngot %v", tc.expected, tc.tls, err)
+		}
+	}
+
+	cfg, err := config.LoadFromBytes([]byte(`
+server:
+  tls:
+    cert_file: a.pem
+    key_file: a.key
+    cipher_suites: [TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256]
+backends:
+  - url: "http://127.0.0.1:9000"
+`))
+	if err != nil {
+		t.Fatalf("Expected a valid TLS config, got %v", err)
+	}
+	if cfg.Server.TLS.MinVersion != "1.2" || strings.Join(cfg.Server.TLS.ALPN, ",") != "h2,http/1.1" ||
+		cfg.Server.TLS.ReloadInterval != config.DefaultCertReloadInterval {
+		t.Errorf("Unexpected TLS defaults: %+v", cfg.Server.TLS)
+	}
+}
+
+func TestHTTPRedirectAndHSTS(t *testing.T) {
+	backend := newTestBackend(t, "one")
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue("a", "a.example", "a.example")
+	port := freePort(t)
+	redirectPort := freePort(t)
+
+	startTLSLB(t, fmt.Sprintf(`
+server:
+  host: 127.0.0.1
+  port: %d
+  tls:
+    cert_file: %q
+    key_file: %q
+  http_redirect:
+    port: %d
+    status_code: 308
+  hsts:
+    max_age: 24h
+    include_subdomains: true
+backends:
+  - url: %q
+admin:
+  enabled: false
+`, port, certFile, keyFile, redirectPort, backend.URL), port, ca)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/shop/cart?item=1", redirectPort), nil)
+	req.Host = "a.example:80"
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	expected := fmt.Sprintf("https://a.example:%d/shop/cart?item=1", port)
+	if resp.StatusCode != http.StatusPermanentRedirect || resp.Header.Get("Location") != expected {
+		t.Errorf("Expected 308 to %s, got %d %q", expected, resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if resp.Header.Get("Strict-Transport-Security") != "" {
+		t.Error("Expected no HSTS header over plain HTTP")
+	}
+
+	resp, err = client.Get(fmt.Sprintf("http://127.0.0.1:%d/.well-known/acme-challenge/token", redirectPort))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Test-Path") != "/.well-known/acme-challenge/token" {
+		t.Errorf("Expected the challenge path to be proxied, got %d %q", resp.StatusCode, resp.Header.Get("X-Test-Path"))
+	}
+
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: ca.pool(), ServerName: "a.example"}}}
+	resp, err = client.Get(fmt.Sprintf("https://127.0.0.1:%d/", port))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Strict-Transport-Security"); got != "max-age=86400; includeSubDomains" {
+		t.Errorf("Unexpected HSTS header %q", got)
+	}
+}
+
+func TestHTTPRedirectValidation(t *testing.T) {
+	tests := []struct {
+		server   string
+		expected string
+	}{
+		{"http_redirect:\n    port: 8080", "http_redirect requires server.tls"},
+		{"hsts:\n    max_age: 1h", "hsts requires server.tls"},
+		{"tls:\n    cert_file: a.pem\n    key_file: a.key\n  http_redirect:\n    status_code: 302", "invalid redirect status 302"},
+		{"tls:\n    cert_file: a.pem\n    key_file: a.key\n  http_redirect:\n    port: 8443", "already used by the server"},
+		{"tls:\n    cert_file: a.pem\n    key_file: a.key\n  http_redirect:\n    exempt_paths: [acme]", `exempt path "acme" must start with /`},
+		{"tls:\n    cert_file: a.pem\n    key_file: a.key\n  hsts:\n    preload: true", "preload requires include_subdomains"},
+	}
+
+	for _, tc := range tests {
+		_, err := config.LoadFromBytes([]byte(fmt.Sprintf(`
+server:
+  port: 8443
+  %s
+backends:
+  - url: "http://127.0.0.1:9000"
+`, tc.server)))
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("Expected error containing %q for:\n%s\ngot %v", tc.expected, tc.server, err)
+		}
+	}
+
+	cfg, err := config.LoadFromBytes([]byte(`
+server:
+  port: 8443
+  tls:
+    cert_file: a.pem
+    key_file: a.key
+  http_redirect: {}
+  hsts: {}
+backends:
+  - url: "http://127.0.0.1:9000"
+`))
+	if err != nil {
+		t.Fatalf("Expected a valid config, got %v", err)
+	}
+	redirect := cfg.Server.HTTPRedirect
+	if redirect.Port != 80 || redirect.HTTPSPort != 8443 || redirect.StatusCode != http.StatusMovedPermanently ||
+		len(redirect.ExemptPaths) != 1 || redirect.ExemptPaths[0] != "/.well-known/acme-challenge/" {
+		t.Errorf("Unexpected redirect defaults: %+v", redirect)
+	}
+	if got := cfg.Server.HSTS.HeaderValue(); got != "max-age=31536000" {
+		t.Errorf("Unexpected default HSTS header %q", got)
+	}
+}
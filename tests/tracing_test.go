@@ -0,0 +1,213 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/farhapartex/bolt-load-balancer/internal/tracing"
+)
+
+type collectedSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	TraceState   string `json:"traceState"`
+	Name         string `json:"name"`
+	Kind         int    `json:"kind"`
+	Attributes   []struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	} `json:"attributes"`
+	Status struct {
+		Code int `json:"code"`
+	} `json:"status"`
+}
+
+func (s collectedSpan) attribute(key string) interface{} {
+	for _, attr := range s.Attributes {
+		if attr.Key == key {
+			for _, value := range attr.Value {
+				return value
+			}
+		}
+	}
+	return nil
+}
+
+// newTestCollector starts a stand-in OTLP/HTTP collector that records every
+// span it receives.
+func newTestCollector(t *testing.T) (*httptest.Server, func() []collectedSpan) {
+	var mutex sync.Mutex
+	var spans []collectedSpan
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected export request: %s %s (%s)", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+
+		var payload struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []collectedSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("Invalid OTLP payload: %v", err)
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, resource := range payload.ResourceSpans {
+			for _, scope := range resource.ScopeSpans {
+				spans = append(spans, scope.Spans...)
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []collectedSpan {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]collectedSpan(nil), spans...)
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		value   string
+		valid   bool
+		sampled bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6-00f067aa0ba902b7-01", false, false},
+		{"", false, false},
+	}
+
+	for _, test := range tests {
+		sc, err := tracing.ParseTraceparent(test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("ParseTraceparent(%q): expected valid=%v, got error %v", test.value, test.valid, err)
+			continue
+		}
+		if test.valid && sc.Sampled != test.sampled {
+			t.Errorf("ParseTraceparent(%q): expected sampled=%v", test.value, test.sampled)
+		}
+	}
+}
+
+func TestProxyTracing(t *testing.T) {
+	backend := newTestBackend(t, "one")
+	collector, spans := newTestCollector(t)
+
+	lb := newTestLB(t, fmt.Sprintf(`
+backends:
+  - url: %q
+tracing:
+  enabled: true
+  endpoint: %q
+  flush_interval: 1h
+`, backend.URL, collector.URL+"/v1/traces"))
+
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=abc")
+	recorder := httptest.NewRecorder()
+	lb.ServeHTTP(recorder, req)
+
+	upstream, err := tracing.ParseTraceparent(recorder.Header().Get("X-Seen-Traceparent"))
+	if err != nil {
+		t.Fatalf("Backend did not receive a valid traceparent: %v", err)
+	}
+	if upstream.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || !upstream.Sampled {
+		t.Errorf("Expected the incoming trace to continue, got %+v", upstream)
+	}
+	if got := recorder.Header().Get("X-Seen-Tracestate"); got != "vendor=abc" {
+		t.Errorf("Expected tracestate to be forwarded, got %q", got)
+	}
+
+	if err := lb.Stop(context.Background()); err != nil {
+		t.Fatalf("Failed to stop load balancer: %v", err)
+	}
+
+	collected := spans()
+	if len(collected) != 2 {
+		t.Fatalf("Expected 2 exported spans, got %d: %+v", len(collected), collected)
+	}
+
+	var server, client collectedSpan
+	for _, span := range collected {
+		switch span.Kind {
+		case int(tracing.SpanKindServer):
+			server = span
+		case int(tracing.SpanKindClient):
+			client = span
+		}
+	}
+
+	if server.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("Expected server span parent 00f067aa0ba902b7, got %q", server.ParentSpanID)
+	}
+	if client.ParentSpanID != server.SpanID {
+		t.Errorf("Expected client span to be a child of the server span")
+	}
+	if client.SpanID != upstream.SpanID.String() {
+		t.Errorf("Expected the backend to see the client span ID %s, got %s", client.SpanID, upstream.SpanID)
+	}
+	if server.Name != "GET default" {
+		t.Errorf("Expected server span name 'GET default', got %q", server.Name)
+	}
+	if got := client.attribute("bolt.backend"); got != backend.URL {
+		t.Errorf("Expected bolt.backend %s, got %v", backend.URL, got)
+	}
+	if got := client.attribute("bolt.algorithm"); got != "round_robin" {
+		t.Errorf("Expected bolt.algorithm round_robin, got %v", got)
+	}
+	if got := client.attribute("bolt.retry_count"); got != nil {
+		t.Errorf("Expected no bolt.retry_count, as bolt does not retry, got %v", got)
+	}
+	if got := server.attribute("http.response.status_code"); got != "200" {
+		t.Errorf("Expected status code 200 on server span, got %v", got)
+	}
+}
+
+func TestProxyTracingSampling(t *testing.T) {
+	backend := newTestBackend(t, "one")
+	collector, spans := newTestCollector(t)
+
+	lb := newTestLB(t, fmt.Sprintf(`
+backends:
+  - url: %q
+tracing:
+  enabled: true
+  endpoint: %q
+  sample_ratio: 0
+`, backend.URL, collector.URL+"/v1/traces"))
+
+	recorder := httptest.NewRecorder()
+	lb.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	traceparent := recorder.Header().Get("X-Seen-Traceparent")
+	if !strings.HasSuffix(traceparent, "-00") {
+		t.Errorf("Expected an unsampled traceparent to be propagated, got %q", traceparent)
+	}
+
+	lb.Stop(context.Background())
+	if collected := spans(); len(collected) != 0 {
+		t.Errorf("Expected no exported spans, got %d", len(collected))
+	}
+}